@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"connectrpc.com/connect"
+	agentv1 "github.com/MizuchiLabs/ssh-nexus/api/proto/gen/agent/v1"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
+)
+
+// monitorLogins follows the sshd logs and sends every login to the server
+func monitorLogins(
+	ctx context.Context,
+	stream *connect.BidiStreamForClient[agentv1.StreamRequest, agentv1.StreamResponse],
+) {
+	cmd, parse := loginSource(ctx)
+	if cmd == nil {
+		slog.Warn("no sshd logs found, login events are disabled")
+		return
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		slog.Error("failed to read sshd logs", "err", err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Error("failed to read sshd logs", "err", err)
+		return
+	}
+	defer cmd.Wait()
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		event, ok := parse(scanner.Bytes())
+		if !ok {
+			continue
+		}
+		login := &agentv1.StreamRequest_LoginEvent{
+			Time:        event.Time.Unix(),
+			Accepted:    event.Accepted,
+			Method:      event.Method,
+			User:        event.User,
+			Address:     event.Address,
+			Port:        uint32(event.Port),
+			KeyType:     event.KeyType,
+			Fingerprint: event.Fingerprint,
+			KeyId:       event.KeyID,
+			Serial:      event.Serial,
+			Ca:          event.CA,
+		}
+		if err := send(stream, &agentv1.StreamRequest{Logins: []*agentv1.StreamRequest_LoginEvent{login}}); err != nil {
+			slog.Error("failed to send login event", "err", err)
+			return
+		}
+	}
+}
+
+// loginSource prefers the journal and falls back to the auth log files
+func loginSource(ctx context.Context) (*exec.Cmd, func([]byte) (*host.LoginEvent, bool)) {
+	if _, err := exec.LookPath("journalctl"); err == nil {
+		cmd := exec.CommandContext(
+			ctx,
+			"journalctl", "-f", "-n", "0", "-o", "json",
+			"-t", "sshd", "-t", "sshd-session",
+		)
+		return cmd, host.ParseJournal
+	}
+
+	for _, path := range host.AuthLogPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "tail", "-F", "-n", "0", path)
+		return cmd, func(line []byte) (*host.LoginEvent, bool) {
+			return host.ParseSyslog(string(line), time.Now())
+		}
+	}
+	return nil, nil
+}
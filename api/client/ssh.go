@@ -2,33 +2,41 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"os/user"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"connectrpc.com/connect"
 	agentv1 "github.com/MizuchiLabs/ssh-nexus/api/proto/gen/agent/v1"
 	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/MizuchiLabs/ssh-nexus/tools/updater"
 	"golang.org/x/crypto/ssh"
 )
 
+// backup keeps the original state of every file the agent modifies
+var backup = host.NewBackup(host.Local{})
+
 // listener sends a request to the server and listens for responses
 func listener(
 	ctx context.Context,
 	stream *connect.BidiStreamForClient[agentv1.StreamRequest, agentv1.StreamResponse],
 ) {
-	if err := stream.Send(createRequest()); err != nil {
+	if err := send(stream, createRequest()); err != nil {
 		slog.Error("failed to send request", "err", err)
 		return
 	}
 
 	go monitorCertificate(ctx, stream)
+	go monitorLogins(ctx, stream)
 
 	for {
 		resp, err := stream.Receive()
@@ -43,9 +51,39 @@ func listener(
 		if err := action(resp); err != nil {
 			slog.Error("failed to update files", "err", err)
 		}
+
+		if resp.GetRestore() {
+			restored, err := restore()
+			if err != nil {
+				slog.Error("failed to restore files", "err", err)
+			}
+			report := &agentv1.StreamRequest{}
+			for _, file := range restored {
+				report.Restored = append(report.Restored, &agentv1.StreamRequest_RestoredFile{
+					Path:   file.Path,
+					Action: file.Action,
+				})
+			}
+			if err := send(stream, report); err != nil {
+				slog.Error("failed to send restore report", "err", err)
+			}
+			os.Exit(0)
+		}
 	}
 }
 
+// sendMu guards the stream, requests are sent from multiple goroutines
+var sendMu sync.Mutex
+
+func send(
+	stream *connect.BidiStreamForClient[agentv1.StreamRequest, agentv1.StreamResponse],
+	request *agentv1.StreamRequest,
+) error {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	return stream.Send(request)
+}
+
 func createRequest() *agentv1.StreamRequest {
 	request := agentv1.StreamRequest{}
 
@@ -79,7 +117,7 @@ func monitorCertificate(
 				continue
 			}
 			if renew {
-				if err := stream.Send(createRequest()); err != nil {
+				if err := send(stream, createRequest()); err != nil {
 					slog.Error("failed to send request", "err", err)
 					return
 				}
@@ -120,6 +158,9 @@ func renewHostCert() (bool, error) {
 // getPublicHostKey checks if a default host key exists, creates it if not and returns the public host key
 func getPublicHostKey() (string, error) {
 	if _, err := os.Stat(data.PrivateHostKeyPath); os.IsNotExist(err) {
+		if err := backup.Snapshot(data.PrivateHostKeyPath, data.PublicHostKeyPath); err != nil {
+			return "", err
+		}
 		if err := data.NewSigner(data.PrivateHostKeyPath, "host@ssh-nexus"); err != nil {
 			return "", fmt.Errorf("failed to create host ca: %w", err)
 		}
@@ -143,14 +184,14 @@ func action(resp *agentv1.StreamResponse) error {
 	if err := updateHostCert(resp.GetHostCertificatePublicKey()); err != nil {
 		return err
 	}
+	if err := updateAccounts(resp.GetAccounts(), resp.AccountPolicy); err != nil {
+		return err
+	}
 	if err := updatePrincipals(resp.GetPrincipals()); err != nil {
 		return err
 	}
-
-	if resp.GetRestore() {
-		if err := restore(); err != nil {
-			return err
-		}
+	if err := updateAuthorizedKeys(resp.GetAuthorizedKeys()); err != nil {
+		return err
 	}
 	return nil
 }
@@ -160,19 +201,22 @@ func updateSSHConfig(config []byte) error {
 	if config == nil {
 		return nil
 	}
+	if err := backup.Snapshot(data.SSHConfigPath); err != nil {
+		return err
+	}
 	slog.Info("updated ssh config")
 	return os.WriteFile(data.SSHConfigPath, config, 0600)
 }
 
-// Add our public key to the server (as a user ca and authorized key)
+// Add our public key to the server as a user ca
 func updateUserCA(pub []byte) error {
 	if pub == nil {
 		return nil
 	}
-	slog.Info("updated user ca")
-	if err := os.WriteFile(data.AuthorizedKeysPath, pub, 0600); err != nil {
-		return fmt.Errorf("failed to write authorized keys: %w", err)
+	if err := backup.Snapshot(data.PublicUserKeyPath); err != nil {
+		return err
 	}
+	slog.Info("updated user ca")
 	return os.WriteFile(data.PublicUserKeyPath, pub, 0600)
 }
 
@@ -181,10 +225,80 @@ func updateHostCert(pub []byte) error {
 	if pub == nil {
 		return nil
 	}
+	if err := backup.Snapshot(data.CertHostPath); err != nil {
+		return err
+	}
 	slog.Info("updated host certificate")
 	return os.WriteFile(data.CertHostPath, pub, 0600)
 }
 
+// Make sure the linux accounts of the groups exist
+func updateAccounts(accounts []*agentv1.StreamResponse_Account, policy *string) error {
+	// The policy is always sent together with the full list of accounts
+	if policy == nil {
+		return nil
+	}
+
+	var list []host.Account
+	for _, account := range accounts {
+		list = append(list, host.Account{
+			Name:    account.GetName(),
+			Shell:   account.GetShell(),
+			Home:    account.GetHome(),
+			Groups:  account.GetGroups(),
+			Sudoers: account.GetSudoers(),
+		})
+	}
+
+	script, err := host.AccountScript(list, *policy)
+	if err != nil {
+		return err
+	}
+	if err := backup.Snapshot(host.AccountPaths(list)...); err != nil {
+		return err
+	}
+	out, err := exec.Command("sh", "-c", script).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to update accounts: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	slog.Info("updated accounts", "accounts", len(list), "policy", *policy)
+	return nil
+}
+
+// Render the managed authorized_keys blocks of all linux users
+func updateAuthorizedKeys(authorizedKeys *agentv1.StreamResponse_AuthorizedKeys) error {
+	// Only sent together with the keys of every user
+	if authorizedKeys == nil {
+		return nil
+	}
+
+	keys := make(map[string][]string)
+	for _, entry := range authorizedKeys.GetUsers() {
+		keys[entry.GetName()] = append(keys[entry.GetName()], entry.GetKeys()...)
+	}
+
+	lookup := func(name string) (*host.LinuxUser, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		uid, err := strconv.Atoi(u.Uid)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.Atoi(u.Gid)
+		if err != nil {
+			return nil, err
+		}
+		return &host.LinuxUser{UID: uid, GID: gid, Home: u.HomeDir}, nil
+	}
+	if err := host.UpdateAuthorizedKeys(host.Local{}, backup, lookup, keys); err != nil {
+		return fmt.Errorf("failed to update authorized keys: %w", err)
+	}
+	slog.Info("updated authorized keys", "users", len(keys))
+	return nil
+}
+
 // Add correct principals to the server
 func updatePrincipals(principals []*agentv1.StreamResponse_Principal) error {
 	principalMap := make(map[string][]string)
@@ -197,66 +311,45 @@ func updatePrincipals(principals []*agentv1.StreamResponse_Principal) error {
 		principalMap["root"] = append([]string{"root"}, principalMap["root"]...)
 	}
 
-	groups := make(map[string]bool) // Used to check if the groups are the same
-	for group, users := range principalMap {
-		GroupPath := filepath.Join(data.PrincipalPath, group)
-
-		groups[group] = true
-
-		if err := os.MkdirAll(data.PrincipalPath, 0750); err != nil {
-			return err
-		}
-
-		if err := os.WriteFile(GroupPath, []byte(strings.Join(users, "\n")), 0600); err != nil {
-			return err
-		}
-		slog.Info("updated principals", "group", group, "users", users)
-	}
-
-	// Get the current groups on the machine and compare them
-	currentGroups, err := os.ReadDir(data.PrincipalPath)
-	if err != nil {
+	if err := host.UpdatePrincipals(host.Local{}, backup, data.PrincipalPath, principalMap); err != nil {
 		return err
 	}
-
-	// Check if the groups are the same if not, delete them
-	for _, group := range currentGroups {
-		if !groups[group.Name()] {
-			GroupPath := filepath.Join(data.PrincipalPath, group.Name())
-			if err := os.RemoveAll(GroupPath); err != nil {
-				return err
-			}
-			slog.Info("deleted principals", "group", group.Name())
-		}
-	}
-
+	slog.Info("updated principals", "users", len(principalMap))
 	return nil
 }
 
-// restore removes all files from the server for cleanup
-func restore() error {
-	dirs := []string{
+// restore resets all files to their state before nexus was installed
+func restore() ([]host.Restored, error) {
+	// The agent exits after the restore, it only has to be removed from boot
+	output, err := exec.Command("sh", "-c", host.DetectInitScript).Output()
+	service, detectErr := host.DetectInit(string(output))
+	if err != nil || detectErr != nil {
+		slog.Error("failed to detect init system", "err", errors.Join(err, detectErr))
+	} else if err := exec.Command("sh", "-c", service.Disable).Run(); err != nil {
+		slog.Error("failed to disable agent", "init", service.Name, "err", err)
+	}
+
+	// Files which only exist because of nexus, in case there is no backup
+	leftovers := append([]string{
 		data.PrincipalPath,
 		data.SSHConfigPath,
 		data.PublicUserKeyPath,
 		data.CertHostPath,
 		data.AgentPath,
-		data.AgentService,
 		data.Token,
+	}, host.AgentServicePaths()...)
+	restored, err := backup.Restore(leftovers...)
+	for _, file := range restored {
+		slog.Info("restored file", "path", file.Path, "action", file.Action)
 	}
-	for _, dir := range dirs {
-		if err := os.RemoveAll(dir); err != nil {
-			return err
-		}
+	if err != nil {
+		return restored, err
 	}
 
-	if err := exec.Command("systemctl", "disable", "nexus-agent").Run(); err != nil {
-		return err
-	}
-	if err := exec.Command("systemctl", "daemon-reload").Run(); err != nil {
-		return err
+	if service.Reload != "" {
+		if err := exec.Command("sh", "-c", service.Reload).Run(); err != nil {
+			return restored, err
+		}
 	}
-
-	os.Exit(0)
-	return nil
+	return restored, nil
 }
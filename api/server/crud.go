@@ -3,12 +3,20 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"maps"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	agentv1 "github.com/MizuchiLabs/ssh-nexus/api/proto/gen/agent/v1"
+	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/crypto/ssh"
 )
 
 func filterMachine(
@@ -123,6 +131,187 @@ func getPrincipals(
 	return principals, nil
 }
 
+func getAccounts(
+	app core.App,
+	machine *models.Record,
+) ([]*agentv1.StreamResponse_Account, error) {
+	accounts, err := MachineAccounts(app, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialize data
+	var messages []*agentv1.StreamResponse_Account
+	for _, account := range accounts {
+		messages = append(messages, &agentv1.StreamResponse_Account{
+			Name:    account.Name,
+			Shell:   account.Shell,
+			Home:    account.Home,
+			Groups:  account.Groups,
+			Sudoers: account.Sudoers,
+		})
+	}
+	return messages, nil
+}
+
+func getAuthorizedKeys(
+	app core.App,
+	machine *models.Record,
+) (*agentv1.StreamResponse_AuthorizedKeys, error) {
+	keys, err := MachineAuthorizedKeys(app, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Serialize data, root first
+	names := []string{"root"}
+	for _, name := range slices.Sorted(maps.Keys(keys)) {
+		if name != "root" {
+			names = append(names, name)
+		}
+	}
+	authorizedKeys := &agentv1.StreamResponse_AuthorizedKeys{}
+	for _, name := range names {
+		authorizedKeys.Users = append(authorizedKeys.Users, &agentv1.StreamResponse_AuthorizedKeys_User{
+			Name: name,
+			Keys: keys[name],
+		})
+	}
+	return authorizedKeys, nil
+}
+
+// MachineAccounts fetches all linux accounts which should exist on a machine
+func MachineAccounts(
+	app core.App,
+	machine *models.Record,
+) ([]host.Account, error) {
+	if machine == nil {
+		return nil, fmt.Errorf("no machine provided")
+	}
+
+	if err := app.Dao().ExpandRecord(machine, []string{"groups"}, nil); len(err) > 0 {
+		return nil, fmt.Errorf("failed to expand: %v", err)
+	}
+
+	var accounts []host.Account
+	index := make(map[string]int)
+	for _, group := range machine.ExpandedAll("groups") {
+		name := group.GetString("linux_username")
+		if name == "" || name == "root" {
+			continue
+		}
+
+		// Multiple groups can share the same linux user, merge them
+		i, ok := index[name]
+		if !ok {
+			index[name] = len(accounts)
+			accounts = append(accounts, host.Account{Name: name})
+			i = index[name]
+		}
+		account := &accounts[i]
+		if account.Shell == "" {
+			account.Shell = group.GetString("shell")
+		}
+		if account.Home == "" {
+			account.Home = group.GetString("home")
+		}
+		if account.Sudoers == "" {
+			account.Sudoers = group.GetString("sudoers")
+		}
+		for _, g := range host.ParseGroups(group.GetString("supplementary_groups")) {
+			if !slices.Contains(account.Groups, g) {
+				account.Groups = append(account.Groups, g)
+			}
+		}
+	}
+
+	return accounts, nil
+}
+
+// AccountPolicy returns the policy for unreferenced accounts created by nexus
+func AccountPolicy(app core.App) string {
+	policy, err := app.Dao().FindFirstRecordByData("settings", "key", "account_policy")
+	if err != nil {
+		return host.AccountPolicyKeep
+	}
+	return host.ValidPolicy(policy.GetString("value"))
+}
+
+// MachineAuthorizedKeys fetches the plain public keys per linux user on a
+// machine, users get the same accounts as with their certificates. The
+// agent and the server over ssh both write these.
+func MachineAuthorizedKeys(
+	app core.App,
+	machine *models.Record,
+) (map[string][]string, error) {
+	if machine == nil {
+		return nil, fmt.Errorf("no machine provided")
+	}
+
+	if err := app.Dao().ExpandRecord(machine, []string{"groups", "users"}, nil); len(err) > 0 {
+		return nil, fmt.Errorf("failed to expand: %v", err)
+	}
+
+	// The server always needs access to root for manual updates
+	publicKey, err := data.GetPublicUserKey()
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string][]string{"root": {strings.TrimSpace(string(publicKey))}}
+
+	addKeys := func(linuxUser string, user *models.Record) error {
+		records, err := app.Dao().
+			FindRecordsByFilter("public_keys", "user = {:user}", "created", 0, 0, dbx.Params{"user": user.Id})
+		if err != nil {
+			return fmt.Errorf("failed to find public keys: %v", err)
+		}
+		for _, record := range records {
+			line, err := host.PublicKey{
+				Key:     record.GetString("key"),
+				From:    record.GetString("from"),
+				Command: record.GetString("command"),
+			}.Line()
+			if err != nil {
+				slog.Warn("Skipping invalid public key", "id", record.Id, "err", err)
+				continue
+			}
+			if !slices.Contains(keys[linuxUser], line) {
+				keys[linuxUser] = append(keys[linuxUser], line)
+			}
+		}
+		return nil
+	}
+
+	for _, group := range machine.ExpandedAll("groups") {
+		users, err := app.Dao().
+			FindRecordsByFilter("users", "groups.id ?= {:group_id}", "", 0, 0, dbx.Params{"group_id": group.Id})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find users: %v", err)
+		}
+		for _, user := range users {
+			if err := addKeys(group.GetString("linux_username"), user); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, user := range machine.ExpandedAll("users") {
+		if err := addKeys("root", user); err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+func getMachinesByGroup(app core.App, group *models.Record) ([]*models.Record, error) {
+	machines, err := app.Dao().
+		FindRecordsByFilter("machines", "groups.id ?= {:group_id}", "", 0, 0, dbx.Params{"group_id": group.Id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find machines: %v", err)
+	}
+	return machines, nil
+}
+
 func getUserMachines(
 	app core.App,
 	user *models.Record,
@@ -166,3 +355,89 @@ func getUserMachines(
 
 	return machines, nil
 }
+
+// insertRestoreLog keeps the restore report of an agent in the auditlog
+func insertRestoreLog(app core.App, machine *models.Record, restored []host.Restored) error {
+	auditlogCollection, err := app.Dao().FindCollectionByNameOrId("auditlog")
+	if err != nil {
+		return err
+	}
+
+	auditlog := models.NewRecord(auditlogCollection)
+	auditlog.Set("collection", machine.Collection().Name)
+	auditlog.Set("record", machine.Id)
+	auditlog.Set("event", "restore")
+	auditlog.Set("data", map[string]any{
+		"name":     machine.GetString("name"),
+		"restored": restored,
+	})
+	return app.Dao().SaveRecord(auditlog)
+}
+
+// insertSessions stores the logins reported by an agent
+func insertSessions(
+	app core.App,
+	machine *models.Record,
+	logins []*agentv1.StreamRequest_LoginEvent,
+) error {
+	sessions, err := app.Dao().FindCollectionByNameOrId("sessions")
+	if err != nil {
+		return err
+	}
+
+	for _, login := range logins {
+		session := models.NewRecord(sessions)
+		session.Set("machine", machine.Id)
+		session.Set("linux_username", login.GetUser())
+		session.Set("accepted", login.GetAccepted())
+		session.Set("method", login.GetMethod())
+		session.Set("address", login.GetAddress())
+		session.Set("port", login.GetPort())
+		session.Set("key_type", login.GetKeyType())
+		session.Set("fingerprint", login.GetFingerprint())
+		session.Set("key_id", login.GetKeyId())
+		if login.GetKeyId() != "" {
+			session.Set("serial", strconv.FormatUint(login.GetSerial(), 10))
+		}
+		session.Set("time", time.Unix(login.GetTime(), 0).UTC())
+		if user := findLoginUser(app, login); user != nil {
+			session.Set("user", user.Id)
+		}
+		if err := app.Dao().SaveRecord(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findLoginUser matches the certificate key id or the fingerprint of a plain
+// public key to a user
+func findLoginUser(app core.App, login *agentv1.StreamRequest_LoginEvent) *models.Record {
+	if principal, ok := strings.CutSuffix(login.GetKeyId(), "@ssh-nexus"); ok {
+		user, err := app.Dao().FindFirstRecordByData("users", "principal", principal)
+		if err == nil {
+			return user
+		}
+	}
+
+	if login.GetFingerprint() == "" || strings.HasSuffix(login.GetKeyType(), "-CERT") {
+		return nil
+	}
+	keys, err := app.Dao().FindRecordsByFilter("public_keys", "id != ''", "", 0, 0)
+	if err != nil {
+		return nil
+	}
+	for _, key := range keys {
+		pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key.GetString("key")))
+		if err != nil {
+			continue
+		}
+		if ssh.FingerprintSHA256(pub) == login.GetFingerprint() {
+			user, err := app.Dao().FindRecordById("users", key.GetString("user"))
+			if err == nil {
+				return user
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/test"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestMachineAccounts(t *testing.T) {
+	type args struct {
+		app     core.App
+		machine *models.Record
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Valid Machine Accounts",
+			args: args{
+				app:     test.SetupApp(t),
+				machine: test.GetRecord(t, "machines", "groups != ''"),
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid Machine",
+			args: args{
+				app:     test.SetupApp(t),
+				machine: nil,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := MachineAccounts(tt.args.app, tt.args.machine)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MachineAccounts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, account := range got {
+				if account.Name == "root" {
+					t.Errorf("MachineAccounts() = %v, should not contain root", got)
+				}
+			}
+		})
+	}
+}
@@ -8,7 +8,9 @@ import (
 
 	agentv1 "github.com/MizuchiLabs/ssh-nexus/api/proto/gen/agent/v1"
 	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
 )
 
 func BoolPointer(b bool) *bool {
@@ -32,9 +34,23 @@ func (s *AgentServer) initClient(client Client) {
 		slog.Error("failed to get principals", "err", err)
 	}
 
+	accounts, err := getAccounts(s.PB, client.Machine)
+	if err != nil {
+		slog.Error("failed to get accounts", "err", err)
+	}
+	policy := AccountPolicy(s.PB)
+
+	keys, err := getAuthorizedKeys(s.PB, client.Machine)
+	if err != nil {
+		slog.Error("failed to get authorized keys", "err", err)
+	}
+
 	response.SshConfig = []byte(sshConfig.GetString("value"))
 	response.UserCertificatePublicKey = userCa
 	response.Principals = principals
+	response.Accounts = accounts
+	response.AccountPolicy = &policy
+	response.AuthorizedKeys = keys
 
 	if err := client.Stream.Send(response); err != nil {
 		slog.Error("initializing agent error", "err", err)
@@ -42,6 +58,31 @@ func (s *AgentServer) initClient(client Client) {
 }
 
 func (s *AgentServer) monitorHook(client Client, req *agentv1.StreamRequest) {
+	// The agent reports the restored files before it exits
+	if len(req.GetRestored()) > 0 {
+		var restored []host.Restored
+		for _, file := range req.GetRestored() {
+			restored = append(restored, host.Restored{Path: file.GetPath(), Action: file.GetAction()})
+			slog.Info(
+				"agent restored file",
+				"name", client.Machine.GetString("name"),
+				"path", file.GetPath(),
+				"action", file.GetAction(),
+			)
+		}
+		if err := insertRestoreLog(s.PB, client.Machine, restored); err != nil {
+			slog.Error("failed to save restore report", "err", err)
+		}
+		return
+	}
+
+	if len(req.GetLogins()) > 0 {
+		if err := insertSessions(s.PB, client.Machine, req.GetLogins()); err != nil {
+			slog.Error("failed to save sessions", "err", err)
+		}
+		return
+	}
+
 	response := &agentv1.StreamResponse{}
 
 	if req.GetPublicHostKey() != "" {
@@ -60,6 +101,54 @@ func (s *AgentServer) monitorHook(client Client, req *agentv1.StreamRequest) {
 	}
 }
 
+// pushMachine sends the principals, accounts and authorized keys of a machine
+// to its agent, machines without a connected agent are skipped
+func (s *AgentServer) pushMachine(machine *models.Record) {
+	s.mu.Lock()
+	client, ok := s.Clients[machine.Id]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	principals, err := getPrincipals(s.PB, machine)
+	if err != nil {
+		slog.Error("failed to get principals", "err", err)
+	}
+	accounts, err := getAccounts(s.PB, machine)
+	if err != nil {
+		slog.Error("failed to get accounts", "err", err)
+	}
+	policy := AccountPolicy(s.PB)
+	keys, err := getAuthorizedKeys(s.PB, machine)
+	if err != nil {
+		slog.Error("failed to get authorized keys", "err", err)
+	}
+
+	reply := &agentv1.StreamResponse{
+		Principals:     principals,
+		Accounts:       accounts,
+		AccountPolicy:  &policy,
+		AuthorizedKeys: keys,
+	}
+	if err := client.Stream.Send(reply); err != nil {
+		slog.Error("updating agent error", "err", err)
+	}
+}
+
+// PushMachines sends the current configuration to the connected agents of
+// the given machines. Record API requests are pushed by the hooks, this is for
+// changes saved outside of them like apply, imports and provider syncs.
+func PushMachines(machines []*models.Record) {
+	s := agents.Load()
+	if s == nil {
+		return
+	}
+	for _, machine := range machines {
+		s.pushMachine(machine)
+	}
+}
+
 func (s *AgentServer) pbHook() {
 	s.PB.OnRecordAfterUpdateRequest("settings").
 		Add(func(e *core.RecordUpdateEvent) error {
@@ -79,15 +168,18 @@ func (s *AgentServer) pbHook() {
 
 	s.PB.OnRecordAfterUpdateRequest("machines").
 		Add(func(e *core.RecordUpdateEvent) error {
-			client := s.Clients[e.Record.Id]
-			principals, err := getPrincipals(s.PB, e.Record)
+			s.pushMachine(e.Record)
+			return nil
+		})
+
+	s.PB.OnRecordAfterUpdateRequest("groups").
+		Add(func(e *core.RecordUpdateEvent) error {
+			machines, err := getMachinesByGroup(s.PB, e.Record)
 			if err != nil {
-				slog.Error("failed to get principals", "err", err)
+				return err
 			}
-
-			reply := &agentv1.StreamResponse{Principals: principals}
-			if err := client.Stream.Send(reply); err != nil {
-				slog.Error("updating agent error", "err", err)
+			for _, machine := range machines {
+				s.pushMachine(machine)
 			}
 			return nil
 		})
@@ -118,9 +210,13 @@ func (s *AgentServer) pbHook() {
 				if err != nil {
 					return fmt.Errorf("failed to get machine users: %v", err)
 				}
+				keys, err := getAuthorizedKeys(s.PB, machine)
+				if err != nil {
+					return fmt.Errorf("failed to get authorized keys: %v", err)
+				}
 
 				client := s.Clients[machine.Id]
-				reply := &agentv1.StreamResponse{Principals: principals}
+				reply := &agentv1.StreamResponse{Principals: principals, AuthorizedKeys: keys}
 				if err := client.Stream.Send(reply); err != nil {
 					slog.Error("updating agent error", "err", err)
 				}
@@ -153,13 +249,50 @@ func (s *AgentServer) pbHook() {
 			if err != nil {
 				return fmt.Errorf("failed to get machine users: %v", err)
 			}
+			keys, err := getAuthorizedKeys(s.PB, machine)
+			if err != nil {
+				return fmt.Errorf("failed to get authorized keys: %v", err)
+			}
 
 			client := s.Clients[machine.Id]
-			reply := &agentv1.StreamResponse{Principals: principals}
+			reply := &agentv1.StreamResponse{Principals: principals, AuthorizedKeys: keys}
 			if err := client.Stream.Send(reply); err != nil {
 				slog.Error("updating agent error", "err", err)
 			}
 		}
 		return nil
 	})
+
+	// Push the plain public keys of a user to all connected machines
+	updateKeys := func(record *models.Record) error {
+		user, err := s.PB.Dao().FindRecordById("users", record.GetString("user"))
+		if err != nil {
+			return err
+		}
+		machines, err := getUserMachines(s.PB, user)
+		if err != nil {
+			return err
+		}
+		for _, machine := range machines {
+			client, ok := s.Clients[machine.Id]
+			if !ok {
+				continue
+			}
+			keys, err := getAuthorizedKeys(s.PB, machine)
+			if err != nil {
+				slog.Error("failed to get authorized keys", "err", err)
+				continue
+			}
+			if err := client.Stream.Send(&agentv1.StreamResponse{AuthorizedKeys: keys}); err != nil {
+				slog.Error("updating agent error", "err", err)
+			}
+		}
+		return nil
+	}
+	s.PB.OnRecordAfterCreateRequest("public_keys").
+		Add(func(e *core.RecordCreateEvent) error { return updateKeys(e.Record) })
+	s.PB.OnRecordAfterUpdateRequest("public_keys").
+		Add(func(e *core.RecordUpdateEvent) error { return updateKeys(e.Record) })
+	s.PB.OnRecordAfterDeleteRequest("public_keys").
+		Add(func(e *core.RecordDeleteEvent) error { return updateKeys(e.Record) })
 }
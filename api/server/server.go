@@ -14,6 +14,7 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"connectrpc.com/connect"
@@ -34,6 +35,9 @@ type AgentServer struct {
 	Clients map[string]Client
 }
 
+// agents is the running agent server, nil if it isn't started
+var agents atomic.Pointer[AgentServer]
+
 type Client struct {
 	Machine *models.Record
 	Stream  *connect.BidiStream[agentv1.StreamRequest, agentv1.StreamResponse]
@@ -159,6 +163,7 @@ func Server(app core.App) {
 		PB:      app,
 		Clients: make(map[string]Client),
 	}
+	agents.Store(agentServer)
 
 	settings, err := app.Dao().FindSettings(os.Getenv("PB_ENCRYPTION_KEY"))
 	if err != nil {
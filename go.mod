@@ -9,6 +9,7 @@ require (
 	github.com/aws/aws-sdk-go v1.55.5
 	github.com/brianvoe/gofakeit/v7 v7.0.3
 	github.com/caarlos0/env/v11 v11.2.2
+	github.com/digitalocean/go-libvirt v0.0.0-20240812180835-9c6c0a310c6c
 	github.com/google/uuid v1.6.0
 	github.com/hetznercloud/hcloud-go/v2 v2.13.1
 	github.com/labstack/echo/v5 v5.0.0-20230722203903-ec5b858dab61
@@ -25,6 +26,7 @@ require (
 	golang.org/x/oauth2 v0.23.0
 	golang.org/x/text v0.19.0
 	google.golang.org/protobuf v1.35.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -2,6 +2,7 @@
 set -eu
 
 REPO="https://api.github.com/repos/mizuchilabs/ssh-nexus/releases"
+BACKUP="$HOME/.local/share/ssh-nexus/backup"
 
 # Downloads the latest release and moves it into ~/.local/bin
 main() {
@@ -90,18 +91,47 @@ uninstall() {
 	bin_path="$HOME/.local/bin/$binary"
 	if [ -f "$bin_path" ]; then
 		echo "Uninstalling $binary..."
-		rm -f "$bin_path"
-		echo "$binary has been removed from $HOME/.local/bin."
+		restore "$bin_path"
 	else
 		echo "$binary is not installed."
 	fi
 }
 
+# Saves a file before it is overwritten for the first time
+backup() {
+	target="$1"
+	saved="$BACKUP/$(basename "$target")"
+	if [ -e "$saved" ] || [ -e "$saved.absent" ]; then
+		return
+	fi
+
+	mkdir -p "$BACKUP"
+	if [ -e "$target" ]; then
+		cp -p "$target" "$saved"
+	else
+		touch "$saved.absent"
+	fi
+}
+
+# Puts back the original file and reports what was done
+restore() {
+	target="$1"
+	saved="$BACKUP/$(basename "$target")"
+	if [ -e "$saved" ]; then
+		mv "$saved" "$target"
+		echo "restored: $target"
+	else
+		rm -f "$target" "$saved.absent"
+		echo "removed: $target"
+	fi
+}
+
 linux() {
 	# Setup ~/.local directories
 	mkdir -p "$HOME/.local/bin"
 
 	# Move the binary
+	backup "$HOME/.local/bin/$binary"
 	mv "$temp" "$HOME/.local/bin/$binary"
 
 	# Make it executable
@@ -113,6 +143,7 @@ macos() {
 	mkdir -p "$HOME/.local/bin"
 
 	# Move the binary
+	backup "$HOME/.local/bin/$binary"
 	mv "$temp" "$HOME/.local/bin/$binary"
 
 	# Make it executable
@@ -51,6 +51,7 @@ type Config struct {
 	MaxLease         string `env:"MAX_LEASE"         envDefault:"7776000"`
 	SSHConfig        string `env:"SSH_CONFIG"        envDefault:""`
 	InstallAgent     string `env:"INSTALL_AGENT"     envDefault:"true"`
+	AccountPolicy    string `env:"ACCOUNT_POLICY"    envDefault:"keep"`
 }
 
 // GetConfig returns the config used by the settings collection
@@ -179,6 +180,7 @@ AuthorizedPrincipalsFile /etc/ssh/nexus_principals/%u`
 		"host_lease":        config.HostLease,
 		"max_lease":         config.MaxLease,
 		"install_agent":     config.InstallAgent,
+		"account_policy":    config.AccountPolicy,
 		"ssh_config":        config.SSHConfig,
 	}
 	for k, v := range baseSettings {
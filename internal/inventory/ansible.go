@@ -0,0 +1,385 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Host variables read from Ansible inventories, nexus_tags and nexus_groups
+// hold lists for the nexus tags and groups of a host
+var (
+	ansibleHostVars  = []string{"ansible_host", "ansible_ssh_host"}
+	ansiblePortVars  = []string{"ansible_port", "ansible_ssh_port"}
+	ansibleUserVars  = []string{"ansible_user", "ansible_ssh_user"}
+	ansibleTagsVar   = "nexus_tags"
+	ansibleGroupsVar = "nexus_groups"
+)
+
+// ansibleInventory is the common model of INI and YAML inventories
+type ansibleInventory struct {
+	hosts  map[string]map[string]string
+	order  []string
+	groups map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	hosts    []string
+	vars     map[string]string
+	children []string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		hosts:  make(map[string]map[string]string),
+		groups: make(map[string]*ansibleGroup),
+	}
+}
+
+func (inv *ansibleInventory) group(name string) *ansibleGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &ansibleGroup{vars: make(map[string]string)}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *ansibleInventory) addHost(group, name string, vars map[string]string) {
+	if _, ok := inv.hosts[name]; !ok {
+		inv.hosts[name] = make(map[string]string)
+		inv.order = append(inv.order, name)
+	}
+	for key, value := range vars {
+		inv.hosts[name][key] = value
+	}
+	g := inv.group(group)
+	if !slices.Contains(g.hosts, name) {
+		g.hosts = append(g.hosts, name)
+	}
+}
+
+// parents returns the groups a group is a child of, recursively
+func (inv *ansibleInventory) parents(name string, seen map[string]bool) []string {
+	var result []string
+	for parent, g := range inv.groups {
+		if seen[parent] || !slices.Contains(g.children, name) {
+			continue
+		}
+		seen[parent] = true
+		result = append(result, parent)
+		result = append(result, inv.parents(parent, seen)...)
+	}
+	return result
+}
+
+// resolve turns the inventory into hosts, groups become tags and variables
+// of hosts win over those of their groups
+func (inv *ansibleInventory) resolve() ([]Host, error) {
+	var hosts []Host
+	for _, name := range inv.order {
+		var groups []string
+		for group, g := range inv.groups {
+			if slices.Contains(g.hosts, name) && !slices.Contains(groups, group) {
+				groups = append(groups, group)
+			}
+		}
+		slices.Sort(groups)
+		direct := len(groups)
+		for _, group := range groups[:direct] {
+			for _, parent := range inv.parents(group, map[string]bool{group: true}) {
+				if !slices.Contains(groups, parent) {
+					groups = append(groups, parent)
+				}
+			}
+		}
+		slices.Sort(groups[direct:])
+
+		lookup := func(keys []string) string {
+			for _, key := range keys {
+				if value, ok := inv.hosts[name][key]; ok {
+					return value
+				}
+			}
+			// Direct groups first, then their parents and finally all
+			for _, group := range append(groups, "all") {
+				g, ok := inv.groups[group]
+				if !ok {
+					continue
+				}
+				for _, key := range keys {
+					if value, ok := g.vars[key]; ok {
+						return value
+					}
+				}
+			}
+			return ""
+		}
+
+		port, err := parsePort(lookup(ansiblePortVars))
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", name, err)
+		}
+		address := lookup(ansibleHostVars)
+		if address == "" {
+			address = name
+		}
+
+		var tags []string
+		for _, group := range groups {
+			if group != "all" && group != "ungrouped" {
+				tags = append(tags, group)
+			}
+		}
+		hosts = append(hosts, Host{
+			Name:   name,
+			Host:   address,
+			Port:   port,
+			User:   lookup(ansibleUserVars),
+			Tags:   union(tags, splitList(lookup([]string{ansibleTagsVar}))),
+			Groups: splitList(lookup([]string{ansibleGroupsVar})),
+		})
+	}
+	return hosts, nil
+}
+
+// ParseAnsibleINI reads the hosts of an Ansible INI inventory
+func ParseAnsibleINI(r io.Reader) ([]Host, error) {
+	inv := newAnsibleInventory()
+	section, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, ";") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") {
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %q", line, text)
+			}
+			section, kind, _ = strings.Cut(strings.Trim(text, "[]"), ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+			inv.group(section)
+			continue
+		}
+
+		fields := splitINIFields(text)
+		switch kind {
+		case "hosts":
+			vars := make(map[string]string)
+			for _, field := range fields[1:] {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: invalid host variable %q", line, field)
+				}
+				vars[key] = value
+			}
+			names, err := expandRange(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			for _, name := range names {
+				inv.addHost(section, name, vars)
+			}
+		case "vars":
+			key, value, ok := strings.Cut(text, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid group variable %q", line, text)
+			}
+			inv.group(section).vars[strings.TrimSpace(key)] = unquote(strings.TrimSpace(value))
+		case "children":
+			g := inv.group(section)
+			g.children = append(g.children, fields[0])
+			inv.group(fields[0])
+		default:
+			return nil, fmt.Errorf("line %d: unknown section type %q", line, kind)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv.resolve()
+}
+
+// splitINIFields splits a host line on whitespace outside of quotes
+func splitINIFields(line string) []string {
+	var (
+		fields []string
+		field  strings.Builder
+		quote  rune
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '"' || r == '\''):
+			quote = r
+		case quote == 0 && (r == ' ' || r == '\t'):
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		case quote == 0 && r == '#':
+			// Comment at the end of the line
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+			}
+			return fields
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// Most hosts a single range may expand to
+const maxRange = 10000
+
+// expandRange expands host patterns like web[01:03] or db-[a:c]
+func expandRange(pattern string) ([]string, error) {
+	start := strings.Index(pattern, "[")
+	end := strings.Index(pattern, "]")
+	if start < 0 || end < start {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	parts := strings.Split(pattern[start+1:end], ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+	step := 1
+	if len(parts) == 3 {
+		var err error
+		if step, err = strconv.Atoi(parts[2]); err != nil || step < 1 {
+			return nil, fmt.Errorf("invalid step in host range %q", pattern)
+		}
+	}
+
+	var values []string
+	first, errFirst := strconv.Atoi(parts[0])
+	last, errLast := strconv.Atoi(parts[1])
+	switch {
+	case errFirst == nil && errLast == nil:
+		if (last-first)/step >= maxRange {
+			return nil, fmt.Errorf("host range %q is too large", pattern)
+		}
+		format := "%d"
+		if len(parts[0]) > 1 && strings.HasPrefix(parts[0], "0") {
+			format = fmt.Sprintf("%%0%dd", len(parts[0]))
+		}
+		for i := first; i <= last; i += step {
+			values = append(values, fmt.Sprintf(format, i))
+		}
+	case len(parts[0]) == 1 && len(parts[1]) == 1:
+		for c := parts[0][0]; c <= parts[1][0]; c += byte(step) {
+			values = append(values, string(c))
+		}
+	default:
+		return nil, fmt.Errorf("invalid host range %q", pattern)
+	}
+
+	var names []string
+	for _, value := range values {
+		rest, err := expandRange(suffix)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			names = append(names, prefix+value+r)
+		}
+	}
+	return names, nil
+}
+
+type yamlGroup struct {
+	Hosts    map[string]map[string]any `yaml:"hosts"`
+	Vars     map[string]any            `yaml:"vars"`
+	Children map[string]*yamlGroup     `yaml:"children"`
+}
+
+// ParseAnsibleYAML reads the hosts of an Ansible YAML inventory
+func ParseAnsibleYAML(r io.Reader) ([]Host, error) {
+	var groups map[string]*yamlGroup
+	if err := yaml.NewDecoder(r).Decode(&groups); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid inventory: %w", err)
+	}
+
+	inv := newAnsibleInventory()
+	var walk func(name string, group *yamlGroup, depth int) error
+	walk = func(name string, group *yamlGroup, depth int) error {
+		if depth > 32 {
+			return fmt.Errorf("groups are nested too deep at %s", name)
+		}
+		g := inv.group(name)
+		if group == nil {
+			return nil
+		}
+		for key, value := range group.Vars {
+			g.vars[key] = fmt.Sprint(value)
+		}
+
+		patterns := make([]string, 0, len(group.Hosts))
+		for pattern := range group.Hosts {
+			patterns = append(patterns, pattern)
+		}
+		slices.Sort(patterns)
+		for _, pattern := range patterns {
+			vars := make(map[string]string)
+			for key, value := range group.Hosts[pattern] {
+				vars[key] = fmt.Sprint(value)
+			}
+			hosts, err := expandRange(pattern)
+			if err != nil {
+				return err
+			}
+			for _, host := range hosts {
+				inv.addHost(name, host, vars)
+			}
+		}
+
+		childNames := make([]string, 0, len(group.Children))
+		for child := range group.Children {
+			childNames = append(childNames, child)
+		}
+		slices.Sort(childNames)
+		for _, child := range childNames {
+			if !slices.Contains(g.children, child) {
+				g.children = append(g.children, child)
+			}
+			if err := walk(child, group.Children[child], depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := walk(name, groups[name], 0); err != nil {
+			return nil, err
+		}
+	}
+	return inv.resolve()
+}
@@ -0,0 +1,70 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseCSV reads hosts from a CSV file with a header row. The columns are
+// name, host, port, user, tags and groups, only host is required and tags and
+// groups are lists separated by semicolons.
+func ParseCSV(r io.Reader) ([]Host, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["host"]; !ok {
+		return nil, fmt.Errorf("missing host column in header %q", strings.Join(header, ","))
+	}
+
+	var hosts []Host
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		h := Host{
+			Name:   get("name"),
+			Host:   get("host"),
+			User:   get("user"),
+			Tags:   splitList(get("tags")),
+			Groups: splitList(get("groups")),
+		}
+		if h.Host == "" {
+			return nil, fmt.Errorf("line %d: missing host", line)
+		}
+		if h.Name == "" {
+			h.Name = h.Host
+		}
+		if h.Port, err = parsePort(get("port")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,77 @@
+package inventory
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// AnsibleExport builds the JSON of an Ansible dynamic inventory
+type AnsibleExport struct {
+	groups   map[string][]string
+	hostvars map[string]map[string]any
+}
+
+func NewAnsibleExport() *AnsibleExport {
+	return &AnsibleExport{
+		groups:   make(map[string][]string),
+		hostvars: make(map[string]map[string]any),
+	}
+}
+
+// AnsibleGroupName turns a name into a valid Ansible group name like tag_web
+func AnsibleGroupName(prefix, name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_') {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, name)
+	return prefix + "_" + name
+}
+
+// AddHost adds a host to the given groups, hosts without groups end up in
+// ungrouped. Hosts are renamed with the suffix if the name is taken.
+func (e *AnsibleExport) AddHost(name, suffix string, vars map[string]any, groups ...string) string {
+	if _, ok := e.hostvars[name]; ok {
+		name = name + "-" + suffix
+	}
+	e.hostvars[name] = vars
+
+	if len(groups) == 0 {
+		groups = []string{"ungrouped"}
+	}
+	for _, group := range groups {
+		if !slices.Contains(e.groups[group], name) {
+			e.groups[group] = append(e.groups[group], name)
+		}
+	}
+	return name
+}
+
+func (e *AnsibleExport) MarshalJSON() ([]byte, error) {
+	type group struct {
+		Hosts    []string `json:"hosts,omitempty"`
+		Children []string `json:"children,omitempty"`
+	}
+	result := map[string]any{
+		"_meta": map[string]any{"hostvars": e.hostvars},
+	}
+
+	children := []string{"ungrouped"}
+	for name, hosts := range e.groups {
+		hosts = slices.Clone(hosts)
+		slices.Sort(hosts)
+		result[name] = group{Hosts: hosts}
+		if name != "ungrouped" {
+			children = append(children, name)
+		}
+	}
+	if _, ok := result["ungrouped"]; !ok {
+		result["ungrouped"] = group{}
+	}
+	slices.Sort(children)
+	result["all"] = group{Children: children}
+	return json.Marshal(result)
+}
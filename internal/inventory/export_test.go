@@ -0,0 +1,68 @@
+package inventory
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAnsibleGroupName(t *testing.T) {
+	tests := []struct {
+		prefix string
+		name   string
+		want   string
+	}{
+		{prefix: "tag", name: "web", want: "tag_web"},
+		{prefix: "group", name: "DB Admins", want: "group_db_admins"},
+		{prefix: "provider", name: "hetzner-fsn1.prod", want: "provider_hetzner_fsn1_prod"},
+		{prefix: "tag", name: "ümlaut", want: "tag__mlaut"},
+	}
+	for _, tt := range tests {
+		if got := AnsibleGroupName(tt.prefix, tt.name); got != tt.want {
+			t.Errorf("AnsibleGroupName(%q, %q) = %q, want %q", tt.prefix, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAnsibleExport(t *testing.T) {
+	export := NewAnsibleExport()
+	export.AddHost("web1", "a1", map[string]any{"ansible_host": "10.0.0.1"}, "tag_web")
+	export.AddHost("db1", "b2", map[string]any{"ansible_host": "10.0.0.2"})
+	if got := export.AddHost("web1", "c3", map[string]any{"ansible_host": "10.0.0.3"}, "tag_web"); got != "web1-c3" {
+		t.Errorf("AddHost() = %q for a taken name, want web1-c3", got)
+	}
+
+	raw, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Meta struct {
+			Hostvars map[string]map[string]any `json:"hostvars"`
+		} `json:"_meta"`
+		All struct {
+			Children []string `json:"children"`
+		} `json:"all"`
+		Ungrouped struct {
+			Hosts []string `json:"hosts"`
+		} `json:"ungrouped"`
+		Web struct {
+			Hosts []string `json:"hosts"`
+		} `json:"tag_web"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Meta.Hostvars) != 3 || got.Meta.Hostvars["web1-c3"]["ansible_host"] != "10.0.0.3" {
+		t.Errorf("hostvars = %v", got.Meta.Hostvars)
+	}
+	if len(got.All.Children) != 2 || got.All.Children[0] != "tag_web" || got.All.Children[1] != "ungrouped" {
+		t.Errorf("all children = %v, want [tag_web ungrouped]", got.All.Children)
+	}
+	if len(got.Ungrouped.Hosts) != 1 || got.Ungrouped.Hosts[0] != "db1" {
+		t.Errorf("ungrouped hosts = %v, want [db1]", got.Ungrouped.Hosts)
+	}
+	if len(got.Web.Hosts) != 2 {
+		t.Errorf("tag_web hosts = %v, want web1 and web1-c3", got.Web.Hosts)
+	}
+}
@@ -0,0 +1,151 @@
+// Package inventory reads and writes the machine inventories of other tools
+package inventory
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Supported inventory formats
+const (
+	FormatSSHConfig   = "ssh_config"
+	FormatAnsibleINI  = "ansible_ini"
+	FormatAnsibleYAML = "ansible_yaml"
+	FormatCSV         = "csv"
+)
+
+var Formats = []string{FormatSSHConfig, FormatAnsibleINI, FormatAnsibleYAML, FormatCSV}
+
+// Host is a machine found in an inventory
+type Host struct {
+	Name   string   `json:"name"`
+	Host   string   `json:"host"`
+	Port   int      `json:"port"`
+	User   string   `json:"user,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// Address returns host:port, used to find duplicates
+func (h Host) Address() string {
+	return net.JoinHostPort(strings.ToLower(h.Host), strconv.Itoa(h.Port))
+}
+
+// Parse reads all hosts of an inventory, duplicates are merged
+func Parse(format string, r io.Reader) ([]Host, error) {
+	var (
+		hosts []Host
+		err   error
+	)
+	switch format {
+	case FormatSSHConfig:
+		hosts, err = ParseSSHConfig(r)
+	case FormatAnsibleINI:
+		hosts, err = ParseAnsibleINI(r)
+	case FormatAnsibleYAML:
+		hosts, err = ParseAnsibleYAML(r)
+	case FormatCSV:
+		hosts, err = ParseCSV(r)
+	default:
+		return nil, fmt.Errorf("unknown inventory format %q, expected one of %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Dedupe(hosts), nil
+}
+
+// DetectFormat guesses the format of an inventory from its file name and
+// content
+func DetectFormat(name string, content []byte) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV
+	case ".yml", ".yaml":
+		return FormatAnsibleYAML
+	case ".ini":
+		return FormatAnsibleINI
+	}
+	if strings.EqualFold(filepath.Base(name), "config") {
+		return FormatSSHConfig
+	}
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		lower := strings.ToLower(string(line))
+		switch {
+		case line[0] == '[':
+			return FormatAnsibleINI
+		case strings.HasPrefix(lower, "host ") || strings.HasPrefix(lower, "host\t") ||
+			strings.HasPrefix(lower, "match "):
+			return FormatSSHConfig
+		case strings.HasPrefix(lower, "all:") || strings.HasPrefix(lower, "---"):
+			return FormatAnsibleYAML
+		case strings.HasPrefix(lower, "name,") || strings.Contains(lower, ",host"):
+			return FormatCSV
+		}
+		break
+	}
+	return FormatAnsibleINI
+}
+
+// Dedupe merges hosts with the same address, keeping the first name
+func Dedupe(hosts []Host) []Host {
+	var result []Host
+	index := make(map[string]int)
+	for _, h := range hosts {
+		i, ok := index[h.Address()]
+		if !ok {
+			index[h.Address()] = len(result)
+			result = append(result, h)
+			continue
+		}
+		existing := &result[i]
+		if existing.User == "" {
+			existing.User = h.User
+		}
+		existing.Tags = union(existing.Tags, h.Tags)
+		existing.Groups = union(existing.Groups, h.Groups)
+	}
+	return result
+}
+
+func union(a, b []string) []string {
+	for _, value := range b {
+		if !slices.Contains(a, value) {
+			a = append(a, value)
+		}
+	}
+	return a
+}
+
+// splitList splits lists like "web; db, prod"
+func splitList(value string) []string {
+	values := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+func parsePort(value string) (int, error) {
+	if value == "" {
+		return 22, nil
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", value)
+	}
+	return port, nil
+}
@@ -0,0 +1,174 @@
+package inventory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []Host
+		wantErr bool
+	}{
+		{
+			name:   "SSH config",
+			format: FormatSSHConfig,
+			input: `
+Host *
+    User ignored
+
+Host web1 web1-alias
+    HostName 10.0.0.1
+    Port=2222
+    User deploy
+
+# Same address, merged into web1
+Host web1-v2
+    Hostname 10.0.0.1
+    Port 2222
+
+Host db.example.com
+
+Match host foo
+    User bar
+`,
+			want: []Host{
+				{Name: "web1", Host: "10.0.0.1", Port: 2222, User: "deploy"},
+				{Name: "db.example.com", Host: "db.example.com", Port: 22},
+			},
+		},
+		{
+			name:   "Ansible INI",
+			format: FormatAnsibleINI,
+			input: `
+bastion.example.com
+
+[web]
+web[1:2].example.com ansible_user=deploy
+db1 ansible_host=10.0.0.5 ansible_port=2222 nexus_groups="dba;ops" # primary
+
+[prod:children]
+web
+
+[prod:vars]
+ansible_user=admin
+`,
+			want: []Host{
+				{Name: "bastion.example.com", Host: "bastion.example.com", Port: 22},
+				{
+					Name: "web1.example.com", Host: "web1.example.com", Port: 22, User: "deploy",
+					Tags: []string{"web", "prod"},
+				},
+				{
+					Name: "web2.example.com", Host: "web2.example.com", Port: 22, User: "deploy",
+					Tags: []string{"web", "prod"},
+				},
+				{
+					Name: "db1", Host: "10.0.0.5", Port: 2222, User: "admin",
+					Tags: []string{"web", "prod"}, Groups: []string{"dba", "ops"},
+				},
+			},
+		},
+		{
+			name:   "Ansible YAML",
+			format: FormatAnsibleYAML,
+			input: `
+all:
+  vars:
+    ansible_user: root
+  hosts:
+    lb.example.com:
+  children:
+    db:
+      vars:
+        nexus_tags: postgres
+      hosts:
+        db[01:02]:
+          ansible_host: 10.0.1.1
+          ansible_port: 2200
+`,
+			want: []Host{
+				{Name: "lb.example.com", Host: "lb.example.com", Port: 22, User: "root"},
+				{
+					Name: "db01", Host: "10.0.1.1", Port: 2200, User: "root",
+					Tags: []string{"db", "postgres"},
+				},
+			},
+		},
+		{
+			name:   "CSV",
+			format: FormatCSV,
+			input: `name,host,port,tags,groups
+web1,10.0.0.1,,web;prod,ops
+,10.0.0.2,2222,"web,staging",
+`,
+			want: []Host{
+				{
+					Name: "web1", Host: "10.0.0.1", Port: 22,
+					Tags: []string{"web", "prod"}, Groups: []string{"ops"},
+				},
+				{Name: "10.0.0.2", Host: "10.0.0.2", Port: 2222, Tags: []string{"web", "staging"}},
+			},
+		},
+		{
+			name:    "CSV without host",
+			format:  FormatCSV,
+			input:   "name,address\nweb1,10.0.0.1\n",
+			wantErr: true,
+		},
+		{
+			name:    "Invalid port",
+			format:  FormatAnsibleINI,
+			input:   "web1 ansible_port=99999\n",
+			wantErr: true,
+		},
+		{
+			name:    "Unknown format",
+			format:  "terraform",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Parse(tt.format, strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{name: "CSV extension", file: "hosts.csv", want: FormatCSV},
+		{name: "YAML extension", file: "inventory.yml", want: FormatAnsibleYAML},
+		{name: "SSH config file", file: "/home/user/.ssh/config", want: FormatSSHConfig},
+		{name: "SSH config content", content: "# hosts\nHost web\n  HostName 10.0.0.1\n", want: FormatSSHConfig},
+		{name: "INI content", content: "[web]\nweb1\n", want: FormatAnsibleINI},
+		{name: "YAML content", content: "all:\n  hosts:\n", want: FormatAnsibleYAML},
+		{name: "CSV content", content: "name,host,port\n", want: FormatCSV},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := DetectFormat(tt.file, []byte(tt.content)); got != tt.want {
+				t.Errorf("DetectFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
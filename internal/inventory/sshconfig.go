@@ -0,0 +1,95 @@
+package inventory
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseSSHConfig reads the hosts of an OpenSSH client config. Patterns,
+// Match blocks and Include directives are skipped.
+func ParseSSHConfig(r io.Reader) ([]Host, error) {
+	type block struct {
+		aliases  []string
+		hostname string
+		port     string
+		user     string
+	}
+	var (
+		blocks  []*block
+		current *block
+	)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		key, value := splitSSHConfigLine(scanner.Text())
+		if key == "" {
+			continue
+		}
+		switch key {
+		case "host":
+			current = &block{}
+			for _, alias := range strings.Fields(value) {
+				if !strings.ContainsAny(alias, "*?!") {
+					current.aliases = append(current.aliases, alias)
+				}
+			}
+			blocks = append(blocks, current)
+		case "match":
+			// Conditional blocks don't describe a host
+			current = nil
+		case "hostname":
+			if current != nil && current.hostname == "" {
+				current.hostname = value
+			}
+		case "port":
+			if current != nil && current.port == "" {
+				current.port = value
+			}
+		case "user":
+			if current != nil && current.user == "" {
+				current.user = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var hosts []Host
+	for _, b := range blocks {
+		port, err := parsePort(b.port)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %w", strings.Join(b.aliases, " "), err)
+		}
+		for _, alias := range b.aliases {
+			address := b.hostname
+			if address == "" {
+				address = alias
+			}
+			// %h is replaced with the alias by ssh
+			address = strings.ReplaceAll(address, "%h", alias)
+			hosts = append(hosts, Host{Name: alias, Host: address, Port: port, User: b.user})
+		}
+	}
+	return hosts, nil
+}
+
+// splitSSHConfigLine returns the lowercase keyword and the value of a line,
+// both "Key Value" and "Key=Value" are valid
+func splitSSHConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	return key, value
+}
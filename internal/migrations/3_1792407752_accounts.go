@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+// Migrations run in file name order and a plain unix time would sort before
+// 1_collections. New migrations are named 3_<unix time>_<name> so they run
+// after the baseline ones and in the order they were written.
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Account settings used to create the linux user of a group
+		groups, err := dao.FindCollectionByNameOrId("groups")
+		if err != nil {
+			return err
+		}
+		groups.Schema.AddField(&schema.SchemaField{
+			Name:     "shell",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+		groups.Schema.AddField(&schema.SchemaField{
+			Name:     "home",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+		groups.Schema.AddField(&schema.SchemaField{
+			Name:     "supplementary_groups",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+		groups.Schema.AddField(&schema.SchemaField{
+			Name:     "sudoers",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+
+		return dao.SaveCollection(groups)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		groups, _ := dao.FindCollectionByNameOrId("groups")
+		if groups != nil {
+			removeFields(groups, "shell", "home", "supplementary_groups", "sudoers")
+			return dao.SaveCollection(groups)
+		}
+
+		return nil
+	})
+}
+
+// removeFields drops schema fields by name if they exist
+func removeFields(collection *models.Collection, names ...string) {
+	for _, name := range names {
+		if field := collection.Schema.GetFieldByName(name); field != nil {
+			collection.Schema.RemoveField(field.Id)
+		}
+	}
+}
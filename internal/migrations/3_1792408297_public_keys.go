@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		users, err := dao.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// Plain public keys for accounts which can't use certificates
+		publicKeys := &models.Collection{
+			Name: "public_keys",
+			Type: models.CollectionTypeBase,
+		}
+		if err := dao.SaveCollection(publicKeys); err != nil {
+			return err
+		}
+
+		ownerRule := "@request.auth.id = user || " +
+			"@request.auth.permission.is_admin = true || " +
+			"@request.auth.permission.access_users = true"
+		return initCollection(
+			dao,
+			"public_keys",
+			ownerRule, // List Rule
+			ownerRule, // View Rule
+			"@request.auth.id = @request.data.user || "+
+				"@request.auth.permission.is_admin = true || "+
+				"@request.auth.permission.access_users = true", // Create Rule
+			ownerRule+" && (@request.data.user:isset = false || @request.data.user = user)", // Update Rule
+			ownerRule, // Delete Rule
+			types.JsonArray[string]{
+				"CREATE INDEX idx_public_keys_user ON public_keys (user)",
+			},
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					CollectionId:  users.Id,
+					MaxSelect:     types.Pointer(1),
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "name",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "key",
+				Type:     schema.FieldTypeText,
+				Required: true,
+			},
+			&schema.SchemaField{
+				Name:     "from",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "command",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+		)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		publicKeys, _ := dao.FindCollectionByNameOrId("public_keys")
+		if publicKeys != nil {
+			return dao.DeleteCollection(publicKeys)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,131 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		users, err := dao.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+
+		// Logins reported by the agents
+		sessions := &models.Collection{
+			Name: "sessions",
+			Type: models.CollectionTypeBase,
+		}
+		if err := dao.SaveCollection(sessions); err != nil {
+			return err
+		}
+
+		viewRule := "@request.auth.id = user || " +
+			"@request.auth.permission.is_admin = true || " +
+			"@request.auth.permission.access_users = true"
+		return initCollection(
+			dao,
+			"sessions",
+			viewRule, // List Rule
+			viewRule, // View Rule
+			"@request.auth.permission.is_admin = true", // Create Rule
+			"@request.auth.permission.is_admin = true", // Update Rule
+			"@request.auth.permission.is_admin = true", // Delete Rule
+			types.JsonArray[string]{
+				"CREATE INDEX idx_sessions_machine ON sessions (machine)",
+				"CREATE INDEX idx_sessions_user ON sessions (user)",
+				"CREATE INDEX idx_sessions_time ON sessions (time)",
+			},
+			&schema.SchemaField{
+				Name:     "machine",
+				Type:     schema.FieldTypeRelation,
+				Required: true,
+				Options: &schema.RelationOptions{
+					CollectionId:  machines.Id,
+					MaxSelect:     types.Pointer(1),
+					CascadeDelete: true,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					CollectionId:  users.Id,
+					MaxSelect:     types.Pointer(1),
+					CascadeDelete: false,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "linux_username",
+				Type:     schema.FieldTypeText,
+				Required: true,
+			},
+			&schema.SchemaField{
+				Name:     "accepted",
+				Type:     schema.FieldTypeBool,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "method",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "address",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "port",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "key_type",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "fingerprint",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "key_id",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "serial",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "time",
+				Type:     schema.FieldTypeDate,
+				Required: true,
+			},
+		)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		sessions, _ := dao.FindCollectionByNameOrId("sessions")
+		if sessions != nil {
+			return dao.DeleteCollection(sessions)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Pinned host key for connections from the server
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "host_key",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+
+		return dao.SaveCollection(machines)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		machines, _ := dao.FindCollectionByNameOrId("machines")
+		if machines != nil {
+			removeFields(machines, "host_key")
+			return dao.SaveCollection(machines)
+		}
+
+		return nil
+	})
+}
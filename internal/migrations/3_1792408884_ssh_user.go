@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Login user and privilege escalation for connections from the
+		// server, providers hold the defaults for their machines
+		for _, name := range []string{"machines", "providers"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:     "ssh_user",
+				Type:     schema.FieldTypeText,
+				Required: false,
+				Options: &schema.TextOptions{
+					Pattern: `^[a-z_][a-z0-9_-]{0,31}$`,
+				},
+			})
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:     "become",
+				Type:     schema.FieldTypeSelect,
+				Required: false,
+				Options: &schema.SelectOptions{
+					MaxSelect: 1,
+					Values:    []string{"none", "sudo", "doas"},
+				},
+			})
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		for _, name := range []string{"machines", "providers"} {
+			collection, _ := dao.FindCollectionByNameOrId(name)
+			if collection == nil {
+				continue
+			}
+			removeFields(collection, "ssh_user", "become")
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+
+		// Jump host for machines in private networks, either another
+		// machine or an explicit [user@]host[:port] with its pinned key
+		for _, name := range []string{"machines", "tags", "providers"} {
+			collection, err := dao.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:     "jump_host",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					CollectionId:  machines.Id,
+					MaxSelect:     types.Pointer(1),
+					CascadeDelete: false,
+				},
+			})
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:     "jump_address",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			})
+			collection.Schema.AddField(&schema.SchemaField{
+				Name:     "jump_host_key",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			})
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		for _, name := range []string{"machines", "tags", "providers"} {
+			collection, _ := dao.FindCollectionByNameOrId(name)
+			if collection == nil {
+				continue
+			}
+			removeFields(collection, "jump_host", "jump_address", "jump_host_key")
+			if err := dao.SaveCollection(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
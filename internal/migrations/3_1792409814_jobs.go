@@ -0,0 +1,116 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		users, err := dao.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// Background tasks with their progress and results per target
+		jobs := &models.Collection{
+			Name: "jobs",
+			Type: models.CollectionTypeBase,
+		}
+		if err := dao.SaveCollection(jobs); err != nil {
+			return err
+		}
+
+		viewRule := "@request.auth.id = user || @request.auth.permission.is_admin = true"
+		return initCollection(
+			dao,
+			"jobs",
+			viewRule, // List Rule
+			viewRule, // View Rule
+			"@request.auth.permission.is_admin = true", // Create Rule
+			"@request.auth.permission.is_admin = true", // Update Rule
+			"@request.auth.permission.is_admin = true", // Delete Rule
+			types.JsonArray[string]{
+				"CREATE INDEX idx_jobs_status ON jobs (status)",
+				"CREATE INDEX idx_jobs_created ON jobs (created)",
+			},
+			&schema.SchemaField{
+				Name:     "kind",
+				Type:     schema.FieldTypeText,
+				Required: true,
+			},
+			&schema.SchemaField{
+				Name:     "user",
+				Type:     schema.FieldTypeRelation,
+				Required: false,
+				Options: &schema.RelationOptions{
+					CollectionId:  users.Id,
+					MaxSelect:     types.Pointer(1),
+					CascadeDelete: false,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "status",
+				Type:     schema.FieldTypeSelect,
+				Required: true,
+				Options: &schema.SelectOptions{
+					MaxSelect: 1,
+					Values:    []string{"queued", "running", "succeeded", "failed", "canceled"},
+				},
+			},
+			&schema.SchemaField{
+				Name:     "total",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "done",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "failed",
+				Type:     schema.FieldTypeNumber,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "results",
+				Type:     schema.FieldTypeJson,
+				Required: false,
+				Options: &schema.JsonOptions{
+					MaxSize: 2000000,
+				},
+			},
+			&schema.SchemaField{
+				Name:     "error",
+				Type:     schema.FieldTypeText,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "started",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+			},
+			&schema.SchemaField{
+				Name:     "finished",
+				Type:     schema.FieldTypeDate,
+				Required: false,
+			},
+		)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		jobs, _ := dao.FindCollectionByNameOrId("jobs")
+		if jobs != nil {
+			return dao.DeleteCollection(jobs)
+		}
+
+		return nil
+	})
+}
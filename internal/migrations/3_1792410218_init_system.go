@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Init system the agent was installed with
+		collection, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		collection.Schema.AddField(&schema.SchemaField{
+			Name:     "init_system",
+			Type:     schema.FieldTypeSelect,
+			Required: false,
+			Options: &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    []string{"systemd", "openrc", "sysvinit", "runit"},
+			},
+		})
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, _ := dao.FindCollectionByNameOrId("machines")
+		if collection == nil {
+			return nil
+		}
+		removeFields(collection, "init_system")
+		return dao.SaveCollection(collection)
+	})
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"slices"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const externalIDIndex = "CREATE UNIQUE INDEX idx_machines_provider_external ON machines(provider,external_id) WHERE external_id != ''"
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Provider machines are matched on the id of the instance
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "external_id",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "running",
+			Type:     schema.FieldTypeBool,
+			Required: false,
+		})
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "stale_since",
+			Type:     schema.FieldTypeDate,
+			Required: false,
+		})
+		machines.Indexes = append(machines.Indexes, externalIDIndex)
+		if err := dao.SaveCollection(machines); err != nil {
+			return err
+		}
+
+		// What happens to machines which vanished from the provider
+		providers, err := dao.FindCollectionByNameOrId("providers")
+		if err != nil {
+			return err
+		}
+		providers.Schema.AddField(&schema.SchemaField{
+			Name:     "stale_grace",
+			Type:     schema.FieldTypeNumber,
+			Required: false,
+			Options: &schema.NumberOptions{
+				Min:       types.Pointer[float64](0),
+				NoDecimal: true,
+			},
+		})
+		providers.Schema.AddField(&schema.SchemaField{
+			Name:     "stale_action",
+			Type:     schema.FieldTypeSelect,
+			Required: false,
+			Options: &schema.SelectOptions{
+				MaxSelect: 1,
+				Values:    []string{"keep", "delete"},
+			},
+		})
+		providers.Schema.AddField(&schema.SchemaField{
+			Name:     "sync_summary",
+			Type:     schema.FieldTypeJson,
+			Required: false,
+			Options:  &schema.JsonOptions{MaxSize: 2000000},
+		})
+		return dao.SaveCollection(providers)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		if machines, _ := dao.FindCollectionByNameOrId("machines"); machines != nil {
+			machines.Indexes = slices.DeleteFunc(machines.Indexes, func(index string) bool {
+				return index == externalIDIndex
+			})
+			removeFields(machines, "external_id", "running", "stale_since")
+			if err := dao.SaveCollection(machines); err != nil {
+				return err
+			}
+		}
+		if providers, _ := dao.FindCollectionByNameOrId("providers"); providers != nil {
+			removeFields(providers, "stale_grace", "stale_action", "sync_summary")
+			return dao.SaveCollection(providers)
+		}
+		return nil
+	})
+}
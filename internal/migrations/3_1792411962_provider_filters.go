@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Which machines of a provider are managed
+		collection, err := dao.FindCollectionByNameOrId("providers")
+		if err != nil {
+			return err
+		}
+		collection.Schema.AddField(&schema.SchemaField{
+			Name:     "filters",
+			Type:     schema.FieldTypeJson,
+			Required: false,
+			Options:  &schema.JsonOptions{MaxSize: 2000000},
+		})
+		return dao.SaveCollection(collection)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		collection, _ := dao.FindCollectionByNameOrId("providers")
+		if collection == nil {
+			return nil
+		}
+		removeFields(collection, "filters")
+		return dao.SaveCollection(collection)
+	})
+}
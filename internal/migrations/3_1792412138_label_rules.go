@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Rules turning cloud labels into tags and groups
+		providers, err := dao.FindCollectionByNameOrId("providers")
+		if err != nil {
+			return err
+		}
+		providers.Schema.AddField(&schema.SchemaField{
+			Name:     "label_rules",
+			Type:     schema.FieldTypeJson,
+			Required: false,
+			Options:  &schema.JsonOptions{MaxSize: 2000000},
+		})
+		if err := dao.SaveCollection(providers); err != nil {
+			return err
+		}
+
+		// Tags and groups assigned by the rules, replaced on every sync
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "rule_assignments",
+			Type:     schema.FieldTypeJson,
+			Required: false,
+			Options:  &schema.JsonOptions{MaxSize: 2000000},
+		})
+		return dao.SaveCollection(machines)
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		if providers, _ := dao.FindCollectionByNameOrId("providers"); providers != nil {
+			removeFields(providers, "label_rules")
+			if err := dao.SaveCollection(providers); err != nil {
+				return err
+			}
+		}
+		if machines, _ := dao.FindCollectionByNameOrId("machines"); machines != nil {
+			removeFields(machines, "rule_assignments")
+			return dao.SaveCollection(machines)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/daos"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+func init() {
+	m.Register(func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		// Machines in a region which failed to sync aren't marked stale
+		machines, err := dao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		machines.Schema.AddField(&schema.SchemaField{
+			Name:     "region",
+			Type:     schema.FieldTypeText,
+			Required: false,
+		})
+		if err := dao.SaveCollection(machines); err != nil {
+			return err
+		}
+
+		// Proxmox certificates used to be trusted blindly, keep it that way
+		// for existing providers until they configure a CA or fingerprint
+		providers, err := dao.FindRecordsByFilter("providers", "type = 'proxmox'", "", 0, 0)
+		if err != nil {
+			return err
+		}
+		for _, p := range providers {
+			options := map[string]any{}
+			if raw := strings.TrimSpace(p.GetString("options")); raw != "" && raw != "null" {
+				if err := json.Unmarshal([]byte(raw), &options); err != nil {
+					continue
+				}
+			}
+			if _, ok := options["insecure"]; ok {
+				continue
+			}
+			options["insecure"] = true
+			p.Set("options", options)
+			if err := dao.SaveRecord(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(db dbx.Builder) error {
+		dao := daos.New(db)
+
+		machines, _ := dao.FindCollectionByNameOrId("machines")
+		if machines == nil {
+			return nil
+		}
+		removeFields(machines, "region")
+		return dao.SaveCollection(machines)
+	})
+}
@@ -1,54 +1,177 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/pocketbase/pocketbase/models"
 )
 
-// AWSProvider represents a provider implementation for AWS
+// Address preferences only AWS knows
+const (
+	AddressPublicDNS  = "public_dns"
+	AddressPrivateDNS = "private_dns"
+)
+
+// awsDefaultRegion is used if neither the provider nor the environment has
+// a region
+const awsDefaultRegion = "us-east-1"
+
+// AWSProvider represents a provider implementation for AWS, the username is
+// the access key id, the password the secret and the token an optional
+// session token. The url replaces the endpoint of every API it calls, EC2 in
+// all regions and STS for the role, so it has to serve both like LocalStack.
 type AWSProvider struct {
 	Config *models.Record
 }
 
+// AWSOptions are the options of an AWS provider
+type AWSOptions struct {
+	// Regions to search, "all" for every enabled region
+	Regions []string `json:"regions"`
+	// RoleARN is assumed with the static keys if set
+	RoleARN    string `json:"role_arn"`
+	ExternalID string `json:"external_id"`
+	// Address is public, private, public_dns or private_dns
+	Address string `json:"address"`
+}
+
 func NewAWSProvider(config *models.Record) *AWSProvider {
 	return &AWSProvider{Config: config}
 }
 
-func (p *AWSProvider) Sync() ([]ProviderMachine, error) {
-	sess, err := session.NewSession(&aws.Config{
+func (p *AWSProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+	var opts AWSOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+
+	config := &aws.Config{
+		Region: aws.String(awsRegion()),
 		Credentials: credentials.NewStaticCredentials(
 			p.Config.GetString("username"),
 			p.Config.GetString("password"),
 			p.Config.GetString("token"),
 		),
-	})
+	}
+	if endpoint := p.Config.GetString("url"); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+	sess, err := session.NewSession(config)
 	if err != nil {
 		return nil, err
 	}
+	if opts.RoleARN != "" {
+		config.Credentials = stscreds.NewCredentials(sess, opts.RoleARN, func(r *stscreds.AssumeRoleProvider) {
+			r.RoleSessionName = "ssh-nexus"
+			if opts.ExternalID != "" {
+				r.ExternalID = aws.String(opts.ExternalID)
+			}
+		})
+		if sess, err = session.NewSession(config); err != nil {
+			return nil, err
+		}
+	}
 
-	svc := ec2.New(sess)
-	instances, err := svc.DescribeInstances(nil)
-	if err != nil {
-		return nil, err
+	regions := opts.Regions
+	if len(regions) == 0 {
+		regions = []string{aws.StringValue(config.Region)}
+	} else if slices.Contains(regions, "all") {
+		result, err := ec2.New(sess).DescribeRegionsWithContext(ctx, &ec2.DescribeRegionsInput{})
+		if err != nil {
+			return nil, err
+		}
+		regions = nil
+		for _, region := range result.Regions {
+			regions = append(regions, aws.StringValue(region.RegionName))
+		}
 	}
 
+	// A region which fails, e.g. one that isn't enabled for the account,
+	// only fails its own machines
+	regionErrors := make(RegionErrors)
 	var machines []ProviderMachine
-	for _, reservation := range instances.Reservations {
-		for _, instance := range reservation.Instances {
-			if instance.PublicIpAddress != nil && instance.InstanceId != nil {
-				machine := ProviderMachine{
-					ID:      *instance.InstanceId,
-					Host:    *instance.PublicIpAddress,
-					Name:    *instance.InstanceId,
-					Running: *instance.State.Name == "running",
+	for _, region := range regions {
+		svc := ec2.New(sess, aws.NewConfig().WithRegion(region))
+		err := svc.DescribeInstancesPagesWithContext(
+			ctx,
+			&ec2.DescribeInstancesInput{},
+			func(page *ec2.DescribeInstancesOutput, _ bool) bool {
+				for _, reservation := range page.Reservations {
+					for _, instance := range reservation.Instances {
+						machines = append(machines, awsMachine(instance, region, opts.Address))
+					}
 				}
-				machines = append(machines, machine)
-			}
+				return true
+			},
+		)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			regionErrors[region] = err
 		}
 	}
 
+	// Rather the credentials than every single region
+	if len(regionErrors) == len(regions) {
+		return nil, fmt.Errorf("all regions failed: %v", regionErrors)
+	}
+	if len(regionErrors) > 0 {
+		return machines, regionErrors
+	}
 	return machines, nil
 }
+
+// awsMachine names the machine after its Name tag
+func awsMachine(instance *ec2.Instance, region, address string) ProviderMachine {
+	id := aws.StringValue(instance.InstanceId)
+	labels := make(map[string]string, len(instance.Tags))
+	for _, tag := range instance.Tags {
+		labels[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	name := labels["Name"]
+	if name == "" {
+		name = id
+	}
+
+	var host string
+	switch address {
+	case AddressPublicDNS:
+		host = pickAddress(AddressPublic, aws.StringValue(instance.PublicDnsName), aws.StringValue(instance.PrivateDnsName))
+	case AddressPrivateDNS:
+		host = pickAddress(AddressPrivate, aws.StringValue(instance.PublicDnsName), aws.StringValue(instance.PrivateDnsName))
+	default:
+		host = pickAddress(address, aws.StringValue(instance.PublicIpAddress), aws.StringValue(instance.PrivateIpAddress))
+	}
+
+	var running bool
+	if instance.State != nil {
+		running = aws.StringValue(instance.State.Name) == ec2.InstanceStateNameRunning
+	}
+	return ProviderMachine{
+		ID:      id,
+		Name:    name,
+		Host:    host,
+		Running: running,
+		Region:  region,
+		Labels:  labels,
+	}
+}
+
+// awsRegion returns the region of the environment like the SDK does
+func awsRegion() string {
+	for _, key := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(key); region != "" {
+			return region
+		}
+	}
+	return awsDefaultRegion
+}
@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// awsCredential reads the access key and region of a signed request
+var awsCredential = regexp.MustCompile(`Credential=([^/]+)/\d+/([^/]+)/`)
+
+// awsStandIn serves the EC2 and STS query APIs, instances are only visible
+// to the static keys through the role
+func awsStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	instance := func(id, name, state, publicIP, privateIP string) string {
+		var public string
+		if publicIP != "" {
+			public = fmt.Sprintf(`<ipAddress>%s</ipAddress><dnsName>ec2-%s.compute.amazonaws.com</dnsName>`,
+				publicIP, strings.ReplaceAll(publicIP, ".", "-"))
+		}
+		var tags string
+		if name != "" {
+			tags = fmt.Sprintf(`<tagSet><item><key>Name</key><value>%s</value></item>`+
+				`<item><key>env</key><value>prod</value></item></tagSet>`, name)
+		}
+		return fmt.Sprintf(`<item><instanceId>%s</instanceId>`+
+			`<instanceState><code>0</code><name>%s</name></instanceState>`+
+			`<privateIpAddress>%s</privateIpAddress><privateDnsName>ip-%s.internal</privateDnsName>%s%s</item>`,
+			id, state, privateIP, strings.ReplaceAll(privateIP, ".", "-"), public, tags)
+	}
+	instances := map[string]string{
+		"eu-west-1": instance("i-1", "web", "running", "203.0.113.10", "10.0.0.10"),
+		"us-east-1": instance("i-2", "", "stopped", "", "10.1.0.20"),
+	}
+	// Opt-in regions which aren't enabled reject every request
+	disabled := "ap-east-1"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		match := awsCredential.FindStringSubmatch(r.Header.Get("Authorization"))
+		if match == nil {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		key, region := match[1], match[2]
+		fail := func(code string) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, `<Response><Errors><Error><Code>%s</Code><Message>%s</Message></Error></Errors></Response>`, code, code)
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		switch r.PostForm.Get("Action") {
+		case "AssumeRole":
+			if key != "AKIDSTATIC" || r.PostForm.Get("RoleArn") != "arn:aws:iam::1:role/nexus" {
+				fail("AccessDenied")
+				return
+			}
+			fmt.Fprint(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>`+
+				`<Credentials><AccessKeyId>AKIDROLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>`+
+				`<SessionToken>session</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration></Credentials>`+
+				`</AssumeRoleResult></AssumeRoleResponse>`)
+		case "DescribeRegions":
+			fmt.Fprint(w, `<DescribeRegionsResponse><regionInfo>`+
+				`<item><regionName>eu-west-1</regionName></item><item><regionName>us-east-1</regionName></item>`+
+				`</regionInfo></DescribeRegionsResponse>`)
+		case "DescribeInstances":
+			if key != "AKIDROLE" {
+				fail("UnauthorizedOperation")
+				return
+			}
+			if region == disabled {
+				fail("AuthFailure")
+				return
+			}
+			fmt.Fprintf(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet>%s</instancesSet></item>`+
+				`</reservationSet></DescribeInstancesResponse>`, instances[region])
+		default:
+			fail("InvalidAction")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAWSProviderSync(t *testing.T) {
+	server := awsStandIn(t)
+	role := "arn:aws:iam::1:role/nexus"
+	web := ProviderMachine{
+		ID:      "i-1",
+		Name:    "web",
+		Host:    "203.0.113.10",
+		Running: true,
+		Region:  "eu-west-1",
+		Labels:  map[string]string{"Name": "web", "env": "prod"},
+	}
+	db := ProviderMachine{ID: "i-2", Name: "i-2", Host: "10.1.0.20", Region: "us-east-1", Labels: map[string]string{}}
+
+	withHost := func(m ProviderMachine, host string) ProviderMachine {
+		m.Host = host
+		return m
+	}
+	tests := []struct {
+		name    string
+		options map[string]any
+		want    []ProviderMachine
+		wantErr bool
+		// failed are the regions of a partial result
+		failed []string
+	}{
+		{
+			name:    "All regions",
+			options: map[string]any{"regions": []string{"all"}, "role_arn": role},
+			want:    []ProviderMachine{web, db},
+		},
+		{
+			name:    "Private addresses",
+			options: map[string]any{"regions": []string{"eu-west-1"}, "role_arn": role, "address": AddressPrivate},
+			want:    []ProviderMachine{withHost(web, "10.0.0.10")},
+		},
+		{
+			name:    "Public DNS",
+			options: map[string]any{"regions": []string{"eu-west-1", "us-east-1"}, "role_arn": role, "address": AddressPublicDNS},
+			want: []ProviderMachine{
+				withHost(web, "ec2-203-0-113-10.compute.amazonaws.com"),
+				withHost(db, "ip-10-1-0-20.internal"),
+			},
+		},
+		{
+			name:    "Disabled region",
+			options: map[string]any{"regions": []string{"eu-west-1", "ap-east-1"}, "role_arn": role},
+			want:    []ProviderMachine{web},
+			wantErr: true,
+			failed:  []string{"ap-east-1"},
+		},
+		{
+			name:    "Static keys",
+			options: map[string]any{"regions": []string{"eu-west-1"}},
+			wantErr: true,
+		},
+		{
+			name:    "Unknown role",
+			options: map[string]any{"regions": []string{"eu-west-1"}, "role_arn": "arn:aws:iam::2:role/nexus"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":     "aws",
+				"url":      server.URL,
+				"username": "AKIDSTATIC",
+				"password": "static-secret",
+				"options":  tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.failed != nil {
+				var failed RegionErrors
+				if !errors.As(err, &failed) {
+					t.Fatalf("Sync() error = %T, want RegionErrors", err)
+				}
+				if regions := slices.Sorted(maps.Keys(failed)); !slices.Equal(regions, tt.failed) {
+					t.Errorf("failed regions = %v, want %v", regions, tt.failed)
+				}
+			}
+			slices.SortFunc(got, func(a, b ProviderMachine) int { return strings.Compare(a.ID, b.ID) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,279 @@
 package provider
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
 	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	azureManagementURL = "https://management.azure.com"
+	azureLoginURL      = "https://login.microsoftonline.com"
+	azureComputeAPI    = "2024-07-01"
+	azureNetworkAPI    = "2024-03-01"
+	azureResourcesAPI  = "2022-12-01"
 )
 
+// AzureProvider discovers virtual machines with a service principal, the
+// username is the client id and the password the client secret
 type AzureProvider struct {
 	Config *models.Record
 }
 
+// AzureOptions are the options of an Azure provider
+type AzureOptions struct {
+	Tenant string `json:"tenant"`
+	// Subscriptions to search, all visible subscriptions if empty
+	Subscriptions []string `json:"subscriptions"`
+	// ResourceGroups to search, all resource groups if empty
+	ResourceGroups []string `json:"resource_groups"`
+	// Address is either public or private, public by default
+	Address string `json:"address"`
+	// LoginURL overrides the Microsoft Entra endpoint
+	LoginURL string `json:"login_url"`
+}
+
 func NewAzureProvider(config *models.Record) *AzureProvider {
 	return &AzureProvider{Config: config}
 }
 
-func (p *AzureProvider) Sync() ([]ProviderMachine, error) {
-	// TODO: Implement
+type azureList[T any] struct {
+	Value    []T    `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+type azureVM struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Location   string            `json:"location"`
+	Tags       map[string]string `json:"tags"`
+	Properties struct {
+		VMID           string `json:"vmId"`
+		NetworkProfile struct {
+			NetworkInterfaces []struct {
+				ID         string `json:"id"`
+				Properties struct {
+					Primary bool `json:"primary"`
+				} `json:"properties"`
+			} `json:"networkInterfaces"`
+		} `json:"networkProfile"`
+		InstanceView struct {
+			Statuses []struct {
+				Code string `json:"code"`
+			} `json:"statuses"`
+		} `json:"instanceView"`
+	} `json:"properties"`
+}
+
+type azureNIC struct {
+	ID         string `json:"id"`
+	Properties struct {
+		IPConfigurations []struct {
+			Properties struct {
+				Primary          bool   `json:"primary"`
+				PrivateIPAddress string `json:"privateIPAddress"`
+				PublicIPAddress  *struct {
+					ID string `json:"id"`
+				} `json:"publicIPAddress"`
+			} `json:"properties"`
+		} `json:"ipConfigurations"`
+	} `json:"properties"`
+}
+
+type azurePublicIP struct {
+	ID         string `json:"id"`
+	Properties struct {
+		IPAddress string `json:"ipAddress"`
+	} `json:"properties"`
+}
+
+func (p *AzureProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts AzureOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Tenant == "" {
+		return nil, fmt.Errorf("please provide the tenant in the options")
+	}
+	loginURL := strings.TrimSuffix(opts.LoginURL, "/")
+	if loginURL == "" {
+		loginURL = azureLoginURL
+	}
+	baseURL := strings.TrimSuffix(p.Config.GetString("url"), "/")
+	if baseURL == "" {
+		baseURL = azureManagementURL
+	}
+
+	credentials := clientcredentials.Config{
+		ClientID:     p.Config.GetString("username"),
+		ClientSecret: p.Config.GetString("password"),
+		TokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", loginURL, url.PathEscape(opts.Tenant)),
+		Scopes:       []string{azureManagementURL + "/.default"},
+	}
+	client := credentials.Client(ctx)
+
+	subscriptions := opts.Subscriptions
+	if len(subscriptions) == 0 {
+		type subscription struct {
+			SubscriptionID string `json:"subscriptionId"`
+		}
+		subs, err := azureListAll[subscription](ctx, client,
+			fmt.Sprintf("%s/subscriptions?api-version=%s", baseURL, azureResourcesAPI))
+		if err != nil {
+			return nil, err
+		}
+		for _, sub := range subs {
+			subscriptions = append(subscriptions, sub.SubscriptionID)
+		}
+	}
 
 	var machines []ProviderMachine
+	for _, sub := range subscriptions {
+		found, err := p.syncSubscription(ctx, client, baseURL, sub, opts)
+		if err != nil {
+			return nil, fmt.Errorf("subscription %s: %w", sub, err)
+		}
+		machines = append(machines, found...)
+	}
+	return machines, nil
+}
+
+func (p *AzureProvider) syncSubscription(
+	ctx context.Context,
+	client *http.Client,
+	baseURL, sub string,
+	opts AzureOptions,
+) ([]ProviderMachine, error) {
+	subURL := fmt.Sprintf("%s/subscriptions/%s", baseURL, url.PathEscape(sub))
+
+	var vms []azureVM
+	if len(opts.ResourceGroups) == 0 {
+		all, err := azureListAll[azureVM](ctx, client, fmt.Sprintf(
+			"%s/providers/Microsoft.Compute/virtualMachines?api-version=%s&statusOnly=true",
+			subURL, azureComputeAPI,
+		))
+		if err != nil {
+			return nil, err
+		}
+		vms = all
+	}
+	for _, group := range opts.ResourceGroups {
+		found, err := azureListAll[azureVM](ctx, client, fmt.Sprintf(
+			"%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachines?api-version=%s&$expand=instanceView",
+			subURL, url.PathEscape(group), azureComputeAPI,
+		))
+		if err != nil {
+			return nil, err
+		}
+		vms = append(vms, found...)
+	}
+	if len(vms) == 0 {
+		return nil, nil
+	}
+
+	// Network interfaces and public IPs are listed once per subscription
+	nics, err := azureListAll[azureNIC](ctx, client, fmt.Sprintf(
+		"%s/providers/Microsoft.Network/networkInterfaces?api-version=%s", subURL, azureNetworkAPI,
+	))
+	if err != nil {
+		return nil, err
+	}
+	publicIPs, err := azureListAll[azurePublicIP](ctx, client, fmt.Sprintf(
+		"%s/providers/Microsoft.Network/publicIPAddresses?api-version=%s", subURL, azureNetworkAPI,
+	))
+	if err != nil {
+		return nil, err
+	}
+	nicByID := make(map[string]azureNIC, len(nics))
+	for _, nic := range nics {
+		nicByID[strings.ToLower(nic.ID)] = nic
+	}
+	ipByID := make(map[string]string, len(publicIPs))
+	for _, ip := range publicIPs {
+		ipByID[strings.ToLower(ip.ID)] = ip.Properties.IPAddress
+	}
 
+	machines := make([]ProviderMachine, 0, len(vms))
+	for _, vm := range vms {
+		public, private := azureAddresses(vm, nicByID, ipByID)
+		id := vm.Properties.VMID
+		if id == "" {
+			id = strings.ToLower(vm.ID)
+		}
+		machines = append(machines, ProviderMachine{
+			ID:      id,
+			Name:    vm.Name,
+			Host:    pickAddress(opts.Address, public, private),
+			Running: azurePowerState(vm) == "running",
+			Region:  vm.Location,
+			Labels:  vm.Tags,
+		})
+	}
 	return machines, nil
 }
+
+// azureAddresses returns the addresses of the primary ip configuration of
+// the primary network interface
+func azureAddresses(
+	vm azureVM,
+	nics map[string]azureNIC,
+	publicIPs map[string]string,
+) (public, private string) {
+	refs := vm.Properties.NetworkProfile.NetworkInterfaces
+	if len(refs) == 0 {
+		return "", ""
+	}
+	ref := refs[0]
+	for _, r := range refs {
+		if r.Properties.Primary {
+			ref = r
+			break
+		}
+	}
+	nic, ok := nics[strings.ToLower(ref.ID)]
+	if !ok || len(nic.Properties.IPConfigurations) == 0 {
+		return "", ""
+	}
+
+	config := nic.Properties.IPConfigurations[0].Properties
+	for _, c := range nic.Properties.IPConfigurations {
+		if c.Properties.Primary {
+			config = c.Properties
+			break
+		}
+	}
+	if config.PublicIPAddress != nil {
+		public = publicIPs[strings.ToLower(config.PublicIPAddress.ID)]
+	}
+	return public, config.PrivateIPAddress
+}
+
+// azurePowerState returns the power state like running or deallocated
+func azurePowerState(vm azureVM) string {
+	for _, status := range vm.Properties.InstanceView.Statuses {
+		if state, ok := strings.CutPrefix(status.Code, "PowerState/"); ok {
+			return state
+		}
+	}
+	return ""
+}
+
+// azureListAll follows the next links of an ARM list
+func azureListAll[T any](ctx context.Context, client *http.Client, url string) ([]T, error) {
+	var result []T
+	for url != "" {
+		var page azureList[T]
+		if err := getJSON(ctx, client, url, &page); err != nil {
+			return nil, err
+		}
+		result = append(result, page.Value...)
+		url = page.NextLink
+	}
+	return result, nil
+}
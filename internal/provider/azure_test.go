@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// azureStandIn serves a token endpoint and a subscription with two VMs
+func azureStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	const sub = "/subscriptions/sub-1"
+	nic := sub + "/resourceGroups/rg/providers/Microsoft.Network/networkInterfaces/"
+	pip := sub + "/resourceGroups/rg/providers/Microsoft.Network/publicIPAddresses/web-ip"
+
+	var server *httptest.Server
+	reply := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Error(err)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tenant-1/oauth2/v2.0/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+			if r.PostForm.Get("client_id") != "client" || r.PostForm.Get("client_secret") != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		reply(w, map[string]any{"access_token": "arm-token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer arm-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /subscriptions", authorized(func(w http.ResponseWriter, r *http.Request) {
+		reply(w, map[string]any{"value": []any{map[string]any{"subscriptionId": "sub-1"}}})
+	}))
+	mux.HandleFunc("GET "+sub+"/providers/Microsoft.Compute/virtualMachines",
+		authorized(func(w http.ResponseWriter, r *http.Request) {
+			vm := func(id, name, nic, state string) map[string]any {
+				return map[string]any{
+					"id":   sub + "/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/" + name,
+					"name": name,
+					"properties": map[string]any{
+						"vmId": id,
+						"networkProfile": map[string]any{"networkInterfaces": []any{
+							map[string]any{"id": nic, "properties": map[string]any{"primary": true}},
+						}},
+						"instanceView": map[string]any{"statuses": []any{
+							map[string]any{"code": "ProvisioningState/succeeded"},
+							map[string]any{"code": "PowerState/" + state},
+						}},
+					},
+				}
+			}
+			// The second VM is on the next page
+			if r.URL.Query().Get("page") == "" {
+				reply(w, map[string]any{
+					"value":    []any{vm("vm-1", "web", nic+"web-nic", "running")},
+					"nextLink": server.URL + r.URL.Path + "?page=2",
+				})
+				return
+			}
+			reply(w, map[string]any{"value": []any{vm("vm-2", "db", nic+"DB-NIC", "deallocated")}})
+		}))
+	mux.HandleFunc("GET "+sub+"/providers/Microsoft.Network/networkInterfaces",
+		authorized(func(w http.ResponseWriter, r *http.Request) {
+			ipConfig := func(private string, public any) map[string]any {
+				return map[string]any{"properties": map[string]any{
+					"primary":          true,
+					"privateIPAddress": private,
+					"publicIPAddress":  public,
+				}}
+			}
+			reply(w, map[string]any{"value": []any{
+				map[string]any{"id": nic + "web-nic", "properties": map[string]any{
+					"ipConfigurations": []any{ipConfig("10.0.0.4", map[string]any{"id": pip})},
+				}},
+				map[string]any{"id": nic + "db-nic", "properties": map[string]any{
+					"ipConfigurations": []any{ipConfig("10.0.0.5", nil)},
+				}},
+			}})
+		}))
+	mux.HandleFunc("GET "+sub+"/providers/Microsoft.Network/publicIPAddresses",
+		authorized(func(w http.ResponseWriter, r *http.Request) {
+			reply(w, map[string]any{"value": []any{
+				map[string]any{"id": pip, "properties": map[string]any{"ipAddress": "20.1.2.3"}},
+			}})
+		}))
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAzureProviderSync(t *testing.T) {
+	server := azureStandIn(t)
+
+	tests := []struct {
+		name    string
+		options map[string]any
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{
+			name:    "Public addresses",
+			options: map[string]any{"tenant": "tenant-1", "login_url": server.URL},
+			want: []ProviderMachine{
+				{ID: "vm-1", Name: "web", Host: "20.1.2.3", Running: true},
+				{ID: "vm-2", Name: "db", Host: "10.0.0.5"},
+			},
+		},
+		{
+			name: "Private addresses",
+			options: map[string]any{
+				"tenant":        "tenant-1",
+				"login_url":     server.URL,
+				"subscriptions": []string{"sub-1"},
+				"address":       AddressPrivate,
+			},
+			want: []ProviderMachine{
+				{ID: "vm-1", Name: "web", Host: "10.0.0.4", Running: true},
+				{ID: "vm-2", Name: "db", Host: "10.0.0.5"},
+			},
+		},
+		{
+			name:    "Unknown tenant",
+			options: map[string]any{"tenant": "tenant-2", "login_url": server.URL},
+			wantErr: true,
+		},
+		{
+			name:    "Missing tenant",
+			options: map[string]any{"login_url": server.URL},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":     "azure",
+				"url":      server.URL,
+				"username": "client",
+				"password": "secret",
+				"options":  tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+const digitalOceanURL = "https://api.digitalocean.com"
+
+// DigitalOceanProvider discovers droplets with an API token
+type DigitalOceanProvider struct {
+	Config *models.Record
+}
+
+// DigitalOceanOptions are the options of a DigitalOcean provider
+type DigitalOceanOptions struct {
+	// Address is either public or private, public by default
+	Address string `json:"address"`
+}
+
+func NewDigitalOceanProvider(config *models.Record) *DigitalOceanProvider {
+	return &DigitalOceanProvider{Config: config}
+}
+
+type digitalOceanDroplet struct {
+	ID     int64    `json:"id"`
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Tags   []string `json:"tags"`
+	Region struct {
+		Slug string `json:"slug"`
+	} `json:"region"`
+	Networks struct {
+		V4 []struct {
+			IPAddress string `json:"ip_address"`
+			Type      string `json:"type"`
+		} `json:"v4"`
+	} `json:"networks"`
+}
+
+func (p *DigitalOceanProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts DigitalOceanOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimSuffix(p.Config.GetString("url"), "/")
+	if baseURL == "" {
+		baseURL = digitalOceanURL
+	}
+	client := tokenClient("Authorization", "Bearer "+p.Config.GetString("token"))
+
+	var machines []ProviderMachine
+	next := baseURL + "/v2/droplets?per_page=200"
+	for next != "" {
+		var page struct {
+			Droplets []digitalOceanDroplet `json:"droplets"`
+			Links    struct {
+				Pages struct {
+					Next string `json:"next"`
+				} `json:"pages"`
+			} `json:"links"`
+		}
+		if err := getJSON(ctx, client, next, &page); err != nil {
+			return nil, err
+		}
+		for _, droplet := range page.Droplets {
+			var public, private string
+			for _, network := range droplet.Networks.V4 {
+				switch {
+				case network.Type == "public" && public == "":
+					public = network.IPAddress
+				case network.Type == "private" && private == "":
+					private = network.IPAddress
+				}
+			}
+			machines = append(machines, ProviderMachine{
+				ID:      strconv.FormatInt(droplet.ID, 10),
+				Name:    droplet.Name,
+				Host:    pickAddress(opts.Address, public, private),
+				Running: droplet.Status == "active",
+				Region:  droplet.Region.Slug,
+				Labels:  tagLabels(droplet.Tags),
+			})
+		}
+		next = page.Links.Pages.Next
+	}
+	return machines, nil
+}
@@ -0,0 +1,92 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDigitalOceanProviderSync(t *testing.T) {
+	droplet := func(id int, name, status, public, private string) map[string]any {
+		return map[string]any{
+			"id":     id,
+			"name":   name,
+			"status": status,
+			"networks": map[string]any{"v4": []any{
+				map[string]any{"ip_address": private, "type": "private"},
+				map[string]any{"ip_address": public, "type": "public"},
+			}},
+		}
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/droplets" || r.Header.Get("Authorization") != "Bearer do-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		page := map[string]any{"droplets": []any{droplet(1, "web", "active", "203.0.113.1", "10.10.0.1")}}
+		if r.URL.Query().Get("page") == "2" {
+			page = map[string]any{"droplets": []any{droplet(2, "db", "off", "203.0.113.2", "10.10.0.2")}}
+		} else {
+			page["links"] = map[string]any{"pages": map[string]any{
+				"next": server.URL + "/v2/droplets?page=2&per_page=200",
+			}}
+		}
+		if err := json.NewEncoder(w).Encode(page); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		token   string
+		address string
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{
+			name:  "Public addresses",
+			token: "do-token",
+			want: []ProviderMachine{
+				{ID: "1", Name: "web", Host: "203.0.113.1", Running: true},
+				{ID: "2", Name: "db", Host: "203.0.113.2"},
+			},
+		},
+		{
+			name:    "Private addresses",
+			token:   "do-token",
+			address: AddressPrivate,
+			want: []ProviderMachine{
+				{ID: "1", Name: "web", Host: "10.10.0.1", Running: true},
+				{ID: "2", Name: "db", Host: "10.10.0.2"},
+			},
+		},
+		{name: "Invalid token", token: "wrong", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":    "digitalocean",
+				"url":     server.URL,
+				"token":   tt.token,
+				"options": map[string]any{"address": tt.address},
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package provider
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSProvider discovers machines from SRV records or by listing zones with
+// a zone transfer
+type DNSProvider struct {
+	Config *models.Record
+}
+
+// DNSOptions are the options of a DNS provider
+type DNSOptions struct {
+	// Resolver is the host[:port] of the DNS server, the system resolver
+	// if empty. Zone transfers need one.
+	Resolver string `json:"resolver"`
+	// Records are SRV names like _ssh._tcp.example.com
+	Records []string `json:"records"`
+	// Zones are listed by a zone transfer, their A and AAAA records are
+	// the machines
+	Zones []string `json:"zones"`
+	// Resolve uses the addresses of the machines instead of their names
+	Resolve bool `json:"resolve"`
+}
+
+func NewDNSProvider(config *models.Record) *DNSProvider {
+	return &DNSProvider{Config: config}
+}
+
+func (p *DNSProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts DNSOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	if len(opts.Records) == 0 && len(opts.Zones) == 0 {
+		return nil, fmt.Errorf("please provide SRV records or zones in the options")
+	}
+	if len(opts.Zones) > 0 && opts.Resolver == "" {
+		return nil, fmt.Errorf("please provide a resolver which allows zone transfers")
+	}
+
+	resolver := net.DefaultResolver
+	server := opts.Resolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+		}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	// A record or zone which fails doesn't stop the others
+	var machines []ProviderMachine
+	failed := make(RegionErrors)
+	for _, record := range opts.Records {
+		found, err := dnsServices(ctx, resolver, record, opts.Resolve)
+		if err != nil {
+			failed[record] = err
+			continue
+		}
+		machines = append(machines, found...)
+	}
+	for _, zone := range opts.Zones {
+		found, err := dnsZone(ctx, server, zone, opts.Resolve)
+		if err != nil {
+			failed[zone] = err
+			continue
+		}
+		machines = append(machines, found...)
+	}
+
+	if len(failed) > 0 {
+		return machines, failed
+	}
+	return machines, nil
+}
+
+// dnsServices returns the targets of an SRV record
+func dnsServices(
+	ctx context.Context,
+	resolver *net.Resolver,
+	record string,
+	resolve bool,
+) ([]ProviderMachine, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	_, services, err := resolver.LookupSRV(ctx, "", "", dnsFQDN(record))
+	if err != nil {
+		return nil, err
+	}
+	var machines []ProviderMachine
+	for _, srv := range services {
+		// A target of "." means the service isn't available
+		target := strings.TrimSuffix(srv.Target, ".")
+		if target == "" {
+			continue
+		}
+		host := target
+		if resolve {
+			addresses, err := resolver.LookupNetIP(ctx, "ip", dnsFQDN(target))
+			if err != nil {
+				return nil, err
+			}
+			host = dnsAddress(addresses)
+		}
+		machines = append(machines, ProviderMachine{
+			ID:      net.JoinHostPort(target, strconv.Itoa(int(srv.Port))),
+			Name:    target,
+			Host:    host,
+			Port:    int(srv.Port),
+			Running: true,
+			Region:  strings.TrimSuffix(record, "."),
+		})
+	}
+	return machines, nil
+}
+
+// dnsZone returns the names with A or AAAA records of a zone, wildcards
+// are skipped
+func dnsZone(ctx context.Context, server, zone string, resolve bool) ([]ProviderMachine, error) {
+	records, err := dnsTransfer(ctx, server, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	addresses := make(map[string][]netip.Addr)
+	for _, record := range records {
+		name := strings.TrimSuffix(record.Header.Name.String(), ".")
+		if strings.HasPrefix(name, "*.") {
+			continue
+		}
+		var address netip.Addr
+		switch body := record.Body.(type) {
+		case *dnsmessage.AResource:
+			address = netip.AddrFrom4(body.A)
+		case *dnsmessage.AAAAResource:
+			address = netip.AddrFrom16(body.AAAA)
+		default:
+			continue
+		}
+		if _, ok := addresses[name]; !ok {
+			names = append(names, name)
+		}
+		addresses[name] = append(addresses[name], address)
+	}
+
+	machines := make([]ProviderMachine, 0, len(names))
+	for _, name := range names {
+		host := name
+		if resolve {
+			host = dnsAddress(addresses[name])
+		}
+		machines = append(machines, ProviderMachine{
+			ID:      name,
+			Name:    name,
+			Host:    host,
+			Running: true,
+			Region:  strings.TrimSuffix(zone, "."),
+		})
+	}
+	return machines, nil
+}
+
+// dnsTransfer lists all records of a zone with AXFR over TCP, the transfer
+// starts and ends with the SOA record
+func dnsTransfer(ctx context.Context, server, zone string) ([]dnsmessage.Resource, error) {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	name, err := dnsmessage.NewName(dnsFQDN(zone))
+	if err != nil {
+		return nil, err
+	}
+	id := uint16(rand.Uint32())
+	builder := dnsmessage.NewBuilder(make([]byte, 2, 512), dnsmessage.Header{ID: id})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	err = builder.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.TypeAXFR,
+		Class: dnsmessage.ClassINET,
+	})
+	if err != nil {
+		return nil, err
+	}
+	query, err := builder.Finish()
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint16(query, uint16(len(query)-2))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	var records []dnsmessage.Resource
+	for soa := 0; soa < 2; {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, fmt.Errorf("zone transfer incomplete: %w", err)
+		}
+		message := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, message); err != nil {
+			return nil, fmt.Errorf("zone transfer incomplete: %w", err)
+		}
+
+		var parser dnsmessage.Parser
+		header, err := parser.Start(message)
+		if err != nil {
+			return nil, err
+		}
+		if header.ID != id {
+			return nil, fmt.Errorf("unexpected response id %d", header.ID)
+		}
+		if header.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("zone transfer failed: %s", header.RCode)
+		}
+		if err := parser.SkipAllQuestions(); err != nil {
+			return nil, err
+		}
+		answers, err := parser.AllAnswers()
+		if err != nil {
+			return nil, err
+		}
+		if len(answers) == 0 {
+			return nil, fmt.Errorf("zone transfer failed: empty response")
+		}
+		for _, answer := range answers {
+			if answer.Header.Type == dnsmessage.TypeSOA {
+				soa++
+			}
+			records = append(records, answer)
+		}
+	}
+	return records, nil
+}
+
+// dnsAddress returns the first IPv4 address or the first one at all
+func dnsAddress(addresses []netip.Addr) string {
+	for _, address := range addresses {
+		if address.Unmap().Is4() {
+			return address.Unmap().String()
+		}
+	}
+	if len(addresses) > 0 {
+		return addresses[0].String()
+	}
+	return ""
+}
+
+// dnsFQDN adds the root to a name, so the search domains aren't tried
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
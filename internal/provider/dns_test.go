@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTestServer answers SRV, A and AAAA queries over UDP and TCP and zone
+// transfers of example.test over TCP
+func dnsTestServer(t *testing.T) string {
+	t.Helper()
+	var (
+		packet   net.PacketConn
+		listener net.Listener
+		err      error
+	)
+	// The resolver asks over UDP and TCP on the same port
+	for i := 0; i < 10; i++ {
+		if packet, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if listener, err = net.Listen("tcp", packet.LocalAddr().String()); err == nil {
+			break
+		}
+		packet.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		packet.Close()
+		listener.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := packet.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, reply := range dnsTestReply(t, buf[:n]) {
+				_, _ = packet.WriteTo(reply, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					var length [2]byte
+					if _, err := io.ReadFull(conn, length[:]); err != nil {
+						return
+					}
+					query := make([]byte, binary.BigEndian.Uint16(length[:]))
+					if _, err := io.ReadFull(conn, query); err != nil {
+						return
+					}
+					for _, reply := range dnsTestReply(t, query) {
+						binary.BigEndian.PutUint16(length[:], uint16(len(reply)))
+						_, _ = conn.Write(append(length[:], reply...))
+					}
+				}
+			}()
+		}
+	}()
+	return packet.LocalAddr().String()
+}
+
+func dnsTestReply(t *testing.T, query []byte) [][]byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+
+	name := question.Name.String()
+	rr := func(owner string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+		header := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(owner), Class: dnsmessage.ClassINET, TTL: 60}
+		switch body.(type) {
+		case *dnsmessage.AResource:
+			header.Type = dnsmessage.TypeA
+		case *dnsmessage.AAAAResource:
+			header.Type = dnsmessage.TypeAAAA
+		case *dnsmessage.CNAMEResource:
+			header.Type = dnsmessage.TypeCNAME
+		case *dnsmessage.SRVResource:
+			header.Type = dnsmessage.TypeSRV
+		case *dnsmessage.SOAResource:
+			header.Type = dnsmessage.TypeSOA
+		}
+		return dnsmessage.Resource{Header: header, Body: body}
+	}
+	soa := rr("example.test.", &dnsmessage.SOAResource{
+		NS:     dnsmessage.MustNewName("ns.example.test."),
+		MBox:   dnsmessage.MustNewName("admin.example.test."),
+		Serial: 1,
+	})
+	hosts := map[string]dnsmessage.ResourceBody{
+		"web.example.test.": &dnsmessage.AResource{A: [4]byte{10, 0, 0, 1}},
+		"db.example.test.":  &dnsmessage.AResource{A: [4]byte{10, 0, 0, 2}},
+	}
+
+	rcode := dnsmessage.RCodeSuccess
+	var messages [][]dnsmessage.Resource
+	switch {
+	case question.Type == dnsmessage.TypeAXFR && name == "example.test.":
+		// Split over two messages like large zones
+		messages = [][]dnsmessage.Resource{
+			{
+				soa,
+				rr("web.example.test.", &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}),
+				rr("web.example.test.", hosts["web.example.test."]),
+				rr("*.apps.example.test.", &dnsmessage.AResource{A: [4]byte{10, 0, 0, 9}}),
+			},
+			{
+				rr("www.example.test.", &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("web.example.test.")}),
+				rr("db.example.test.", hosts["db.example.test."]),
+				soa,
+			},
+		}
+	case question.Type == dnsmessage.TypeAXFR:
+		rcode = dnsmessage.RCodeRefused
+		messages = [][]dnsmessage.Resource{nil}
+	case question.Type == dnsmessage.TypeSRV && name == "_ssh._tcp.example.test.":
+		messages = [][]dnsmessage.Resource{{
+			rr(name, &dnsmessage.SRVResource{Port: 2222, Target: dnsmessage.MustNewName("web.example.test.")}),
+			rr(name, &dnsmessage.SRVResource{Port: 22, Target: dnsmessage.MustNewName("db.example.test.")}),
+		}}
+	case question.Type == dnsmessage.TypeA && hosts[name] != nil:
+		messages = [][]dnsmessage.Resource{{rr(name, hosts[name])}}
+	case hosts[name] != nil:
+		messages = [][]dnsmessage.Resource{nil}
+	default:
+		rcode = dnsmessage.RCodeNameError
+		messages = [][]dnsmessage.Resource{nil}
+	}
+
+	var replies [][]byte
+	for _, answers := range messages {
+		msg := dnsmessage.Message{
+			Header: dnsmessage.Header{
+				ID:            header.ID,
+				Response:      true,
+				Authoritative: true,
+				RCode:         rcode,
+			},
+			Questions: []dnsmessage.Question{question},
+			Answers:   answers,
+		}
+		reply, err := msg.Pack()
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		replies = append(replies, reply)
+	}
+	return replies
+}
+
+func TestDNSProviderSync(t *testing.T) {
+	resolver := dnsTestServer(t)
+
+	srv := []ProviderMachine{
+		{ID: "web.example.test:2222", Name: "web.example.test", Host: "10.0.0.1", Port: 2222, Running: true, Region: "_ssh._tcp.example.test"},
+		{ID: "db.example.test:22", Name: "db.example.test", Host: "10.0.0.2", Port: 22, Running: true, Region: "_ssh._tcp.example.test"},
+	}
+	tests := []struct {
+		name    string
+		options map[string]any
+		want    []ProviderMachine
+		wantErr string
+	}{
+		{
+			name: "SRV records",
+			options: map[string]any{
+				"resolver": resolver,
+				"records":  []string{"_ssh._tcp.example.test"},
+				"resolve":  true,
+			},
+			want: srv,
+		},
+		{
+			name: "Zone transfer",
+			options: map[string]any{
+				"resolver": resolver,
+				"zones":    []string{"example.test"},
+			},
+			want: []ProviderMachine{
+				{ID: "web.example.test", Name: "web.example.test", Host: "web.example.test", Running: true, Region: "example.test"},
+				{ID: "db.example.test", Name: "db.example.test", Host: "db.example.test", Running: true, Region: "example.test"},
+			},
+		},
+		{
+			name: "Zone transfer with addresses",
+			options: map[string]any{
+				"resolver": resolver,
+				"zones":    []string{"example.test."},
+				"resolve":  true,
+			},
+			want: []ProviderMachine{
+				{ID: "web.example.test", Name: "web.example.test", Host: "10.0.0.1", Running: true, Region: "example.test"},
+				{ID: "db.example.test", Name: "db.example.test", Host: "10.0.0.2", Running: true, Region: "example.test"},
+			},
+		},
+		{
+			name: "Refused zone",
+			options: map[string]any{
+				"resolver": resolver,
+				"records":  []string{"_ssh._tcp.example.test"},
+				"zones":    []string{"other.test"},
+				"resolve":  true,
+			},
+			want:    srv,
+			wantErr: "other.test: zone transfer failed: RCodeRefused",
+		},
+		{
+			name:    "Zone without resolver",
+			options: map[string]any{"zones": []string{"example.test"}},
+			wantErr: "resolver",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":    "dns",
+				"options": tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Sync() error = %v, want %q", err, tt.wantErr)
+			}
+			var failed RegionErrors
+			if tt.want != nil && err != nil && !errors.As(err, &failed) {
+				t.Errorf("Sync() error = %T, want RegionErrors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Filter selects the machines of a provider which nexus manages. Include
+// lists match if any entry matches, except labels which all have to match.
+// Names and regions are globs like web-*, names can also be a regular
+// expression like /^web-\d+$/. Labels are key=value or just a key.
+type Filter struct {
+	Regions        []string `json:"regions,omitempty"`
+	ExcludeRegions []string `json:"exclude_regions,omitempty"`
+	Labels         []string `json:"labels,omitempty"`
+	ExcludeLabels  []string `json:"exclude_labels,omitempty"`
+	Names          []string `json:"names,omitempty"`
+	ExcludeNames   []string `json:"exclude_names,omitempty"`
+	RunningOnly    bool     `json:"running_only,omitempty"`
+
+	names        []*regexp.Regexp
+	excludeNames []*regexp.Regexp
+}
+
+// NewFilter reads the filters of a provider
+func NewFilter(config *models.Record) (*Filter, error) {
+	f := &Filter{}
+	raw := strings.TrimSpace(config.GetString("filters"))
+	if raw != "" && raw != "null" {
+		if err := json.Unmarshal([]byte(raw), f); err != nil {
+			return nil, fmt.Errorf("invalid filters: %w", err)
+		}
+	}
+	if err := f.compile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Filter) compile() error {
+	var err error
+	if f.names, err = compilePatterns(f.Names); err != nil {
+		return err
+	}
+	if f.excludeNames, err = compilePatterns(f.ExcludeNames); err != nil {
+		return err
+	}
+	for _, pattern := range slices.Concat(f.Regions, f.ExcludeRegions) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid region pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Apply returns the machines matching the filter
+func (f *Filter) Apply(machines []ProviderMachine) []ProviderMachine {
+	var result []ProviderMachine
+	for _, machine := range machines {
+		if f.Match(machine) {
+			result = append(result, machine)
+		}
+	}
+	return result
+}
+
+// Match reports whether nexus manages a machine
+func (f *Filter) Match(m ProviderMachine) bool {
+	if f.RunningOnly && !m.Running {
+		return false
+	}
+	if len(f.Regions) > 0 && !matchGlobs(f.Regions, m.Region) {
+		return false
+	}
+	if matchGlobs(f.ExcludeRegions, m.Region) {
+		return false
+	}
+	if len(f.names) > 0 && !matchPatterns(f.names, m.Name) {
+		return false
+	}
+	if matchPatterns(f.excludeNames, m.Name) {
+		return false
+	}
+	for _, label := range f.Labels {
+		if !hasLabel(m.Labels, label) {
+			return false
+		}
+	}
+	for _, label := range f.ExcludeLabels {
+		if hasLabel(m.Labels, label) {
+			return false
+		}
+	}
+	return true
+}
+
+// compilePatterns turns globs and /regular expressions/ into expressions
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		var expr string
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			expr = pattern[1 : len(pattern)-1]
+		} else {
+			expr = "^" + strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern)) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid name pattern %q: %w", pattern, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+func matchPatterns(patterns []*regexp.Regexp, value string) bool {
+	for _, re := range patterns {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchGlobs(globs []string, value string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLabel matches key=value or the presence of a key
+func hasLabel(labels map[string]string, label string) bool {
+	key, value, withValue := strings.Cut(label, "=")
+	actual, ok := labels[strings.TrimSpace(key)]
+	if !ok {
+		return false
+	}
+	return !withValue || actual == strings.TrimSpace(value)
+}
+
+// tagLabels turns plain tags into labels, tags like env:prod or env=prod
+// get a value
+func tagLabels(tags []string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if key, value, ok := strings.Cut(tag, "="); ok {
+			labels[key] = value
+		} else if key, value, ok := strings.Cut(tag, ":"); ok {
+			labels[key] = value
+		} else {
+			labels[tag] = ""
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
@@ -0,0 +1,85 @@
+package provider
+
+import (
+	"testing"
+)
+
+func TestFilterMatch(t *testing.T) {
+	t.Parallel()
+	web := ProviderMachine{
+		Name:    "web-12",
+		Running: true,
+		Region:  "eu-central-1",
+		Labels:  map[string]string{"env": "prod", "team": "payments", "nexus": ""},
+	}
+	stopped := ProviderMachine{Name: "batch", Region: "us-east-1"}
+
+	tests := []struct {
+		name    string
+		filters map[string]any
+		machine ProviderMachine
+		want    bool
+	}{
+		{name: "No filters", filters: nil, machine: stopped, want: true},
+		{name: "Running only", filters: map[string]any{"running_only": true}, machine: stopped},
+		{name: "Region glob", filters: map[string]any{"regions": []string{"eu-*"}}, machine: web, want: true},
+		{name: "Other region", filters: map[string]any{"regions": []string{"eu-*"}}, machine: stopped},
+		{name: "Excluded region", filters: map[string]any{"exclude_regions": []string{"*-central-*"}}, machine: web},
+		{name: "Name glob", filters: map[string]any{"names": []string{"db-*", "web-*"}}, machine: web, want: true},
+		{name: "Name regex", filters: map[string]any{"names": []string{`/^web-\d+$/`}}, machine: web, want: true},
+		{name: "Name regex mismatch", filters: map[string]any{"names": []string{`/^web-\d$/`}}, machine: web},
+		{name: "Excluded name", filters: map[string]any{"exclude_names": []string{"web-1?"}}, machine: web},
+		{
+			name:    "All labels",
+			filters: map[string]any{"labels": []string{"env=prod", "nexus"}},
+			machine: web,
+			want:    true,
+		},
+		{name: "Label value", filters: map[string]any{"labels": []string{"env=dev"}}, machine: web},
+		{name: "Missing label", filters: map[string]any{"labels": []string{"nexus"}}, machine: stopped},
+		{name: "Excluded label", filters: map[string]any{"exclude_labels": []string{"team=payments"}}, machine: web},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			filter, err := NewFilter(testConfig(t, map[string]any{"filters": tt.filters}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Match(tt.machine); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFilterErrors(t *testing.T) {
+	t.Parallel()
+	for _, filters := range []any{
+		map[string]any{"names": []string{"/web-(/"}},
+		map[string]any{"regions": []string{"eu-["}},
+		map[string]any{"running_only": "yes"},
+	} {
+		if _, err := NewFilter(testConfig(t, map[string]any{"filters": filters})); err == nil {
+			t.Errorf("NewFilter(%v) expected an error", filters)
+		}
+	}
+}
+
+func TestTagLabels(t *testing.T) {
+	t.Parallel()
+	got := tagLabels([]string{"web", "env:prod", "team=payments", " "})
+	want := map[string]string{"web": "", "env": "prod", "team": "payments"}
+	if len(got) != len(want) {
+		t.Fatalf("tagLabels() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("tagLabels()[%s] = %q, want %q", key, got[key], value)
+		}
+	}
+	if tagLabels([]string{""}) != nil {
+		t.Error("tagLabels() of empty tags isn't nil")
+	}
+}
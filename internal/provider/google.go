@@ -1,21 +1,213 @@
 package provider
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	googleComputeURL = "https://compute.googleapis.com"
+	googleTokenURL   = "https://oauth2.googleapis.com/token"
+	googleScope      = "https://www.googleapis.com/auth/compute.readonly"
 )
 
+// GoogleCloudProvider discovers Compute Engine instances, the token is the
+// JSON key of a service account
 type GoogleCloudProvider struct {
 	Config *models.Record
 }
 
+// GoogleCloudOptions are the options of a Google Cloud provider
+type GoogleCloudOptions struct {
+	// Projects to search, the project of the service account if empty
+	Projects []string `json:"projects"`
+	// Zones to search, all zones with an aggregated list if empty
+	Zones []string `json:"zones"`
+	// Address is either public or private, public by default
+	Address string `json:"address"`
+}
+
 func NewGoogleCloudProvider(config *models.Record) *GoogleCloudProvider {
 	return &GoogleCloudProvider{Config: config}
 }
 
-func (p *GoogleCloudProvider) Sync() ([]ProviderMachine, error) {
-	// TODO: Implement
+type googleServiceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+type googleInstance struct {
+	ID                string            `json:"id"`
+	Name              string            `json:"name"`
+	Status            string            `json:"status"`
+	Zone              string            `json:"zone"`
+	Labels            map[string]string `json:"labels"`
+	NetworkInterfaces []struct {
+		NetworkIP     string `json:"networkIP"`
+		AccessConfigs []struct {
+			NatIP string `json:"natIP"`
+		} `json:"accessConfigs"`
+	} `json:"networkInterfaces"`
+}
+
+func (p *GoogleCloudProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
 
-	// var machines []ProviderMachine
+	var opts GoogleCloudOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	var key googleServiceAccount
+	if err := json.Unmarshal([]byte(p.Config.GetString("token")), &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("please provide the JSON key of a service account")
+	}
+	tokenURL := key.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+	credentials := &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		Scopes:       []string{googleScope},
+		TokenURL:     tokenURL,
+	}
+	client := credentials.Client(ctx)
+
+	baseURL := strings.TrimSuffix(p.Config.GetString("url"), "/")
+	if baseURL == "" {
+		baseURL = googleComputeURL
+	}
+	projects := opts.Projects
+	if len(projects) == 0 {
+		if key.ProjectID == "" {
+			return nil, fmt.Errorf("please provide the projects in the options")
+		}
+		projects = []string{key.ProjectID}
+	}
+
+	var machines []ProviderMachine
+	for _, project := range projects {
+		projectURL := fmt.Sprintf("%s/compute/v1/projects/%s", baseURL, url.PathEscape(project))
+		instances, err := googleInstances(ctx, client, projectURL, opts.Zones)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", project, err)
+		}
+		for _, instance := range instances {
+			var public, private string
+			if len(instance.NetworkInterfaces) > 0 {
+				nic := instance.NetworkInterfaces[0]
+				private = nic.NetworkIP
+				if len(nic.AccessConfigs) > 0 {
+					public = nic.AccessConfigs[0].NatIP
+				}
+			}
+			machines = append(machines, ProviderMachine{
+				ID:      instance.ID,
+				Name:    instance.Name,
+				Host:    pickAddress(opts.Address, public, private),
+				Running: instance.Status == "RUNNING",
+				Region:  googleZone(instance.Zone),
+				Labels:  instance.Labels,
+			})
+		}
+	}
+	return machines, nil
+}
+
+// googleZone returns the name of a zone URL
+func googleZone(zone string) string {
+	if zone == "" {
+		return ""
+	}
+	return path.Base(zone)
+}
+
+// googleInstances lists the instances of a project in the given zones or
+// in all zones if there are none
+func googleInstances(
+	ctx context.Context,
+	client *http.Client,
+	projectURL string,
+	zones []string,
+) ([]googleInstance, error) {
+	var instances []googleInstance
+	if len(zones) == 0 {
+		type zoneInstances struct {
+			Instances []googleInstance `json:"instances"`
+		}
+		err := googlePages(ctx, client, projectURL+"/aggregated/instances", func(raw json.RawMessage) error {
+			var items map[string]zoneInstances
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return err
+			}
+			for _, zone := range items {
+				instances = append(instances, zone.Instances...)
+			}
+			return nil
+		})
+		return instances, err
+	}
+
+	for _, zone := range zones {
+		zoneURL := fmt.Sprintf("%s/zones/%s/instances", projectURL, url.PathEscape(zone))
+		err := googlePages(ctx, client, zoneURL, func(raw json.RawMessage) error {
+			var items []googleInstance
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return err
+			}
+			instances = append(instances, items...)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", zone, err)
+		}
+	}
+	return instances, nil
+}
 
-	return nil, nil
+// googlePages passes the items of every page of a list to add
+func googlePages(
+	ctx context.Context,
+	client *http.Client,
+	listURL string,
+	add func(items json.RawMessage) error,
+) error {
+	pageToken := ""
+	for {
+		pageURL := listURL
+		if pageToken != "" {
+			pageURL += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+		var page struct {
+			Items         json.RawMessage `json:"items"`
+			NextPageToken string          `json:"nextPageToken"`
+		}
+		if err := getJSON(ctx, client, pageURL, &page); err != nil {
+			return err
+		}
+		if len(page.Items) > 0 {
+			if err := add(page.Items); err != nil {
+				return err
+			}
+		}
+		if page.NextPageToken == "" {
+			return nil
+		}
+		pageToken = page.NextPageToken
+	}
 }
@@ -0,0 +1,178 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// googleStandIn serves a token endpoint and the instances of project-1
+func googleStandIn(t *testing.T) *httptest.Server {
+	t.Helper()
+	reply := func(w http.ResponseWriter, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			t.Error(err)
+		}
+	}
+	instance := func(id, name, status, private, public string) map[string]any {
+		nic := map[string]any{"networkIP": private}
+		if public != "" {
+			nic["accessConfigs"] = []any{map[string]any{"natIP": public}}
+		}
+		return map[string]any{
+			"id":                id,
+			"name":              name,
+			"status":            status,
+			"networkInterfaces": []any{nic},
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil ||
+			r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" ||
+			r.PostForm.Get("assertion") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		reply(w, map[string]any{"access_token": "gce-token", "token_type": "Bearer", "expires_in": 3600})
+	})
+	authorized := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer gce-token" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /compute/v1/projects/project-1/aggregated/instances",
+		authorized(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("pageToken") == "" {
+				reply(w, map[string]any{
+					"items": map[string]any{
+						"zones/europe-west1-b": map[string]any{"instances": []any{
+							instance("101", "web", "RUNNING", "10.0.0.2", "34.1.2.3"),
+						}},
+						"zones/us-east1-c": map[string]any{"warning": map[string]any{"code": "NO_RESULTS_ON_PAGE"}},
+					},
+					"nextPageToken": "page-2",
+				})
+				return
+			}
+			reply(w, map[string]any{"items": map[string]any{
+				"zones/us-east1-c": map[string]any{"instances": []any{
+					instance("102", "db", "TERMINATED", "10.0.0.3", ""),
+				}},
+			}})
+		}))
+	mux.HandleFunc("GET /compute/v1/projects/project-1/zones/europe-west1-b/instances",
+		authorized(func(w http.ResponseWriter, r *http.Request) {
+			reply(w, map[string]any{"items": []any{
+				instance("101", "web", "RUNNING", "10.0.0.2", "34.1.2.3"),
+			}})
+		}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func googleKey(t *testing.T, tokenURI string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(googleServiceAccount{
+		Type:         "service_account",
+		ProjectID:    "project-1",
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		ClientEmail:  "nexus@project-1.iam.gserviceaccount.com",
+		TokenURI:     tokenURI,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(raw)
+}
+
+func TestGoogleCloudProviderSync(t *testing.T) {
+	server := googleStandIn(t)
+	key := googleKey(t, server.URL+"/token")
+
+	tests := []struct {
+		name    string
+		token   string
+		options map[string]any
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{
+			name:  "Aggregated list",
+			token: key,
+			want: []ProviderMachine{
+				{ID: "101", Name: "web", Host: "34.1.2.3", Running: true},
+				{ID: "102", Name: "db", Host: "10.0.0.3"},
+			},
+		},
+		{
+			name:  "Zones with private addresses",
+			token: key,
+			options: map[string]any{
+				"projects": []string{"project-1"},
+				"zones":    []string{"europe-west1-b"},
+				"address":  AddressPrivate,
+			},
+			want: []ProviderMachine{{ID: "101", Name: "web", Host: "10.0.0.2", Running: true}},
+		},
+		{
+			name:    "Unknown project",
+			token:   key,
+			options: map[string]any{"projects": []string{"project-2"}},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid key",
+			token:   `{"type": "authorized_user"}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":    "google",
+				"url":     server.URL,
+				"token":   tt.token,
+				"options": tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			slices.SortFunc(got, func(a, b ProviderMachine) int { return strings.Compare(a.ID, b.ID) })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
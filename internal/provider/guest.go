@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// guestAddress is an address of a guest with the network, bridge or
+// interface it's on
+type guestAddress struct {
+	IP      netip.Addr
+	Network string
+}
+
+// pickGuestAddress picks the address of a guest. The first network which
+// has an address wins, networks are CIDRs or names of bridges or
+// interfaces. Without a match IPv4 comes before IPv6 unless preferred.
+// Loopback and link-local addresses are never used.
+func pickGuestAddress(addresses []guestAddress, networks []string, preferIPv6 bool) string {
+	var usable []guestAddress
+	for _, address := range addresses {
+		ip := address.IP.Unmap()
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast() {
+			continue
+		}
+		usable = append(usable, guestAddress{IP: ip, Network: address.Network})
+	}
+
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		prefix, err := netip.ParsePrefix(network)
+		for _, address := range usable {
+			if (err == nil && prefix.Contains(address.IP)) || (err != nil && address.Network == network) {
+				return address.IP.String()
+			}
+		}
+	}
+
+	for _, ipv6 := range []bool{preferIPv6, !preferIPv6} {
+		for _, address := range usable {
+			if address.IP.Is6() == ipv6 {
+				return address.IP.String()
+			}
+		}
+	}
+	return ""
+}
+
+// newTLSConfig verifies the certificate of an API against the system
+// roots, a CA bundle or a pinned SHA-256 fingerprint
+func newTLSConfig(caCert, fingerprint string, insecure bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caCert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(caCert)) {
+			return nil, fmt.Errorf("invalid ca_cert: no certificates found")
+		}
+		config.RootCAs = pool
+	}
+	if fingerprint != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("invalid fingerprint: expected a SHA-256 fingerprint")
+		}
+		// The pin replaces the chain verification, self-signed
+		// certificates don't have a chain to verify
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(certs [][]byte, _ [][]*x509.Certificate) error {
+			if len(certs) == 0 {
+				return fmt.Errorf("no certificate presented")
+			}
+			sum := sha256.Sum256(certs[0])
+			if !slices.Equal(sum[:], pin) {
+				return fmt.Errorf("certificate fingerprint %X doesn't match", sum)
+			}
+			return nil
+		}
+		return config, nil
+	}
+	config.InsecureSkipVerify = insecure
+	return config, nil
+}
@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestPickGuestAddress(t *testing.T) {
+	t.Parallel()
+	addresses := []guestAddress{
+		{IP: netip.MustParseAddr("fe80::1"), Network: "vmbr0"},
+		{IP: netip.MustParseAddr("2001:db8::1"), Network: "vmbr0"},
+		{IP: netip.MustParseAddr("192.168.1.10"), Network: "vmbr0"},
+		{IP: netip.MustParseAddr("10.0.0.10"), Network: "vmbr1"},
+	}
+	tests := []struct {
+		name     string
+		networks []string
+		ipv6     bool
+		want     string
+	}{
+		{name: "IPv4 first", want: "192.168.1.10"},
+		{name: "IPv6 preferred", ipv6: true, want: "2001:db8::1"},
+		{name: "CIDR", networks: []string{"10.0.0.0/8"}, want: "10.0.0.10"},
+		{name: "Bridge", networks: []string{"vmbr1"}, want: "10.0.0.10"},
+		{name: "IPv6 CIDR", networks: []string{"2001:db8::/32"}, want: "2001:db8::1"},
+		{name: "No match", networks: []string{"172.16.0.0/12"}, want: "192.168.1.10"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := pickGuestAddress(addresses, tt.networks, tt.ipv6); got != tt.want {
+				t.Errorf("pickGuestAddress() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
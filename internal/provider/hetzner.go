@@ -17,14 +17,14 @@ func NewHetznerProvider(config *models.Record) *HetznerProvider {
 	return &HetznerProvider{Config: config}
 }
 
-func (p *HetznerProvider) Sync() ([]ProviderMachine, error) {
+func (p *HetznerProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
 	client := hcloud.NewClient(
 		hcloud.WithToken(p.Config.GetString("token")),
 		hcloud.WithBackoffFunc(func(retries int) time.Duration {
 			return time.Duration(retries*5) * time.Second
 		}),
 	)
-	servers, err := client.Server.All(context.Background())
+	servers, err := client.Server.All(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -36,6 +36,10 @@ func (p *HetznerProvider) Sync() ([]ProviderMachine, error) {
 			Host:    server.PublicNet.IPv4.IP.String(),
 			Name:    server.Name,
 			Running: server.Status == "running",
+			Labels:  server.Labels,
+		}
+		if server.Datacenter != nil && server.Datacenter.Location != nil {
+			machine.Region = server.Datacenter.Location.Name
 		}
 		machines = append(machines, machine)
 	}
@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Address preferences of providers which know several addresses
+const (
+	AddressPublic  = "public"
+	AddressPrivate = "private"
+)
+
+// requestTimeout limits single API requests of the providers
+const requestTimeout = 30 * time.Second
+
+// decodeOptions reads the type specific options of a provider
+func decodeOptions(config *models.Record, options any) error {
+	raw := strings.TrimSpace(config.GetString("options"))
+	if raw == "" || raw == "null" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), options); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+	return nil
+}
+
+// pickAddress returns the preferred address, falling back to the other
+func pickAddress(preference, public, private string) string {
+	if preference == AddressPrivate {
+		public, private = private, public
+	}
+	if public != "" {
+		return public
+	}
+	return private
+}
+
+// getJSON decodes the JSON response of a GET request
+func getJSON(ctx context.Context, client *http.Client, url string, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("GET %s: %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// headerTransport adds headers like the API token to every request
+type headerTransport struct {
+	header http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// tokenClient returns a client sending the token in the header
+func tokenClient(header, token string) *http.Client {
+	return &http.Client{Transport: &headerTransport{header: http.Header{
+		http.CanonicalHeaderKey(header): {token},
+	}}}
+}
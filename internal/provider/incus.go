@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// incusDefaultSocket is used for a unix url without a path
+const incusDefaultSocket = "/var/lib/incus/unix.socket"
+
+// IncusProvider discovers the instances of Incus or LXD. The url is either
+// unix:///path/to/unix.socket or https://host:8443, over HTTPS the token is
+// the PEM key of the client certificate.
+type IncusProvider struct {
+	Config *models.Record
+}
+
+// IncusOptions are the options of an Incus provider
+type IncusOptions struct {
+	// ClientCert is the PEM certificate trusted by the server
+	ClientCert string `json:"client_cert"`
+	// CACert, Fingerprint and Insecure verify the server certificate
+	CACert      string `json:"ca_cert"`
+	Fingerprint string `json:"fingerprint"`
+	Insecure    bool   `json:"insecure"`
+	// Projects to search, all projects if empty
+	Projects []string `json:"projects"`
+	// Networks are CIDRs or interfaces in order of preference for the host
+	Networks []string `json:"networks"`
+	// IPv6 prefers IPv6 over IPv4 addresses
+	IPv6 bool `json:"ipv6"`
+}
+
+type incusInstance struct {
+	Name     string            `json:"name"`
+	Status   string            `json:"status"`
+	Location string            `json:"location"`
+	Project  string            `json:"project"`
+	Config   map[string]string `json:"config"`
+	State    *struct {
+		Network map[string]struct {
+			Addresses []struct {
+				Address string `json:"address"`
+			} `json:"addresses"`
+		} `json:"network"`
+	} `json:"state"`
+}
+
+func NewIncusProvider(config *models.Record) *IncusProvider {
+	return &IncusProvider{Config: config}
+}
+
+func (p *IncusProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts IncusOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	client, baseURL, err := p.client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Recursion 2 includes the state with the addresses
+	var queries []url.Values
+	if len(opts.Projects) == 0 {
+		queries = append(queries, url.Values{"recursion": {"2"}, "all-projects": {"true"}})
+	}
+	for _, project := range opts.Projects {
+		queries = append(queries, url.Values{"recursion": {"2"}, "project": {project}})
+	}
+
+	var machines []ProviderMachine
+	for _, query := range queries {
+		var instances []incusInstance
+		if err := incusGet(ctx, client, baseURL+"/1.0/instances?"+query.Encode(), &instances); err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			machines = append(machines, incusMachine(instance, opts))
+		}
+	}
+	return machines, nil
+}
+
+// client returns an HTTP client for the unix socket or the HTTPS API
+func (p *IncusProvider) client(opts IncusOptions) (*http.Client, string, error) {
+	u, err := url.Parse(p.Config.GetString("url"))
+	if err != nil {
+		return nil, "", err
+	}
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		if socket == "" {
+			socket = incusDefaultSocket
+		}
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return &http.Client{Transport: transport, Timeout: requestTimeout}, "http://incus", nil
+	case "https":
+		config, err := newTLSConfig(opts.CACert, opts.Fingerprint, opts.Insecure)
+		if err != nil {
+			return nil, "", err
+		}
+		if opts.ClientCert == "" || p.Config.GetString("token") == "" {
+			return nil, "", fmt.Errorf("please provide a client certificate and its key as token")
+		}
+		cert, err := tls.X509KeyPair([]byte(opts.ClientCert), []byte(p.Config.GetString("token")))
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+		transport := &http.Transport{TLSClientConfig: config}
+		return &http.Client{Transport: transport, Timeout: requestTimeout}, strings.TrimSuffix(u.String(), "/"), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported url %q, expected unix:// or https://", u.String())
+	}
+}
+
+// incusGet decodes the metadata of a synchronous response
+func incusGet(ctx context.Context, client *http.Client, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Type     string          `json:"type"`
+		Error    string          `json:"error"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	if body.Type == "error" || resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s: %s", url, resp.Status, body.Error)
+	}
+	return json.Unmarshal(body.Metadata, result)
+}
+
+// incusMachine turns an instance into a machine, user.* config keys become
+// labels and the id is the volatile uuid which survives renames
+func incusMachine(instance incusInstance, opts IncusOptions) ProviderMachine {
+	id := instance.Config["volatile.uuid"]
+	if id == "" {
+		id = instance.Project + "/" + instance.Name
+	}
+	var labels map[string]string
+	for key, value := range instance.Config {
+		if name, ok := strings.CutPrefix(key, "user."); ok {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[name] = value
+		}
+	}
+	region := instance.Location
+	if region == "none" {
+		region = ""
+	}
+
+	var addresses []guestAddress
+	if instance.State != nil {
+		for name, iface := range instance.State.Network {
+			for _, address := range iface.Addresses {
+				if ip, err := netip.ParseAddr(address.Address); err == nil {
+					addresses = append(addresses, guestAddress{IP: ip, Network: name})
+				}
+			}
+		}
+	}
+	// Interfaces come as a map, sort them for a stable choice
+	slices.SortStableFunc(addresses, func(a, b guestAddress) int {
+		return strings.Compare(a.Network, b.Network)
+	})
+
+	return ProviderMachine{
+		ID:      id,
+		Name:    instance.Name,
+		Host:    pickGuestAddress(addresses, opts.Networks, opts.IPv6),
+		Running: instance.Status == "Running",
+		Region:  region,
+		Labels:  labels,
+	}
+}
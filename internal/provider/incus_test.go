@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIncusProviderSync(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := func(v any) {
+			if err := json.NewEncoder(w).Encode(map[string]any{"type": "sync", "metadata": v}); err != nil {
+				t.Error(err)
+			}
+		}
+		if r.URL.Path != "/1.0/instances" || r.URL.Query().Get("recursion") != "2" {
+			w.WriteHeader(http.StatusNotFound)
+			reply(nil)
+			return
+		}
+		if r.URL.Query().Get("project") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"type": "error", "error": "Project not found", "error_code": 404}`))
+			return
+		}
+		reply([]any{
+			map[string]any{
+				"name":     "web",
+				"status":   "Running",
+				"location": "none",
+				"project":  "default",
+				"config":   map[string]string{"volatile.uuid": "6b1a2c4e", "user.env": "prod", "limits.cpu": "2"},
+				"state": map[string]any{"network": map[string]any{
+					"lo": map[string]any{"addresses": []any{
+						map[string]any{"family": "inet", "address": "127.0.0.1", "scope": "local"},
+					}},
+					"eth1": map[string]any{"addresses": []any{
+						map[string]any{"family": "inet", "address": "10.20.0.5", "scope": "global"},
+					}},
+					"eth0": map[string]any{"addresses": []any{
+						map[string]any{"family": "inet6", "address": "fe80::216:3eff:fe00:1", "scope": "link"},
+						map[string]any{"family": "inet", "address": "10.10.0.5", "scope": "global"},
+					}},
+				}},
+			},
+			map[string]any{
+				"name":     "db",
+				"status":   "Stopped",
+				"location": "node2",
+				"project":  "default",
+				"config":   map[string]string{},
+			},
+		})
+	})
+
+	// The unix socket
+	socket := filepath.Join(t.TempDir(), "unix.socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unixServer := &httptest.Server{Listener: listener, Config: &http.Server{Handler: handler}}
+	unixServer.Start()
+	t.Cleanup(unixServer.Close)
+
+	// HTTPS with a client certificate
+	clientCert, clientKey := incusTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(clientCert))
+	tlsServer := httptest.NewUnstartedServer(handler)
+	tlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	tlsServer.StartTLS()
+	t.Cleanup(tlsServer.Close)
+	serverCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}))
+
+	want := []ProviderMachine{
+		{ID: "6b1a2c4e", Name: "web", Host: "10.10.0.5", Running: true, Labels: map[string]string{"env": "prod"}},
+		{ID: "default/db", Name: "db", Region: "node2"},
+	}
+	tests := []struct {
+		name    string
+		url     string
+		token   string
+		options map[string]any
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{name: "Unix socket", url: "unix://" + socket, want: want},
+		{
+			name:    "HTTPS",
+			url:     tlsServer.URL,
+			token:   clientKey,
+			options: map[string]any{"client_cert": clientCert, "ca_cert": serverCert},
+			want:    want,
+		},
+		{
+			name:    "Networks",
+			url:     "unix://" + socket,
+			options: map[string]any{"networks": []string{"eth1"}, "projects": []string{"default"}},
+			want: []ProviderMachine{
+				{ID: "6b1a2c4e", Name: "web", Host: "10.20.0.5", Running: true, Labels: map[string]string{"env": "prod"}},
+				want[1],
+			},
+		},
+		{name: "Missing project", url: "unix://" + socket, options: map[string]any{"projects": []string{"missing"}}, wantErr: true},
+		{name: "HTTPS without certificate", url: tlsServer.URL, options: map[string]any{"ca_cert": serverCert}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":    "incus",
+				"url":     tt.url,
+				"token":   tt.token,
+				"options": tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// incusTestCertificate returns a self-signed client certificate and its key
+func incusTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ssh-nexus"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
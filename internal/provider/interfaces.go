@@ -2,20 +2,30 @@
 package provider
 
 import (
+	"context"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/pocketbase/pocketbase/models"
 )
 
 type Provider interface {
-	Sync() ([]ProviderMachine, error)
+	// Sync lists the machines, canceling the context stops the API calls
+	Sync(ctx context.Context) ([]ProviderMachine, error)
 }
 
 type ProviderMachine struct {
-	ID      string `json:"id,omitempty"`
-	Name    string `json:"name,omitempty"`
-	Host    string `json:"host,omitempty"`
-	Running bool   `json:"running,omitempty"`
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+	Host string `json:"host,omitempty"`
+	// Port of the SSH server, 22 if unknown
+	Port    int  `json:"port,omitempty"`
+	Running bool `json:"running,omitempty"`
+	// Region is the region, zone or node of the machine
+	Region string `json:"region,omitempty"`
+	// Labels are the labels or tags of the machine in the cloud
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // NewProvider creates a new provider
@@ -26,10 +36,20 @@ func NewProvider(config *models.Record) (Provider, error) {
 
 	switch config.GetString("type") {
 	case "aws":
-		if username == "" || password == "" || token == "" {
-			return nil, fmt.Errorf("please provide an id, secret and token")
+		if username == "" || password == "" {
+			return nil, fmt.Errorf("please provide an access key id and secret")
 		}
 		return NewAWSProvider(config), nil
+	case "azure":
+		if username == "" || password == "" {
+			return nil, fmt.Errorf("please provide a client id and secret")
+		}
+		return NewAzureProvider(config), nil
+	case "google":
+		if token == "" {
+			return nil, fmt.Errorf("please provide the JSON key of a service account as token")
+		}
+		return NewGoogleCloudProvider(config), nil
 	case "linode":
 		if token == "" {
 			return nil, fmt.Errorf("please provide a token")
@@ -45,6 +65,21 @@ func NewProvider(config *models.Record) (Provider, error) {
 			return nil, fmt.Errorf("please provide a token")
 		}
 		return NewVultrProvider(config), nil
+	case "digitalocean":
+		if token == "" {
+			return nil, fmt.Errorf("please provide a token")
+		}
+		return NewDigitalOceanProvider(config), nil
+	case "scaleway":
+		if token == "" {
+			return nil, fmt.Errorf("please provide the secret key as token")
+		}
+		return NewScalewayProvider(config), nil
+	case "ovh":
+		if username == "" || password == "" || token == "" {
+			return nil, fmt.Errorf("please provide an application key, secret and consumer key")
+		}
+		return NewOVHProvider(config), nil
 	case "proxmox":
 		if username == "" {
 			return nil, fmt.Errorf("please provide a username")
@@ -53,7 +88,42 @@ func NewProvider(config *models.Record) (Provider, error) {
 			return nil, fmt.Errorf("please provide either a token or password")
 		}
 		return NewProxmoxProvider(config), nil
+	case "incus", "lxd":
+		if config.GetString("url") == "" {
+			return nil, fmt.Errorf("please provide the unix socket or https url")
+		}
+		return NewIncusProvider(config), nil
+	case "libvirt":
+		if config.GetString("url") == "" {
+			return nil, fmt.Errorf("please provide a libvirt uri")
+		}
+		return NewLibvirtProvider(config), nil
+	case "static":
+		if config.GetString("url") == "" {
+			return nil, fmt.Errorf("please provide the path or url of the inventory")
+		}
+		return NewStaticProvider(config), nil
+	case "dns":
+		return NewDNSProvider(config), nil
 	default:
 		return nil, fmt.Errorf("unsupported provider: %s", config.GetString("type"))
 	}
 }
+
+// RegionErrors is returned along with the machines of a sync if some
+// regions failed, e.g. an offline Proxmox node. Machines in the failed
+// regions are kept as they are.
+type RegionErrors map[string]error
+
+func (e RegionErrors) Error() string {
+	regions := make([]string, 0, len(e))
+	for region := range e {
+		regions = append(regions, region)
+	}
+	slices.Sort(regions)
+	parts := make([]string, 0, len(regions))
+	for _, region := range regions {
+		parts = append(parts, fmt.Sprintf("%s: %v", region, e[region]))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,60 @@
+package provider
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/pocketbase/pocketbase/models/schema"
+)
+
+// testConfig returns a provider record with the given fields
+func testConfig(t *testing.T, fields map[string]any) *models.Record {
+	t.Helper()
+	collection := &models.Collection{Name: "providers"}
+	for _, name := range []string{"name", "type", "url", "username", "password", "token"} {
+		collection.Schema.AddField(&schema.SchemaField{Name: name, Type: schema.FieldTypeText})
+	}
+	collection.Schema.AddField(&schema.SchemaField{Name: "options", Type: schema.FieldTypeJson})
+	collection.Schema.AddField(&schema.SchemaField{Name: "filters", Type: schema.FieldTypeJson})
+	collection.Schema.AddField(&schema.SchemaField{Name: "label_rules", Type: schema.FieldTypeJson})
+
+	config := models.NewRecord(collection)
+	for name, value := range fields {
+		if name == "options" || name == "filters" || name == "label_rules" {
+			raw, err := json.Marshal(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value = string(raw)
+		}
+		config.Set(name, value)
+	}
+	return config
+}
+
+func TestPickAddress(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		preference string
+		public     string
+		private    string
+		want       string
+	}{
+		{name: "Public by default", public: "1.2.3.4", private: "10.0.0.1", want: "1.2.3.4"},
+		{name: "Private", preference: AddressPrivate, public: "1.2.3.4", private: "10.0.0.1", want: "10.0.0.1"},
+		{name: "Private fallback", public: "", private: "10.0.0.1", want: "10.0.0.1"},
+		{name: "Public fallback", preference: AddressPrivate, public: "1.2.3.4", want: "1.2.3.4"},
+		{name: "None", preference: AddressPublic},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := pickAddress(tt.preference, tt.public, tt.private); got != tt.want {
+				t.Errorf("pickAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// libvirtRemoteSocket is the libvirt socket on hosts reached over ssh
+const libvirtRemoteSocket = "/var/run/libvirt/libvirt-sock"
+
+// Sources of guest addresses
+const (
+	LibvirtSourceAgent = "agent"
+	LibvirtSourceLease = "lease"
+	LibvirtSourceARP   = "arp"
+)
+
+// LibvirtProvider discovers libvirt domains. The url is a libvirt URI like
+// qemu:///system or qemu+ssh://user@host/system. Over ssh the token is a
+// PEM private key or the password is used, without either the keys and
+// known hosts of the server user are.
+type LibvirtProvider struct {
+	Config *models.Record
+}
+
+// LibvirtOptions are the options of a libvirt provider
+type LibvirtOptions struct {
+	// HostKey pins the ssh host key in authorized_keys format
+	HostKey string `json:"host_key"`
+	// Insecure skips the verification of the ssh host key
+	Insecure bool `json:"insecure"`
+	// Sources of the guest addresses in order, agent and lease by default
+	Sources []string `json:"sources"`
+	// Networks are CIDRs or interfaces in order of preference for the host
+	Networks []string `json:"networks"`
+	// IPv6 prefers IPv6 over IPv4 addresses
+	IPv6 bool `json:"ipv6"`
+}
+
+// libvirtClient is the part of the libvirt API the provider uses
+type libvirtClient interface {
+	ConnectListAllDomains(NeedResults int32, Flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error)
+	DomainGetState(Dom libvirt.Domain, Flags uint32) (int32, int32, error)
+	DomainInterfaceAddresses(Dom libvirt.Domain, Source uint32, Flags uint32) ([]libvirt.DomainInterface, error)
+}
+
+func NewLibvirtProvider(config *models.Record) *LibvirtProvider {
+	return &LibvirtProvider{Config: config}
+}
+
+func (p *LibvirtProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+	var opts LibvirtOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	uri, err := url.Parse(p.Config.GetString("url"))
+	if err != nil {
+		return nil, err
+	}
+
+	var l *libvirt.Libvirt
+	key, password := p.Config.GetString("token"), p.Config.GetString("password")
+	if strings.HasSuffix(uri.Scheme, "+ssh") && (key != "" || password != "") {
+		dialer, err := newLibvirtSSHDialer(uri, p.Config.GetString("username"), key, password, opts)
+		if err != nil {
+			return nil, err
+		}
+		l = libvirt.NewWithDialer(dialer)
+		if err := l.ConnectToURI(libvirt.RemoteURI(uri)); err != nil {
+			return nil, fmt.Errorf("failed to connect to libvirt: %w", err)
+		}
+	} else if l, err = libvirt.ConnectToURI(uri); err != nil {
+		return nil, err
+	}
+	defer func() { _ = l.Disconnect() }()
+	// The libvirt calls don't take a context, a closed connection fails them
+	stop := context.AfterFunc(ctx, func() { _ = l.Disconnect() })
+	defer stop()
+
+	return libvirtMachines(l, uri.Hostname(), opts)
+}
+
+// libvirtMachines lists the domains with their state and addresses, the
+// first source which knows addresses of a domain is used
+func libvirtMachines(l libvirtClient, region string, opts LibvirtOptions) ([]ProviderMachine, error) {
+	sources := opts.Sources
+	if len(sources) == 0 {
+		sources = []string{LibvirtSourceAgent, LibvirtSourceLease}
+	}
+	var sourceIDs []libvirt.DomainInterfaceAddressesSource
+	for _, source := range sources {
+		switch source {
+		case LibvirtSourceAgent:
+			sourceIDs = append(sourceIDs, libvirt.DomainInterfaceAddressesSrcAgent)
+		case LibvirtSourceLease:
+			sourceIDs = append(sourceIDs, libvirt.DomainInterfaceAddressesSrcLease)
+		case LibvirtSourceARP:
+			sourceIDs = append(sourceIDs, libvirt.DomainInterfaceAddressesSrcArp)
+		default:
+			return nil, fmt.Errorf("unknown address source %q, expected agent, lease or arp", source)
+		}
+	}
+
+	domains, _, err := l.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return nil, err
+	}
+	machines := make([]ProviderMachine, 0, len(domains))
+	for _, domain := range domains {
+		state, _, err := l.DomainGetState(domain, 0)
+		if err != nil {
+			return nil, fmt.Errorf("domain %s: %w", domain.Name, err)
+		}
+		machine := ProviderMachine{
+			ID:      libvirtUUID(domain.UUID),
+			Name:    domain.Name,
+			Running: libvirt.DomainState(state) == libvirt.DomainRunning,
+			Region:  region,
+		}
+		// Stopped domains have no addresses to ask for
+		for _, source := range sourceIDs {
+			if !machine.Running {
+				break
+			}
+			ifaces, err := l.DomainInterfaceAddresses(domain, uint32(source), 0)
+			if err != nil {
+				// Mostly domains without a running agent
+				slog.Debug("Failed to get libvirt domain addresses",
+					"domain", domain.Name, "source", source, "err", err)
+				continue
+			}
+			var addresses []guestAddress
+			for _, iface := range ifaces {
+				for _, addr := range iface.Addrs {
+					if ip, err := netip.ParseAddr(addr.Addr); err == nil {
+						addresses = append(addresses, guestAddress{IP: ip, Network: iface.Name})
+					}
+				}
+			}
+			if host := pickGuestAddress(addresses, opts.Networks, opts.IPv6); host != "" {
+				machine.Host = host
+				break
+			}
+		}
+		machines = append(machines, machine)
+	}
+	return machines, nil
+}
+
+func libvirtUUID(uuid libvirt.UUID) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
+
+// libvirtSSHDialer connects to the libvirt socket of a host over ssh with
+// the credentials of the provider
+type libvirtSSHDialer struct {
+	address string
+	socket  string
+	config  *ssh.ClientConfig
+}
+
+func newLibvirtSSHDialer(uri *url.URL, username, key, password string, opts LibvirtOptions) (*libvirtSSHDialer, error) {
+	if name := uri.User.Username(); name != "" {
+		username = name
+	}
+	if username == "" {
+		username = "root"
+	}
+	config := &ssh.ClientConfig{User: username, Timeout: requestTimeout}
+	if key != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %w", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if password != "" {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	switch {
+	case opts.HostKey != "":
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key: %w", err)
+		}
+		config.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	case opts.Insecure:
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("please provide the host key of the libvirt host")
+	}
+
+	port := uri.Port()
+	if port == "" {
+		port = "22"
+	}
+	socket := uri.Query().Get("socket")
+	if socket == "" {
+		socket = libvirtRemoteSocket
+	}
+	return &libvirtSSHDialer{
+		address: net.JoinHostPort(uri.Hostname(), port),
+		socket:  socket,
+		config:  config,
+	}, nil
+}
+
+func (d *libvirtSSHDialer) Dial() (net.Conn, error) {
+	client, err := ssh.Dial("tcp", d.address, d.config)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := client.Dial("unix", d.socket)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &sshConn{Conn: conn, client: client}, nil
+}
+
+// sshConn closes the ssh client with the forwarded connection
+type sshConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *sshConn) Close() error {
+	err := c.Conn.Close()
+	_ = c.client.Close()
+	return err
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// fakeLibvirt answers with fixed domains and addresses per source
+type fakeLibvirt struct {
+	domains   []libvirt.Domain
+	states    map[string]libvirt.DomainState
+	addresses map[string]map[libvirt.DomainInterfaceAddressesSource][]libvirt.DomainInterface
+}
+
+func (f *fakeLibvirt) ConnectListAllDomains(int32, libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+	return f.domains, uint32(len(f.domains)), nil
+}
+
+func (f *fakeLibvirt) DomainGetState(dom libvirt.Domain, _ uint32) (int32, int32, error) {
+	return int32(f.states[dom.Name]), 0, nil
+}
+
+func (f *fakeLibvirt) DomainInterfaceAddresses(dom libvirt.Domain, source uint32, _ uint32) ([]libvirt.DomainInterface, error) {
+	ifaces, ok := f.addresses[dom.Name][libvirt.DomainInterfaceAddressesSource(source)]
+	if !ok {
+		return nil, fmt.Errorf("guest agent is not responding")
+	}
+	return ifaces, nil
+}
+
+func TestLibvirtMachines(t *testing.T) {
+	t.Parallel()
+	iface := func(name string, addrs ...string) libvirt.DomainInterface {
+		iface := libvirt.DomainInterface{Name: name}
+		for _, addr := range addrs {
+			iface.Addrs = append(iface.Addrs, libvirt.DomainIPAddr{Addr: addr})
+		}
+		return iface
+	}
+	client := &fakeLibvirt{
+		domains: []libvirt.Domain{
+			{Name: "web", UUID: libvirt.UUID{0x6b, 0x1a, 0x2c, 0x4e, 15: 1}},
+			{Name: "db", UUID: libvirt.UUID{0x6b, 0x1a, 0x2c, 0x4e, 15: 2}},
+			{Name: "off", UUID: libvirt.UUID{0x6b, 0x1a, 0x2c, 0x4e, 15: 3}},
+		},
+		states: map[string]libvirt.DomainState{
+			"web": libvirt.DomainRunning,
+			"db":  libvirt.DomainRunning,
+			"off": libvirt.DomainShutoff,
+		},
+		addresses: map[string]map[libvirt.DomainInterfaceAddressesSource][]libvirt.DomainInterface{
+			"web": {
+				libvirt.DomainInterfaceAddressesSrcAgent: {
+					iface("lo", "127.0.0.1"),
+					iface("eth0", "fe80::1", "192.168.122.10"),
+					iface("eth1", "10.0.0.10"),
+				},
+				libvirt.DomainInterfaceAddressesSrcLease: {iface("vnet0", "192.168.122.10")},
+			},
+			// No agent, only a DHCP lease
+			"db": {
+				libvirt.DomainInterfaceAddressesSrcLease: {iface("vnet1", "192.168.122.11")},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		opts    LibvirtOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "Agent and leases", want: []string{"192.168.122.10", "192.168.122.11", ""}},
+		{name: "Networks", opts: LibvirtOptions{Networks: []string{"10.0.0.0/8"}}, want: []string{"10.0.0.10", "192.168.122.11", ""}},
+		{name: "Agent only", opts: LibvirtOptions{Sources: []string{"agent"}}, want: []string{"192.168.122.10", "", ""}},
+		{name: "Unknown source", opts: LibvirtOptions{Sources: []string{"dns"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := libvirtMachines(client, "kvm1", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("libvirtMachines() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var hosts []string
+			for _, machine := range got {
+				hosts = append(hosts, machine.Host)
+			}
+			if !reflect.DeepEqual(hosts, tt.want) {
+				t.Errorf("libvirtMachines() hosts = %v, want %v", hosts, tt.want)
+			}
+			web := ProviderMachine{
+				ID:      "6b1a2c4e-0000-0000-0000-000000000001",
+				Name:    "web",
+				Host:    tt.want[0],
+				Running: true,
+				Region:  "kvm1",
+			}
+			if !reflect.DeepEqual(got[0], web) || got[2].Running {
+				t.Errorf("libvirtMachines() = %+v, want %+v first and the last stopped", got, web)
+			}
+		})
+	}
+}
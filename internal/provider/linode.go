@@ -21,8 +21,7 @@ func NewLinodeProvider(config *models.Record) *LinodeProvider {
 }
 
 // Sync returns a list of machines
-func (p *LinodeProvider) Sync() ([]ProviderMachine, error) {
-	ctx := context.Background()
+func (p *LinodeProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
 
 	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: p.Config.GetString("token")})
 	oauth2Client := &http.Client{
@@ -44,6 +43,8 @@ func (p *LinodeProvider) Sync() ([]ProviderMachine, error) {
 			Host:    string(*instance.IPv4[0]),
 			Name:    instance.Label,
 			Running: instance.Status == "running",
+			Region:  instance.Region,
+			Labels:  tagLabels(instance.Tags),
 		}
 		machines = append(machines, machine)
 	}
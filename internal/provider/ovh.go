@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+const ovhURL = "https://eu.api.ovh.com/1.0"
+
+// OVHProvider discovers Public Cloud instances, the username is the
+// application key, the password the application secret and the token the
+// consumer key
+type OVHProvider struct {
+	Config *models.Record
+}
+
+// OVHOptions are the options of an OVHcloud provider
+type OVHOptions struct {
+	// Projects to search, all projects if empty
+	Projects []string `json:"projects"`
+	// Address is either public or private, public by default
+	Address string `json:"address"`
+}
+
+func NewOVHProvider(config *models.Record) *OVHProvider {
+	return &OVHProvider{Config: config}
+}
+
+type ovhInstance struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Region      string `json:"region"`
+	IPAddresses []struct {
+		IP      string `json:"ip"`
+		Type    string `json:"type"`
+		Version int    `json:"version"`
+	} `json:"ipAddresses"`
+}
+
+// ovhTransport signs requests with the application secret and consumer key
+type ovhTransport struct {
+	applicationKey    string
+	applicationSecret string
+	consumerKey       string
+	// delta is the offset of the API clock
+	delta time.Duration
+}
+
+func (t *ovhTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	timestamp := strconv.FormatInt(time.Now().Add(t.delta).Unix(), 10)
+	// Only GET requests without a body are sent
+	sum := sha1.Sum([]byte(strings.Join([]string{
+		t.applicationSecret, t.consumerKey, req.Method, req.URL.String(), "", timestamp,
+	}, "+")))
+	req.Header.Set("X-Ovh-Application", t.applicationKey)
+	req.Header.Set("X-Ovh-Consumer", t.consumerKey)
+	req.Header.Set("X-Ovh-Timestamp", timestamp)
+	req.Header.Set("X-Ovh-Signature", "$1$"+hex.EncodeToString(sum[:]))
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (p *OVHProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts OVHOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimSuffix(p.Config.GetString("url"), "/")
+	if baseURL == "" {
+		baseURL = ovhURL
+	}
+
+	// Signatures use the clock of the API
+	var serverTime int64
+	if err := getJSON(ctx, http.DefaultClient, baseURL+"/auth/time", &serverTime); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Transport: &ovhTransport{
+		applicationKey:    p.Config.GetString("username"),
+		applicationSecret: p.Config.GetString("password"),
+		consumerKey:       p.Config.GetString("token"),
+		delta:             time.Until(time.Unix(serverTime, 0)),
+	}}
+
+	projects := opts.Projects
+	if len(projects) == 0 {
+		if err := getJSON(ctx, client, baseURL+"/cloud/project", &projects); err != nil {
+			return nil, err
+		}
+	}
+
+	var machines []ProviderMachine
+	for _, project := range projects {
+		var instances []ovhInstance
+		err := getJSON(ctx, client, fmt.Sprintf(
+			"%s/cloud/project/%s/instance", baseURL, url.PathEscape(project),
+		), &instances)
+		if err != nil {
+			return nil, fmt.Errorf("project %s: %w", project, err)
+		}
+		for _, instance := range instances {
+			var public, private string
+			for _, ip := range instance.IPAddresses {
+				if ip.Version != 4 {
+					continue
+				}
+				switch {
+				case ip.Type == "public" && public == "":
+					public = ip.IP
+				case ip.Type == "private" && private == "":
+					private = ip.IP
+				}
+			}
+			machines = append(machines, ProviderMachine{
+				ID:      instance.ID,
+				Name:    instance.Name,
+				Host:    pickAddress(opts.Address, public, private),
+				Running: instance.Status == "ACTIVE",
+				Region:  instance.Region,
+			})
+		}
+	}
+	return machines, nil
+}
@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOVHProviderSync(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply := func(v any) {
+			if err := json.NewEncoder(w).Encode(v); err != nil {
+				t.Error(err)
+			}
+		}
+		if r.URL.Path == "/1.0/auth/time" {
+			reply(time.Now().Add(time.Hour).Unix())
+			return
+		}
+
+		// Check the signature like the API does
+		timestamp := r.Header.Get("X-Ovh-Timestamp")
+		sum := sha1.Sum([]byte(strings.Join([]string{
+			"app-secret", r.Header.Get("X-Ovh-Consumer"), r.Method, server.URL + r.URL.RequestURI(), "", timestamp,
+		}, "+")))
+		if r.Header.Get("X-Ovh-Application") != "app-key" ||
+			r.Header.Get("X-Ovh-Signature") != "$1$"+hex.EncodeToString(sum[:]) {
+			http.Error(w, `{"message":"Invalid signature"}`, http.StatusBadRequest)
+			return
+		}
+		seconds, _ := strconv.ParseInt(timestamp, 10, 64)
+		if skew := time.Until(time.Unix(seconds, 0)); skew < 50*time.Minute {
+			http.Error(w, `{"message":"Invalid timestamp"}`, http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/1.0/cloud/project":
+			reply([]string{"project-1"})
+		case "/1.0/cloud/project/project-1/instance":
+			reply([]any{
+				map[string]any{"id": "i-1", "name": "web", "status": "ACTIVE", "ipAddresses": []any{
+					map[string]any{"ip": "2001:db8::1", "type": "public", "version": 6},
+					map[string]any{"ip": "192.168.0.10", "type": "private", "version": 4},
+					map[string]any{"ip": "57.128.0.1", "type": "public", "version": 4},
+				}},
+				map[string]any{"id": "i-2", "name": "db", "status": "SHUTOFF", "ipAddresses": []any{
+					map[string]any{"ip": "192.168.0.11", "type": "private", "version": 4},
+				}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		secret  string
+		address string
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{
+			name:   "Public addresses",
+			secret: "app-secret",
+			want: []ProviderMachine{
+				{ID: "i-1", Name: "web", Host: "57.128.0.1", Running: true},
+				{ID: "i-2", Name: "db", Host: "192.168.0.11"},
+			},
+		},
+		{
+			name:    "Private addresses",
+			secret:  "app-secret",
+			address: AddressPrivate,
+			want: []ProviderMachine{
+				{ID: "i-1", Name: "web", Host: "192.168.0.10", Running: true},
+				{ID: "i-2", Name: "db", Host: "192.168.0.11"},
+			},
+		},
+		{name: "Invalid secret", secret: "wrong", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":     "ovh",
+				"url":      server.URL + "/1.0",
+				"username": "app-key",
+				"password": tt.secret,
+				"token":    "consumer-key",
+				"options":  map[string]any{"address": tt.address},
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
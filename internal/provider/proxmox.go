@@ -1,13 +1,16 @@
 package provider
 
 import (
+	"cmp"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -15,32 +18,81 @@ import (
 	"github.com/pocketbase/pocketbase/models"
 )
 
+// proxmoxDefaultPort is used if neither the url nor the options have a port
+const proxmoxDefaultPort = 8006
+
 type ContainerInterface struct {
 	Hwaddr string `json:"hwaddr,omitempty"`
 	Name   string `json:"name,omitempty"`
 	Inet   string `json:"inet,omitempty"`
 	Inet6  string `json:"inet6,omitempty"`
+	// IPAddresses lists every address on newer Proxmox versions
+	IPAddresses []proxmoxIPAddress `json:"ip-addresses,omitempty"`
 }
 
 type ProxmoxProvider struct {
 	Config *models.Record
 }
 
+// ProxmoxOptions are the options of a Proxmox provider
+type ProxmoxOptions struct {
+	// Port of the API if the url has none, 8006 by default
+	Port int `json:"port"`
+	// CACert is a PEM bundle the API certificate is verified against
+	CACert string `json:"ca_cert"`
+	// Fingerprint pins the SHA-256 fingerprint of the API certificate
+	Fingerprint string `json:"fingerprint"`
+	// Insecure skips the verification of the API certificate
+	Insecure bool `json:"insecure"`
+	// Networks are CIDRs or bridges in order of preference for the host
+	Networks []string `json:"networks"`
+	// IPv6 prefers IPv6 over IPv4 addresses
+	IPv6 bool `json:"ipv6"`
+}
+
 func NewProxmoxProvider(config *models.Record) *ProxmoxProvider {
 	return &ProxmoxProvider{Config: config}
 }
 
-func (p *ProxmoxProvider) Sync() ([]ProviderMachine, error) {
-	ctx := context.Background()
+type proxmoxIPAddress struct {
+	Type    string `json:"ip-address-type"`
+	Address string `json:"ip-address"`
+	Prefix  int    `json:"prefix"`
+}
+
+type proxmoxAgentInterface struct {
+	Name            string             `json:"name"`
+	HardwareAddress string             `json:"hardware-address"`
+	IPAddresses     []proxmoxIPAddress `json:"ip-addresses"`
+}
+
+// proxmoxNIC is a network device of a guest config
+type proxmoxNIC struct {
+	MAC    string
+	Bridge string
+}
+
+func (p *ProxmoxProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var options ProxmoxOptions
+	if err := decodeOptions(p.Config, &options); err != nil {
+		return nil, err
+	}
+	baseURL, err := proxmoxURL(p.Config.GetString("url"), options.Port)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := newTLSConfig(options.CACert, options.Fingerprint, options.Insecure)
+	if err != nil {
+		return nil, err
+	}
 
 	opts := []proxmox.Option{
 		proxmox.WithHTTPClient(&http.Client{
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-			},
+			Timeout:   requestTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
 		}),
 	}
-
 	if p.Config.GetString("token") != "" {
 		opts = append(opts, proxmox.WithAPIToken(
 			p.Config.GetString("username"),
@@ -52,189 +104,180 @@ func (p *ProxmoxProvider) Sync() ([]ProviderMachine, error) {
 			Password: p.Config.GetString("password"),
 		}))
 	}
+	client := proxmox.NewClient(baseURL, opts...)
 
-	u, err := url.Parse(p.Config.GetString("url"))
-	if err != nil {
+	var resources proxmox.ClusterResources
+	if err := client.Get(ctx, "/cluster/resources", &resources); err != nil {
 		return nil, err
 	}
 
-	url := p.Config.GetString("url")
-	if u.Scheme == "" {
-		url = "https://" + url
-	}
-
-	client := proxmox.NewClient(fmt.Sprintf("%s:8006/api2/json", url), opts...)
-	cluster, err := client.Cluster(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	resources, err := cluster.Resources(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	// We're only interested in VMs & Containers, sorted by node name
-	sorted := make(map[string]proxmox.ClusterResources)
+	// Requests for guests are proxied by the node we're talking to, so a
+	// node which is down only fails its own guests
+	nodeErrors := make(RegionErrors)
 	for _, resource := range resources {
-		if slices.Contains([]string{"qemu", "lxc"}, resource.Type) && resource.Template == 0 {
-			sorted[resource.Node] = append(sorted[resource.Node], resource)
+		if resource.Type == "node" && resource.Status != "online" {
+			nodeErrors[resource.Node] = fmt.Errorf("node is %s", cmp.Or(resource.Status, "unknown"))
 		}
 	}
 
-	// Since we need info from every node in a cluster we need to create multiple clients
-	// Rather chaotic way of fetching machines, but here the info to get the ip
-	// from a vm is fetched by the qemu agent and for lxc containers it's from the config
 	var machines []ProviderMachine
-	for node, resource := range sorted {
-		nodeClient, err := getNodeClient(ctx, client, opts, node)
-		if err != nil {
-			slog.Error("Failed to get node client", "Error", err)
+	for _, r := range resources {
+		if !slices.Contains([]string{"qemu", "lxc"}, r.Type) || r.Template != 0 {
 			continue
 		}
-
-		nodeInfo, err := nodeClient.Node(ctx, node)
-		if err != nil {
-			slog.Error("Failed to get node info", "Error", err)
+		if _, ok := nodeErrors[r.Node]; ok {
 			continue
 		}
 
-		vms, _ := nodeInfo.VirtualMachines(ctx)
-		for _, vm := range vms {
-			if proxmox.IsTemplate(vm.Template) {
-				continue
-			}
-			ip, err := getVMHost(ctx, nodeClient, vm, node)
-			if err != nil {
-				slog.Error("Failed to get vm host", "Error", err)
-				continue
-			}
-
-			machine := ProviderMachine{
-				ID:      strconv.Itoa(int(vm.VMID)),
-				Name:    vm.Name,
-				Host:    ip,
-				Running: ip != "" && vm.Status == "running",
-			}
-			machines = append(machines, machine)
+		machine := ProviderMachine{
+			ID:      strconv.FormatUint(r.VMID, 10),
+			Name:    r.Name,
+			Running: r.Status == "running",
+			Region:  r.Node,
+			Labels:  tagLabels(strings.Split(r.Tags, ";")),
 		}
-
-		for _, r := range resource {
-			if r.Type != "lxc" {
-				continue
-			}
-			ip, err := getContainerHost(ctx, nodeClient, node, int(r.VMID))
+		// Stopped guests have no addresses to ask for
+		if machine.Running {
+			addresses, err := proxmoxAddresses(ctx, client, r)
 			if err != nil {
-				slog.Error("Failed to get container host", "Error", err)
-				continue
-			}
-
-			machine := ProviderMachine{
-				ID:      strconv.Itoa(int(r.VMID)),
-				Name:    r.Name,
-				Host:    ip,
-				Running: ip != "" && r.Status == "running",
+				// Mostly guests without a running agent, they keep their host
+				slog.Warn("Failed to get proxmox guest addresses",
+					"node", r.Node, "vmid", r.VMID, "err", err)
 			}
-			machines = append(machines, machine)
+			machine.Host = pickGuestAddress(addresses, options.Networks, options.IPv6)
 		}
+		machines = append(machines, machine)
 	}
 
+	if len(nodeErrors) > 0 {
+		return machines, nodeErrors
+	}
 	return machines, nil
 }
 
-func getNodeClient(
-	ctx context.Context,
-	client *proxmox.Client,
-	opts []proxmox.Option,
-	node string,
-) (*proxmox.Client, error) {
-	var network []struct {
-		Address string `json:"address,omitempty"`
-		Gateway string `json:"gateway,omitempty"`
-		Iface   string `json:"iface,omitempty"`
-		Netmask string `json:"netmask,omitempty"`
-		Type    string `json:"type,omitempty"`
-	}
-
-	err := client.Get(ctx, fmt.Sprintf("/nodes/%s/network", node), &network)
+// proxmoxURL adds the scheme, port and API path to the url of a provider
+func proxmoxURL(raw string, port int) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", fmt.Errorf("please provide the url of the proxmox api")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+	u, err := url.Parse(raw)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-
-	for _, net := range network {
-		if net.Address != "" {
-			return proxmox.NewClient(
-				fmt.Sprintf("https://%s:8006/api2/json", net.Address),
-				opts...), nil
+	if u.Port() == "" {
+		if port == 0 {
+			port = proxmoxDefaultPort
 		}
+		u.Host = net.JoinHostPort(u.Hostname(), strconv.Itoa(port))
 	}
-
-	return nil, nil
+	u.Path = "/api2/json"
+	return u.String(), nil
 }
 
-func getVMHost(
+// proxmoxAddresses returns the addresses of a guest in the order of its
+// network devices. VMs report them by the qemu agent, containers by lxc.
+func proxmoxAddresses(
 	ctx context.Context,
 	client *proxmox.Client,
-	vm *proxmox.VirtualMachine,
-	node string,
-) (string, error) {
-	ifaces, err := vm.AgentGetNetworkIFaces(ctx)
-	if err != nil {
-		return "", err
-	}
-	if len(ifaces) == 0 {
-		return "", nil
-	}
+	r *proxmox.ClusterResource,
+) ([]guestAddress, error) {
+	guestPath := fmt.Sprintf("/nodes/%s/%s/%d", url.PathEscape(r.Node), r.Type, r.VMID)
 
-	var data map[string]any
-	err = client.Get(ctx, fmt.Sprintf("/nodes/%s/qemu/%d/config", node, vm.VMID), &data)
-	if err != nil {
-		return "", err
+	var config map[string]any
+	if err := client.Get(ctx, guestPath+"/config", &config); err != nil {
+		return nil, err
 	}
+	nics := proxmoxNICs(config)
 
-	// We need to compare the mac address of the virtio interface to the one
-	// provided by the qemu agent
-	var macAddr string
-	for k, v := range data {
-		if strings.HasPrefix(k, "net") {
-			parts := strings.Split(v.(string), ",")
-			macAddr = strings.TrimPrefix(parts[0], "virtio=")
-			break
+	type guestInterface struct {
+		mac       string
+		addresses []string
+	}
+	var ifaces []guestInterface
+	if r.Type == "qemu" {
+		var result struct {
+			Result []proxmoxAgentInterface `json:"result"`
+		}
+		err := client.Get(ctx, guestPath+"/agent/network-get-interfaces", &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, iface := range result.Result {
+			var addresses []string
+			for _, ip := range iface.IPAddresses {
+				addresses = append(addresses, ip.Address)
+			}
+			ifaces = append(ifaces, guestInterface{mac: iface.HardwareAddress, addresses: addresses})
+		}
+	} else {
+		var result []ContainerInterface
+		if err := client.Get(ctx, guestPath+"/interfaces", &result); err != nil {
+			return nil, err
+		}
+		for _, iface := range result {
+			addresses := []string{iface.Inet, iface.Inet6}
+			for _, ip := range iface.IPAddresses {
+				addresses = append(addresses, ip.Address)
+			}
+			ifaces = append(ifaces, guestInterface{mac: iface.Hwaddr, addresses: addresses})
 		}
 	}
 
-	for _, iface := range ifaces {
-		if iface.HardwareAddress == strings.ToLower(macAddr) {
-			for _, ip := range iface.IPAddresses {
-				if ip.IPAddressType == "ipv4" {
-					return strings.Split(ip.IPAddress, "/")[0], nil
+	// Interfaces inside the guest without a device, like docker bridges,
+	// are skipped
+	var addresses []guestAddress
+	for _, nic := range nics {
+		for _, iface := range ifaces {
+			if !strings.EqualFold(iface.mac, nic.MAC) {
+				continue
+			}
+			for _, raw := range iface.addresses {
+				ip, err := netip.ParseAddr(strings.Split(raw, "/")[0])
+				if err != nil || slices.ContainsFunc(addresses, func(a guestAddress) bool { return a.IP == ip }) {
+					continue
 				}
+				addresses = append(addresses, guestAddress{IP: ip, Network: nic.Bridge})
 			}
 		}
 	}
-
-	return "", nil
+	return addresses, nil
 }
 
-// Attempt to get first ip address in the list
-// TODO: Maybe handle multiple ip addresses
-func getContainerHost(
-	ctx context.Context,
-	client *proxmox.Client,
-	node string,
-	vmid int,
-) (string, error) {
-	var data []ContainerInterface
-	err := client.Get(ctx, fmt.Sprintf("/nodes/%s/lxc/%d/interfaces", node, vmid), &data)
-	if err != nil {
-		return "", err
+// proxmoxNICs reads the network devices of a guest config in order, e.g.
+// net0: virtio=BC:24:11:2C:69:EC,bridge=vmbr0 for VMs of any model or
+// net0: name=eth0,bridge=vmbr0,hwaddr=BC:24:11:2C:69:EC for containers
+func proxmoxNICs(config map[string]any) []proxmoxNIC {
+	var keys []string
+	for key := range config {
+		if _, err := strconv.Atoi(strings.TrimPrefix(key, "net")); err == nil && strings.HasPrefix(key, "net") {
+			keys = append(keys, key)
+		}
 	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(keys[i], "net"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(keys[j], "net"))
+		return a < b
+	})
 
-	for _, iface := range data {
-		if iface.Inet == "" || strings.Contains(iface.Inet, "127.0.0.1") {
-			continue
+	var nics []proxmoxNIC
+	for _, key := range keys {
+		value, _ := config[key].(string)
+		var nic proxmoxNIC
+		for _, part := range strings.Split(value, ",") {
+			k, v, _ := strings.Cut(part, "=")
+			if k == "bridge" {
+				nic.Bridge = v
+			} else if _, err := net.ParseMAC(v); err == nil && nic.MAC == "" {
+				nic.MAC = v
+			}
+		}
+		if nic.MAC != "" {
+			nics = append(nics, nic)
 		}
-		return strings.Split(iface.Inet, "/")[0], nil
 	}
-	return "", nil
+	return nics
 }
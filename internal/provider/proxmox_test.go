@@ -0,0 +1,185 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProxmoxProviderSync(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "PVEAPIToken=root@pam!nexus=secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reply := func(v any) {
+			if err := json.NewEncoder(w).Encode(map[string]any{"data": v}); err != nil {
+				t.Error(err)
+			}
+		}
+		switch r.URL.Path {
+		case "/api2/json/cluster/resources":
+			reply([]any{
+				map[string]any{"type": "node", "node": "pve1", "status": "online"},
+				map[string]any{"type": "node", "node": "pve2", "status": "offline"},
+				map[string]any{"type": "qemu", "node": "pve1", "vmid": 100, "name": "web", "status": "running", "tags": "prod;web"},
+				map[string]any{"type": "qemu", "node": "pve1", "vmid": 101, "name": "template", "template": 1},
+				map[string]any{"type": "qemu", "node": "pve1", "vmid": 102, "name": "stopped", "status": "stopped"},
+				map[string]any{"type": "lxc", "node": "pve1", "vmid": 200, "name": "dns", "status": "running"},
+				map[string]any{"type": "qemu", "node": "pve2", "vmid": 300, "name": "lost", "status": "unknown"},
+			})
+		case "/api2/json/nodes/pve1/qemu/100/config":
+			reply(map[string]any{
+				"name": "web",
+				"net0": "e1000=BC:24:11:00:00:01,bridge=vmbr0",
+				"net1": "virtio=BC:24:11:00:00:02,bridge=vmbr1,firewall=1",
+			})
+		case "/api2/json/nodes/pve1/qemu/100/agent/network-get-interfaces":
+			reply(map[string]any{"result": []any{
+				map[string]any{"name": "lo", "hardware-address": "00:00:00:00:00:00", "ip-addresses": []any{
+					map[string]any{"ip-address-type": "ipv4", "ip-address": "127.0.0.1", "prefix": 8},
+				}},
+				map[string]any{"name": "ens18", "hardware-address": "bc:24:11:00:00:01", "ip-addresses": []any{
+					map[string]any{"ip-address-type": "ipv6", "ip-address": "fe80::1", "prefix": 64},
+					map[string]any{"ip-address-type": "ipv6", "ip-address": "2001:db8::100", "prefix": 64},
+					map[string]any{"ip-address-type": "ipv4", "ip-address": "192.168.1.100", "prefix": 24},
+				}},
+				map[string]any{"name": "ens19", "hardware-address": "bc:24:11:00:00:02", "ip-addresses": []any{
+					map[string]any{"ip-address-type": "ipv4", "ip-address": "10.10.0.100", "prefix": 24},
+				}},
+				map[string]any{"name": "docker0", "hardware-address": "02:42:00:00:00:01", "ip-addresses": []any{
+					map[string]any{"ip-address-type": "ipv4", "ip-address": "172.17.0.1", "prefix": 16},
+				}},
+			}})
+		case "/api2/json/nodes/pve1/lxc/200/config":
+			reply(map[string]any{
+				"net0": "name=eth0,bridge=vmbr0,hwaddr=BC:24:11:00:02:00,ip=dhcp,type=veth",
+			})
+		case "/api2/json/nodes/pve1/lxc/200/interfaces":
+			reply([]any{
+				map[string]any{"name": "lo", "hwaddr": "00:00:00:00:00:00", "inet": "127.0.0.1/8"},
+				map[string]any{"name": "eth0", "hwaddr": "bc:24:11:00:02:00", "inet": "192.168.1.200/24", "inet6": "2001:db8::200/64"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := strings.ToUpper(fmt.Sprintf("%x", sum))
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+	nodeErrors := "pve2: node is offline"
+
+	tests := []struct {
+		name    string
+		options map[string]any
+		want    []string
+		wantErr string
+	}{
+		{
+			name:    "Fingerprint",
+			options: map[string]any{"fingerprint": fingerprint},
+			want:    []string{"192.168.1.100", "", "192.168.1.200"},
+			wantErr: nodeErrors,
+		},
+		{
+			name:    "CA bundle and networks",
+			options: map[string]any{"ca_cert": caCert, "networks": []string{"10.10.0.0/16", "vmbr0"}},
+			want:    []string{"10.10.0.100", "", "192.168.1.200"},
+			wantErr: nodeErrors,
+		},
+		{
+			name:    "IPv6",
+			options: map[string]any{"insecure": true, "ipv6": true},
+			want:    []string{"2001:db8::100", "", "2001:db8::200"},
+			wantErr: nodeErrors,
+		},
+		{
+			name:    "Unverified certificate",
+			options: map[string]any{},
+			wantErr: "certificate",
+		},
+		{
+			name:    "Wrong fingerprint",
+			options: map[string]any{"fingerprint": strings.Repeat("AB:", 31) + "AB"},
+			wantErr: "doesn't match",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":     "proxmox",
+				"url":      server.URL,
+				"username": "root@pam!nexus",
+				"token":    "secret",
+				"options":  tt.options,
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Sync() error = %v, want %q", err, tt.wantErr)
+			}
+			if tt.want == nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Sync() = %+v, want %d machines", got, len(tt.want))
+			}
+			for i, machine := range got {
+				if machine.Host != tt.want[i] {
+					t.Errorf("%s host = %q, want %q", machine.Name, machine.Host, tt.want[i])
+				}
+			}
+			web := ProviderMachine{
+				ID:      "100",
+				Name:    "web",
+				Host:    tt.want[0],
+				Running: true,
+				Region:  "pve1",
+				Labels:  map[string]string{"prod": "", "web": ""},
+			}
+			if !reflect.DeepEqual(got[0], web) {
+				t.Errorf("Sync() web = %+v, want %+v", got[0], web)
+			}
+		})
+	}
+}
+
+func TestProxmoxURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		url  string
+		port int
+		want string
+	}{
+		{url: "pve.example.com", want: "https://pve.example.com:8006/api2/json"},
+		{url: "https://pve.example.com", port: 443, want: "https://pve.example.com:443/api2/json"},
+		{url: "https://pve.example.com:8443/", port: 443, want: "https://pve.example.com:8443/api2/json"},
+		{url: "[2001:db8::1]", want: "https://[2001:db8::1]:8006/api2/json"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.url, func(t *testing.T) {
+			t.Parallel()
+			got, err := proxmoxURL(tt.url, tt.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("proxmoxURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// LabelRule assigns a tag or group to machines with a label. The label is
+// key=value or just a key, {value} in the tag or group is replaced with the
+// value of the label, e.g. {"label": "team", "group": "{value}"}.
+type LabelRule struct {
+	Label string `json:"label"`
+	Tag   string `json:"tag,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// NewLabelRules reads the label rules of a provider
+func NewLabelRules(config *models.Record) ([]LabelRule, error) {
+	var rules []LabelRule
+	raw := strings.TrimSpace(config.GetString("label_rules"))
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid label rules: %w", err)
+	}
+	for i, rule := range rules {
+		if strings.TrimSpace(rule.Label) == "" {
+			return nil, fmt.Errorf("label rule %d has no label", i+1)
+		}
+		if rule.Tag == "" && rule.Group == "" {
+			return nil, fmt.Errorf("label rule %d has neither a tag nor a group", i+1)
+		}
+	}
+	return rules, nil
+}
+
+// MapLabels returns the tags and groups the rules assign to the labels
+func MapLabels(rules []LabelRule, labels map[string]string) (tags, groups []string) {
+	for _, rule := range rules {
+		if !hasLabel(labels, rule.Label) {
+			continue
+		}
+		key, _, _ := strings.Cut(rule.Label, "=")
+		value := labels[strings.TrimSpace(key)]
+		if tag := expandRule(rule.Tag, value); tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+		if group := expandRule(rule.Group, value); group != "" && !slices.Contains(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	return tags, groups
+}
+
+// expandRule replaces {value}, rules with it are skipped for empty values
+func expandRule(name, value string) string {
+	if value == "" && strings.Contains(name, "{value}") {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(name, "{value}", value))
+}
@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMapLabels(t *testing.T) {
+	t.Parallel()
+	rules, err := NewLabelRules(testConfig(t, map[string]any{"label_rules": []LabelRule{
+		{Label: "env=prod", Tag: "prod"},
+		{Label: "team", Group: "{value}"},
+		{Label: "team", Tag: "team-{value}"},
+		{Label: "env=dev", Tag: "dev"},
+		{Label: "nexus", Tag: "prod"},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tags, groups := MapLabels(rules, map[string]string{"env": "prod", "team": "payments", "nexus": ""})
+	if want := []string{"prod", "team-payments"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("MapLabels() tags = %v, want %v", tags, want)
+	}
+	if want := []string{"payments"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("MapLabels() groups = %v, want %v", groups, want)
+	}
+
+	// Empty values don't assign anything named after them
+	tags, groups = MapLabels(rules, map[string]string{"team": ""})
+	if tags != nil || groups != nil {
+		t.Errorf("MapLabels() = %v, %v, want nothing", tags, groups)
+	}
+
+	for _, invalid := range []any{
+		[]LabelRule{{Tag: "prod"}},
+		[]LabelRule{{Label: "env"}},
+		map[string]string{"env": "prod"},
+	} {
+		if _, err := NewLabelRules(testConfig(t, map[string]any{"label_rules": invalid})); err == nil {
+			t.Errorf("NewLabelRules(%v) expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/models"
+)
+
+const scalewayURL = "https://api.scaleway.com"
+
+// scalewayZones are searched if the provider has no zones
+var scalewayZones = []string{
+	"fr-par-1", "fr-par-2", "fr-par-3",
+	"nl-ams-1", "nl-ams-2", "nl-ams-3",
+	"pl-waw-1", "pl-waw-2", "pl-waw-3",
+}
+
+// ScalewayProvider discovers instances with the secret key as token
+type ScalewayProvider struct {
+	Config *models.Record
+}
+
+// ScalewayOptions are the options of a Scaleway provider
+type ScalewayOptions struct {
+	// Zones to search, all zones if empty
+	Zones []string `json:"zones"`
+	// Address is either public or private, public by default
+	Address string `json:"address"`
+}
+
+func NewScalewayProvider(config *models.Record) *ScalewayProvider {
+	return &ScalewayProvider{Config: config}
+}
+
+type scalewayServer struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	State     string   `json:"state"`
+	Tags      []string `json:"tags"`
+	PrivateIP string   `json:"private_ip"`
+	PublicIP  *struct {
+		Address string `json:"address"`
+	} `json:"public_ip"`
+	PublicIPs []struct {
+		Address string `json:"address"`
+		Family  string `json:"family"`
+	} `json:"public_ips"`
+}
+
+func (p *ScalewayProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+
+	var opts ScalewayOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	zones := opts.Zones
+	if len(zones) == 0 {
+		zones = scalewayZones
+	}
+	baseURL := strings.TrimSuffix(p.Config.GetString("url"), "/")
+	if baseURL == "" {
+		baseURL = scalewayURL
+	}
+	client := tokenClient("X-Auth-Token", p.Config.GetString("token"))
+
+	var machines []ProviderMachine
+	for _, zone := range zones {
+		for page := 1; ; page++ {
+			var result struct {
+				Servers []scalewayServer `json:"servers"`
+			}
+			err := getJSON(ctx, client, fmt.Sprintf(
+				"%s/instance/v1/zones/%s/servers?per_page=100&page=%d",
+				baseURL, url.PathEscape(zone), page,
+			), &result)
+			if err != nil {
+				return nil, fmt.Errorf("zone %s: %w", zone, err)
+			}
+			for _, server := range result.Servers {
+				machines = append(machines, ProviderMachine{
+					ID:      server.ID,
+					Name:    server.Name,
+					Host:    pickAddress(opts.Address, scalewayPublicIP(server), server.PrivateIP),
+					Running: server.State == "running",
+					Region:  zone,
+					Labels:  tagLabels(server.Tags),
+				})
+			}
+			if len(result.Servers) < 100 {
+				break
+			}
+		}
+	}
+	return machines, nil
+}
+
+// scalewayPublicIP prefers IPv4 of the routed public IPs
+func scalewayPublicIP(server scalewayServer) string {
+	for _, ip := range server.PublicIPs {
+		if ip.Family == "inet" {
+			return ip.Address
+		}
+	}
+	if len(server.PublicIPs) > 0 {
+		return server.PublicIPs[0].Address
+	}
+	if server.PublicIP != nil {
+		return server.PublicIP.Address
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestScalewayProviderSync(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "scw-secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var servers []any
+		switch r.URL.Path {
+		case "/instance/v1/zones/fr-par-1/servers":
+			// A full first page makes the provider ask for the second
+			count := 100
+			if r.URL.Query().Get("page") == "2" {
+				count = 1
+			}
+			for i := 0; i < count; i++ {
+				servers = append(servers, map[string]any{
+					"id":         fmt.Sprintf("par-%s-%d", r.URL.Query().Get("page"), i),
+					"name":       "par",
+					"state":      "running",
+					"private_ip": "10.1.0.1",
+					"public_ips": []any{
+						map[string]any{"address": "2001:db8::1", "family": "inet6"},
+						map[string]any{"address": "51.15.0.1", "family": "inet"},
+					},
+				})
+			}
+		case "/instance/v1/zones/nl-ams-1/servers":
+			servers = []any{map[string]any{
+				"id":         "ams-1",
+				"name":       "ams",
+				"state":      "stopped",
+				"private_ip": "10.2.0.1",
+				"public_ip":  map[string]any{"address": "51.158.0.1"},
+			}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(map[string]any{"servers": servers}); err != nil {
+			t.Error(err)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := func(zones []string, address string) map[string]any {
+		return map[string]any{
+			"type":    "scaleway",
+			"url":     server.URL,
+			"token":   "scw-secret",
+			"options": map[string]any{"zones": zones, "address": address},
+		}
+	}
+
+	p, err := NewProvider(testConfig(t, config([]string{"fr-par-1", "nl-ams-1"}, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 102 {
+		t.Fatalf("Sync() found %d servers, want 102", len(got))
+	}
+	want := ProviderMachine{ID: "par-1-0", Name: "par", Host: "51.15.0.1", Running: true, Region: "fr-par-1"}
+	if !reflect.DeepEqual(got[0], want) {
+		t.Errorf("Sync()[0] = %+v, want %+v", got[0], want)
+	}
+	want = ProviderMachine{ID: "ams-1", Name: "ams", Host: "51.158.0.1", Region: "nl-ams-1"}
+	if !reflect.DeepEqual(got[101], want) {
+		t.Errorf("Sync()[101] = %+v, want %+v", got[101], want)
+	}
+
+	p, err = NewProvider(testConfig(t, config([]string{"nl-ams-1"}, AddressPrivate)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = p.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.Host = "10.2.0.1"
+	if !reflect.DeepEqual(got, []ProviderMachine{want}) {
+		t.Errorf("Sync() = %+v, want %+v", got, want)
+	}
+
+	// Zones without access fail the sync
+	p, err = NewProvider(testConfig(t, config([]string{"fr-par-9"}, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Sync(context.Background()); err == nil {
+		t.Error("Sync() expected an error for an unknown zone")
+	}
+}
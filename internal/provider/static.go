@@ -0,0 +1,165 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/inventory"
+	"github.com/pocketbase/pocketbase/models"
+	"gopkg.in/yaml.v3"
+)
+
+// staticMaxSize limits the size of an inventory
+const staticMaxSize = 10 << 20
+
+// StaticProvider reads machines from an inventory file or URL, the url is
+// a path or an http(s) URL and the token an optional bearer token for it
+type StaticProvider struct {
+	Config *models.Record
+}
+
+// StaticOptions are the options of a static provider
+type StaticOptions struct {
+	// Format is one of the import formats like ansible_yaml, the machine
+	// list of the static provider if empty
+	Format string `json:"format"`
+}
+
+// staticMachine is a machine of a static inventory, in YAML or JSON:
+//
+//	machines:
+//	  - name: web-1
+//	    host: 10.0.0.1
+//	    port: 2222
+//	    labels: {env: prod}
+type staticMachine struct {
+	// ID defaults to the name
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Running defaults to true
+	Running *bool             `yaml:"running"`
+	Region  string            `yaml:"region"`
+	Labels  map[string]string `yaml:"labels"`
+	// Tags are labels without a value
+	Tags []string `yaml:"tags"`
+}
+
+func NewStaticProvider(config *models.Record) *StaticProvider {
+	return &StaticProvider{Config: config}
+}
+
+func (p *StaticProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
+	var opts StaticOptions
+	if err := decodeOptions(p.Config, &opts); err != nil {
+		return nil, err
+	}
+	content, err := p.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Format != "" {
+		hosts, err := inventory.Parse(opts.Format, bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		machines := make([]ProviderMachine, 0, len(hosts))
+		for _, host := range hosts {
+			machines = append(machines, ProviderMachine{
+				ID:      host.Name,
+				Name:    host.Name,
+				Host:    host.Host,
+				Port:    host.Port,
+				Running: true,
+				Labels:  tagLabels(slices.Concat(host.Tags, host.Groups)),
+			})
+		}
+		return machines, nil
+	}
+	return parseStaticMachines(content)
+}
+
+// read returns the inventory from the file or URL
+func (p *StaticProvider) read(ctx context.Context) ([]byte, error) {
+	source := strings.TrimSpace(p.Config.GetString("url"))
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		file, err := os.Open(strings.TrimPrefix(source, "file://"))
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(io.LimitReader(file, staticMaxSize))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := p.Config.GetString("token"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", source, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, staticMaxSize))
+}
+
+// parseStaticMachines reads a machine list, either on its own or under a
+// machines key. JSON is read as YAML.
+func parseStaticMachines(content []byte) ([]ProviderMachine, error) {
+	var list []staticMachine
+	if err := yaml.Unmarshal(content, &list); err != nil {
+		var doc struct {
+			Machines []staticMachine `yaml:"machines"`
+		}
+		if err := yaml.Unmarshal(content, &doc); err != nil {
+			return nil, fmt.Errorf("invalid inventory: %w", err)
+		}
+		list = doc.Machines
+	}
+
+	machines := make([]ProviderMachine, 0, len(list))
+	for i, m := range list {
+		if m.Name == "" {
+			m.Name = m.Host
+		}
+		if m.Name == "" {
+			return nil, fmt.Errorf("machine %d has neither a name nor a host", i+1)
+		}
+		if m.ID == "" {
+			m.ID = m.Name
+		}
+		labels := tagLabels(m.Tags)
+		for key, value := range m.Labels {
+			if labels == nil {
+				labels = make(map[string]string)
+			}
+			labels[key] = value
+		}
+		machines = append(machines, ProviderMachine{
+			ID:      m.ID,
+			Name:    m.Name,
+			Host:    m.Host,
+			Port:    m.Port,
+			Running: m.Running == nil || *m.Running,
+			Region:  m.Region,
+			Labels:  labels,
+		})
+	}
+	return machines, nil
+}
@@ -0,0 +1,130 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStaticProviderSync(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	yamlPath := write("machines.yaml", `
+machines:
+  - name: web-1
+    host: 10.0.0.1
+    port: 2222
+    region: dc1
+    tags: [web]
+    labels: {env: prod}
+  - id: db
+    host: 10.0.0.2
+    running: false
+`)
+	jsonPath := write("machines.json", `[{"name": "web-1", "host": "10.0.0.1"}]`)
+	ansiblePath := write("hosts.ini", "[web]\nweb-1 ansible_host=10.0.0.1 ansible_port=2222\n")
+	invalidPath := write("invalid.yaml", "machines:\n  - port: 22\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"name": "web-1", "host": "10.0.0.1"}]`))
+	}))
+	t.Cleanup(server.Close)
+
+	web := ProviderMachine{ID: "web-1", Name: "web-1", Host: "10.0.0.1", Running: true}
+	tests := []struct {
+		name    string
+		url     string
+		token   string
+		format  string
+		want    []ProviderMachine
+		wantErr bool
+	}{
+		{
+			name: "YAML",
+			url:  yamlPath,
+			want: []ProviderMachine{
+				{
+					ID:      "web-1",
+					Name:    "web-1",
+					Host:    "10.0.0.1",
+					Port:    2222,
+					Running: true,
+					Region:  "dc1",
+					Labels:  map[string]string{"web": "", "env": "prod"},
+				},
+				{ID: "db", Name: "10.0.0.2", Host: "10.0.0.2"},
+			},
+		},
+		{name: "JSON file URL", url: "file://" + jsonPath, want: []ProviderMachine{web}},
+		{
+			name:   "Ansible inventory",
+			url:    ansiblePath,
+			format: "ansible_ini",
+			want: []ProviderMachine{
+				{ID: "web-1", Name: "web-1", Host: "10.0.0.1", Port: 2222, Running: true, Labels: map[string]string{"web": ""}},
+			},
+		},
+		{name: "URL", url: server.URL, token: "secret", want: []ProviderMachine{web}},
+		{name: "URL without token", url: server.URL, wantErr: true},
+		{name: "Missing file", url: filepath.Join(dir, "missing.yaml"), wantErr: true},
+		{name: "Machine without host", url: invalidPath, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			p, err := NewProvider(testConfig(t, map[string]any{
+				"type":    "static",
+				"url":     tt.url,
+				"token":   tt.token,
+				"options": map[string]any{"format": tt.format},
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Sync(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Sync() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sync() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticProviderSyncCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	p, err := NewProvider(testConfig(t, map[string]any{"type": "static", "url": server.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.Sync(ctx); err == nil {
+		t.Error("Sync() expected an error for a canceled context")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Sync() returned after %s, want it to stop with the context", elapsed)
+	}
+}
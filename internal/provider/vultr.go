@@ -16,9 +16,8 @@ func NewVultrProvider(config *models.Record) *VultrProvider {
 	return &VultrProvider{Config: config}
 }
 
-func (p *VultrProvider) Sync() ([]ProviderMachine, error) {
+func (p *VultrProvider) Sync(ctx context.Context) ([]ProviderMachine, error) {
 	config := &oauth2.Config{}
-	ctx := context.Background()
 	ts := config.TokenSource(ctx, &oauth2.Token{AccessToken: p.Config.GetString("token")})
 	client := govultr.NewClient(oauth2.NewClient(ctx, ts))
 
@@ -35,6 +34,8 @@ func (p *VultrProvider) Sync() ([]ProviderMachine, error) {
 				Host:    v.MainIP,
 				Name:    v.Label,
 				Running: v.Status == "active",
+				Region:  v.Region,
+				Labels:  tagLabels(v.Tags),
 			}
 			machines = append(machines, machine)
 		}
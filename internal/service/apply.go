@@ -0,0 +1,703 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// ApplySpec is the declarative configuration of nexus. Users are never
+// created and machines never deleted by it, only their assignments are
+// managed.
+type ApplySpec struct {
+	Settings    map[string]string `yaml:"settings"    json:"settings"`
+	Tags        []TagSpec         `yaml:"tags"        json:"tags"`
+	Groups      []GroupSpec       `yaml:"groups"      json:"groups"`
+	Permissions []PermissionSpec  `yaml:"permissions" json:"permissions"`
+	Users       []UserSpec        `yaml:"users"       json:"users"`
+	Machines    []MachineSpec     `yaml:"machines"    json:"machines"`
+}
+
+type TagSpec struct {
+	Name        string `yaml:"name"        json:"name"`
+	Description string `yaml:"description" json:"description"`
+}
+
+// UnmarshalYAML allows tags as plain names
+func (t *TagSpec) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		t.Name = value.Value
+		return nil
+	}
+	type tagSpec TagSpec
+	return value.Decode((*tagSpec)(t))
+}
+
+type GroupSpec struct {
+	Name                string `yaml:"name"                 json:"name"`
+	Description         string `yaml:"description"          json:"description"`
+	LinuxUsername       string `yaml:"linux_username"       json:"linux_username"`
+	Shell               string `yaml:"shell"                json:"shell"`
+	Home                string `yaml:"home"                 json:"home"`
+	SupplementaryGroups string `yaml:"supplementary_groups" json:"supplementary_groups"`
+	Sudoers             string `yaml:"sudoers"              json:"sudoers"`
+}
+
+type PermissionSpec struct {
+	Name           string   `yaml:"name"            json:"name"`
+	Description    string   `yaml:"description"     json:"description"`
+	IsAdmin        bool     `yaml:"is_admin"        json:"is_admin"`
+	AccessUsers    bool     `yaml:"access_users"    json:"access_users"`
+	AccessMachines bool     `yaml:"access_machines" json:"access_machines"`
+	AccessGroups   bool     `yaml:"access_groups"   json:"access_groups"`
+	CanCreate      bool     `yaml:"can_create"      json:"can_create"`
+	CanUpdate      bool     `yaml:"can_update"      json:"can_update"`
+	CanDelete      bool     `yaml:"can_delete"      json:"can_delete"`
+	Machines       []string `yaml:"machines"        json:"machines"`
+	Groups         []string `yaml:"groups"          json:"groups"`
+	Users          []string `yaml:"users"           json:"users"`
+}
+
+// UserSpec assigns a permission and groups to a user, found by username or
+// email
+type UserSpec struct {
+	Name       string   `yaml:"name"       json:"name"`
+	Permission string   `yaml:"permission" json:"permission"`
+	Groups     []string `yaml:"groups"     json:"groups"`
+}
+
+// MachineSpec assigns tags, groups and users to a machine. Machines with a
+// host are created if they don't exist.
+type MachineSpec struct {
+	Name   string   `yaml:"name"   json:"name"`
+	Host   string   `yaml:"host"   json:"host"`
+	Port   int      `yaml:"port"   json:"port"`
+	Tags   []string `yaml:"tags"   json:"tags"`
+	Groups []string `yaml:"groups" json:"groups"`
+	Users  []string `yaml:"users"  json:"users"`
+}
+
+// ParseApplySpec reads a spec from YAML or JSON, unknown fields are errors
+func ParseApplySpec(r io.Reader) (*ApplySpec, error) {
+	var spec ApplySpec
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+	return &spec, nil
+}
+
+// Plan actions
+const (
+	ApplyCreate = "create"
+	ApplyUpdate = "update"
+	ApplyDelete = "delete"
+)
+
+// ApplyChange is a single planned change of a record
+type ApplyChange struct {
+	Collection string      `json:"collection"`
+	Name       string      `json:"name"`
+	Action     string      `json:"action"`
+	Diff       []FieldDiff `json:"diff,omitempty"`
+
+	kind   *applyKind
+	object *applyObject
+	id     string
+}
+
+// FieldDiff is the old and new value of a field, relations are names
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// ApplyPlan are the changes needed to reach a spec
+type ApplyPlan struct {
+	Prune   bool          `json:"prune"`
+	Changes []ApplyChange `json:"changes"`
+}
+
+// applyKind describes how a collection is managed
+type applyKind struct {
+	collection string
+	// Field with the unique name of a record
+	key       string
+	fields    []string
+	relations map[string]string
+	single    map[string]bool
+	create    bool
+	// Unmanaged records are deleted or their relations cleared on prune
+	prune string
+}
+
+// Kinds in the order they are created, deletes run in reverse
+var applyKinds = []*applyKind{
+	{collection: "settings", key: "key", fields: []string{"value"}},
+	{collection: "tags", key: "name", fields: []string{"description"}, create: true, prune: ApplyDelete},
+	{
+		collection: "groups",
+		key:        "name",
+		fields: []string{
+			"description", "linux_username", "shell", "home", "supplementary_groups", "sudoers",
+		},
+		create: true,
+		prune:  ApplyDelete,
+	},
+	{
+		collection: "machines",
+		key:        "name",
+		fields:     []string{"host", "port"},
+		relations:  map[string]string{"tags": "tags", "groups": "groups", "users": "users"},
+		create:     true,
+		prune:      ApplyUpdate,
+	},
+	{
+		collection: "permissions",
+		key:        "name",
+		fields: []string{
+			"description", "is_admin", "access_users", "access_machines", "access_groups",
+			"can_create", "can_update", "can_delete",
+		},
+		relations: map[string]string{"machines": "machines", "groups": "groups", "users": "users"},
+		create:    true,
+		prune:     ApplyDelete,
+	},
+	{
+		collection: "users",
+		key:        "username",
+		relations:  map[string]string{"permission": "permissions", "groups": "groups"},
+		single:     map[string]bool{"permission": true},
+		prune:      ApplyUpdate,
+	},
+}
+
+// applyObject is the managed state of a record, fields which are missing
+// are left alone
+type applyObject struct {
+	key       string
+	fields    map[string]any
+	relations map[string][]string
+}
+
+// applyState is the current state of all managed collections
+type applyState struct {
+	records map[string]map[string]*models.Record
+	names   map[string]map[string]string
+	// Usernames by username and email
+	users map[string]string
+	// Names used by more than one record
+	ambiguous map[string]map[string]bool
+}
+
+func loadApplyState(dao *daos.Dao) (*applyState, error) {
+	state := &applyState{
+		records:   make(map[string]map[string]*models.Record),
+		names:     make(map[string]map[string]string),
+		users:     make(map[string]string),
+		ambiguous: make(map[string]map[string]bool),
+	}
+	for _, kind := range applyKinds {
+		records, err := dao.FindRecordsByFilter(kind.collection, "id != ''", "", 0, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		state.records[kind.collection] = make(map[string]*models.Record)
+		state.names[kind.collection] = make(map[string]string)
+		state.ambiguous[kind.collection] = make(map[string]bool)
+		for _, record := range records {
+			key := record.GetString(kind.key)
+			if _, ok := state.records[kind.collection][key]; ok {
+				state.ambiguous[kind.collection][key] = true
+			}
+			state.records[kind.collection][key] = record
+			state.names[kind.collection][record.Id] = key
+			if kind.collection == "users" {
+				state.users[key] = key
+				if email := record.Email(); email != "" {
+					state.users[email] = key
+				}
+			}
+		}
+	}
+	return state, nil
+}
+
+// current returns the managed state of a record
+func (s *applyState) current(kind *applyKind, record *models.Record) *applyObject {
+	object := &applyObject{
+		key:       record.GetString(kind.key),
+		fields:    make(map[string]any),
+		relations: make(map[string][]string),
+	}
+	for _, field := range kind.fields {
+		object.fields[field] = record.Get(field)
+	}
+	for field, collection := range kind.relations {
+		var names []string
+		for _, id := range record.GetStringSlice(field) {
+			if name, ok := s.names[collection][id]; ok {
+				names = append(names, name)
+			}
+		}
+		slices.Sort(names)
+		object.relations[field] = names
+	}
+	return object
+}
+
+// desired turns a spec into the managed objects per collection
+func (s *applyState) desired(spec *ApplySpec) (map[string][]*applyObject, error) {
+	var errs []error
+	users := func(names []string) []string {
+		var result []string
+		for _, name := range names {
+			username, ok := s.users[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("unknown user %q", name))
+				continue
+			}
+			result = append(result, username)
+		}
+		return result
+	}
+	object := func(key string, fields map[string]any, relations map[string][]string) *applyObject {
+		for field, names := range relations {
+			names = slices.Clone(names)
+			slices.Sort(names)
+			relations[field] = slices.Compact(names)
+		}
+		return &applyObject{key: key, fields: fields, relations: relations}
+	}
+
+	desired := make(map[string][]*applyObject)
+	for key, value := range spec.Settings {
+		desired["settings"] = append(desired["settings"], object(key, map[string]any{"value": value}, nil))
+	}
+	slices.SortFunc(desired["settings"], func(a, b *applyObject) int { return strings.Compare(a.key, b.key) })
+	for _, tag := range spec.Tags {
+		desired["tags"] = append(desired["tags"], object(tag.Name, map[string]any{
+			"description": tag.Description,
+		}, nil))
+	}
+	for _, group := range spec.Groups {
+		if !host.ValidUsername(group.LinuxUsername) {
+			errs = append(errs, fmt.Errorf("group %s: invalid linux_username %q", group.Name, group.LinuxUsername))
+		}
+		desired["groups"] = append(desired["groups"], object(group.Name, map[string]any{
+			"description":          group.Description,
+			"linux_username":       group.LinuxUsername,
+			"shell":                group.Shell,
+			"home":                 group.Home,
+			"supplementary_groups": group.SupplementaryGroups,
+			"sudoers":              group.Sudoers,
+		}, nil))
+	}
+	for _, machine := range spec.Machines {
+		fields := make(map[string]any)
+		if machine.Host != "" {
+			fields["host"] = machine.Host
+			// New machines need a port, existing ones keep theirs
+			if s.records["machines"][machine.Name] == nil {
+				fields["port"] = 22
+			}
+		}
+		if machine.Port != 0 {
+			fields["port"] = machine.Port
+		}
+		desired["machines"] = append(desired["machines"], object(machine.Name, fields, map[string][]string{
+			"tags":   machine.Tags,
+			"groups": machine.Groups,
+			"users":  users(machine.Users),
+		}))
+	}
+	for _, p := range spec.Permissions {
+		desired["permissions"] = append(desired["permissions"], object(p.Name, map[string]any{
+			"description":     p.Description,
+			"is_admin":        p.IsAdmin,
+			"access_users":    p.AccessUsers,
+			"access_machines": p.AccessMachines,
+			"access_groups":   p.AccessGroups,
+			"can_create":      p.CanCreate,
+			"can_update":      p.CanUpdate,
+			"can_delete":      p.CanDelete,
+		}, map[string][]string{
+			"machines": p.Machines,
+			"groups":   p.Groups,
+			"users":    users(p.Users),
+		}))
+	}
+	for _, user := range spec.Users {
+		var permission []string
+		if user.Permission != "" {
+			permission = []string{user.Permission}
+		}
+		username := users([]string{user.Name})
+		if len(username) == 0 {
+			continue
+		}
+		desired["users"] = append(desired["users"], object(username[0], nil, map[string][]string{
+			"permission": permission,
+			"groups":     user.Groups,
+		}))
+	}
+
+	// Every object is only described once and references exist afterwards
+	for _, kind := range applyKinds {
+		seen := make(map[string]bool)
+		for _, o := range desired[kind.collection] {
+			if o.key == "" {
+				errs = append(errs, fmt.Errorf("%s: missing %s", kind.collection, kind.key))
+			} else if seen[o.key] {
+				errs = append(errs, fmt.Errorf("%s %q is described twice", kind.collection, o.key))
+			}
+			seen[o.key] = true
+			if s.ambiguous[kind.collection][o.key] {
+				errs = append(errs, fmt.Errorf("%s %q is ambiguous, names have to be unique", kind.collection, o.key))
+			}
+
+			for field, collection := range kind.relations {
+				if collection == "users" {
+					continue
+				}
+				for _, name := range o.relations[field] {
+					if s.ambiguous[collection][name] {
+						errs = append(errs, fmt.Errorf("%s %s: %s %q is ambiguous", kind.collection, o.key, field, name))
+					}
+					if !slices.ContainsFunc(desired[collection], func(d *applyObject) bool { return d.key == name }) &&
+						s.records[collection][name] == nil {
+						errs = append(errs, fmt.Errorf("%s %s: unknown %s %q", kind.collection, o.key, field, name))
+					}
+				}
+			}
+		}
+	}
+	return desired, errors.Join(errs...)
+}
+
+// PlanApply compares a spec to the current collections
+func PlanApply(app core.App, spec *ApplySpec, prune bool) (*ApplyPlan, error) {
+	state, err := loadApplyState(app.Dao())
+	if err != nil {
+		return nil, err
+	}
+	return planApply(state, spec, prune)
+}
+
+func planApply(state *applyState, spec *ApplySpec, prune bool) (*ApplyPlan, error) {
+	desired, err := state.desired(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ApplyPlan{Prune: prune, Changes: []ApplyChange{}}
+	var deletes []ApplyChange
+	for _, kind := range applyKinds {
+		managed := make(map[string]bool)
+		for _, want := range desired[kind.collection] {
+			managed[want.key] = true
+			record := state.records[kind.collection][want.key]
+			if record == nil {
+				switch {
+				case !kind.create:
+					return nil, fmt.Errorf("%s %q doesn't exist", kind.collection, want.key)
+				case kind.collection == "machines" && want.fields["host"] == nil:
+					return nil, fmt.Errorf("machine %q doesn't exist, set a host to create it", want.key)
+				}
+				plan.Changes = append(plan.Changes, ApplyChange{
+					Collection: kind.collection,
+					Name:       want.key,
+					Action:     ApplyCreate,
+					Diff:       diffObjects(kind, nil, want),
+					kind:       kind,
+					object:     want,
+				})
+				continue
+			}
+			if diff := diffObjects(kind, state.current(kind, record), want); len(diff) > 0 {
+				plan.Changes = append(plan.Changes, ApplyChange{
+					Collection: kind.collection,
+					Name:       want.key,
+					Action:     ApplyUpdate,
+					Diff:       diff,
+					kind:       kind,
+					object:     want,
+					id:         record.Id,
+				})
+			}
+		}
+
+		if !prune || kind.prune == "" {
+			continue
+		}
+		keys := make([]string, 0, len(state.records[kind.collection]))
+		for key := range state.records[kind.collection] {
+			if !managed[key] {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if state.ambiguous[kind.collection][key] {
+				return nil, fmt.Errorf("%s %q is ambiguous and can't be pruned", kind.collection, key)
+			}
+			record := state.records[kind.collection][key]
+			if kind.prune == ApplyDelete {
+				deletes = append(deletes, ApplyChange{
+					Collection: kind.collection,
+					Name:       key,
+					Action:     ApplyDelete,
+					kind:       kind,
+					id:         record.Id,
+				})
+				continue
+			}
+
+			// Unmanaged users and machines lose all assignments
+			empty := &applyObject{key: key, relations: make(map[string][]string)}
+			for field := range kind.relations {
+				empty.relations[field] = nil
+			}
+			if diff := diffObjects(kind, state.current(kind, record), empty); len(diff) > 0 {
+				plan.Changes = append(plan.Changes, ApplyChange{
+					Collection: kind.collection,
+					Name:       key,
+					Action:     ApplyUpdate,
+					Diff:       diff,
+					kind:       kind,
+					object:     empty,
+					id:         record.Id,
+				})
+			}
+		}
+	}
+	slices.Reverse(deletes)
+	plan.Changes = append(plan.Changes, deletes...)
+	return plan, nil
+}
+
+// diffObjects returns the managed fields which differ, current is nil for
+// new records
+func diffObjects(kind *applyKind, current, want *applyObject) []FieldDiff {
+	var diff []FieldDiff
+	for _, field := range kind.fields {
+		value, ok := want.fields[field]
+		if !ok {
+			continue
+		}
+		var old any
+		if current != nil {
+			old = current.fields[field]
+		}
+		if current == nil || fmt.Sprint(old) != fmt.Sprint(value) {
+			diff = append(diff, FieldDiff{Field: field, Old: old, New: value})
+		}
+	}
+
+	fields := make([]string, 0, len(kind.relations))
+	for field := range kind.relations {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	for _, field := range fields {
+		value, ok := want.relations[field]
+		if !ok {
+			continue
+		}
+		var old []string
+		if current != nil {
+			old = current.relations[field]
+		}
+		if !slices.Equal(old, value) {
+			diff = append(diff, FieldDiff{Field: field, Old: old, New: value})
+		}
+	}
+	return diff
+}
+
+// ExecuteApply runs a plan in a single transaction, nothing is changed if a
+// single change fails
+func ExecuteApply(app core.App, plan *ApplyPlan) error {
+	return app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		for _, change := range plan.Changes {
+			if err := executeChange(app, txDao, change); err != nil {
+				return fmt.Errorf("%s %s %q: %w", change.Action, change.Collection, change.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func executeChange(app core.App, dao *daos.Dao, change ApplyChange) error {
+	kind := change.kind
+	var record *models.Record
+	if change.Action == ApplyCreate {
+		collection, err := dao.FindCollectionByNameOrId(kind.collection)
+		if err != nil {
+			return err
+		}
+		record = models.NewRecord(collection)
+	} else {
+		var err error
+		if record, err = dao.FindRecordById(kind.collection, change.id); err != nil {
+			return err
+		}
+	}
+	if change.Action == ApplyDelete {
+		return dao.DeleteRecord(record)
+	}
+
+	data := map[string]any{kind.key: change.Name}
+	for field, value := range change.object.fields {
+		data[field] = value
+	}
+	for field, names := range change.object.relations {
+		collection := kind.relations[field]
+		related := applyKinds[slices.IndexFunc(applyKinds, func(k *applyKind) bool {
+			return k.collection == collection
+		})]
+		ids := []string{}
+		for _, name := range names {
+			target, err := dao.FindFirstRecordByData(collection, related.key, name)
+			if err != nil {
+				return fmt.Errorf("%s %q: %w", field, name, err)
+			}
+			ids = append(ids, target.Id)
+		}
+		if kind.single[field] {
+			data[field] = strings.Join(ids, "")
+		} else {
+			data[field] = ids
+		}
+	}
+
+	form := forms.NewRecordUpsert(app, record)
+	form.SetDao(dao)
+	if err := form.LoadData(data); err != nil {
+		return err
+	}
+	return form.Submit()
+}
+
+// FormatPlan renders a plan as a readable diff
+func FormatPlan(plan *ApplyPlan) string {
+	var b bytes.Buffer
+	counts := make(map[string]int)
+	for _, change := range plan.Changes {
+		counts[change.Action]++
+		symbol := map[string]string{ApplyCreate: "+", ApplyUpdate: "~", ApplyDelete: "-"}[change.Action]
+		fmt.Fprintf(&b, "%s %s %s\n", symbol, change.Collection, change.Name)
+		for _, d := range change.Diff {
+			if change.Action == ApplyCreate {
+				fmt.Fprintf(&b, "    %s: %s\n", d.Field, formatValue(d.New))
+			} else {
+				fmt.Fprintf(&b, "    %s: %s -> %s\n", d.Field, formatValue(d.Old), formatValue(d.New))
+			}
+		}
+	}
+	if len(plan.Changes) == 0 {
+		b.WriteString("No changes, the configuration is up to date.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "\nPlan: %d to create, %d to update, %d to delete\n",
+		counts[ApplyCreate], counts[ApplyUpdate], counts[ApplyDelete])
+	return b.String()
+}
+
+func formatValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return `""`
+	case []string:
+		return "[" + strings.Join(v, ", ") + "]"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// needsSync reports if a plan changes what ends up on the machines, with or
+// without an agent
+func (p *ApplyPlan) needsSync() bool {
+	return slices.ContainsFunc(p.Changes, func(c ApplyChange) bool {
+		return c.Collection != "tags" && c.Collection != "permissions"
+	})
+}
+
+// applyCommand applies a spec from the command line
+func applyCommand(app core.App) *cobra.Command {
+	var (
+		file   string
+		prune  bool
+		dryRun bool
+	)
+	cmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Apply a declarative configuration of groups, permissions and assignments",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var r io.Reader = cmd.InOrStdin()
+			if file != "-" {
+				f, err := os.Open(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				r = f
+			}
+			spec, err := ParseApplySpec(r)
+			if err != nil {
+				return err
+			}
+			plan, err := PlanApply(app, spec, prune)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprint(out, FormatPlan(plan))
+			if dryRun || len(plan.Changes) == 0 {
+				return nil
+			}
+			if err := ExecuteApply(app, plan); err != nil {
+				return err
+			}
+			fmt.Fprintln(out, "Applied.")
+
+			if !plan.needsSync() {
+				return nil
+			}
+			fmt.Fprintln(out, "Updating machines...")
+			job, err := updateAllMachines(app, "")
+			if err != nil {
+				return err
+			}
+			if job, err = waitForJob(app, job.Id); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Machine update %s (%d/%d failed)\n",
+				job.GetString("status"), job.GetInt("failed"), job.GetInt("total"))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&file, "file", "f", "nexus.yaml", "configuration file, - reads from stdin")
+	cmd.Flags().BoolVar(&prune, "prune", false,
+		"delete tags, groups and permissions missing from the file and clear assignments of unlisted users and machines")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only show the plan")
+	return cmd
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/test"
+)
+
+func TestApply(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	user, err := app.Dao().FindFirstRecordByFilter("users", "id != ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine, err := app.Dao().FindFirstRecordByFilter("machines", "id != ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting, err := app.Dao().FindFirstRecordByFilter("settings", "id != ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A spec with only the host keeps the port of existing machines
+	machine.Set("port", 2222)
+	if err := app.Dao().SaveRecord(machine); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := ParseApplySpec(strings.NewReader(fmt.Sprintf(`
+settings:
+  %[3]q: changed
+tags:
+  - gitops
+  - name: gitops-db
+    description: Databases
+groups:
+  - name: gitops-ops
+    linux_username: ops
+    shell: /bin/bash
+permissions:
+  - name: gitops-readers
+    access_machines: true
+    groups: [gitops-ops]
+    users: [%[1]s]
+users:
+  - name: %[1]s
+    permission: gitops-readers
+    groups: [gitops-ops]
+machines:
+  - name: %[2]s
+    host: %[4]s
+    tags: [gitops]
+    groups: [gitops-ops]
+  - name: gitops-new
+    host: 10.251.0.1
+    port: 2222
+    tags: [gitops-db]
+`, user.Email(), machine.GetString("name"), setting.GetString("key"), machine.GetString("host"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanApply(app, spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := 0
+	for _, change := range plan.Changes {
+		if change.Action == ApplyCreate {
+			created++
+		}
+		if change.Action == ApplyDelete {
+			t.Errorf("plan without prune deletes %s %s", change.Collection, change.Name)
+		}
+	}
+	// Two tags, the group, the permission and the new machine
+	if created != 5 {
+		t.Errorf("plan creates %d records, want 5:\n%s", created, FormatPlan(plan))
+	}
+
+	if err := ExecuteApply(app, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying the same spec again changes nothing
+	plan, err = PlanApply(app, spec, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("second plan has changes:\n%s", FormatPlan(plan))
+	}
+
+	user, err = app.Dao().FindRecordById("users", user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := app.Dao().FindFirstRecordByData("groups", "name", "gitops-ops")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if groups := user.GetStringSlice("groups"); len(groups) != 1 || groups[0] != group.Id {
+		t.Errorf("user groups = %v, want [%s]", groups, group.Id)
+	}
+	newMachine, err := app.Dao().FindFirstRecordByData("machines", "name", "gitops-new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	setting, err = app.Dao().FindRecordById("settings", setting.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if setting.GetString("value") != "changed" {
+		t.Errorf("setting value = %q, want changed", setting.GetString("value"))
+	}
+	if newMachine.GetInt("port") != 2222 || newMachine.GetString("host") != "10.251.0.1" {
+		t.Errorf("new machine = %v", newMachine.PublicExport())
+	}
+	machine, err = app.Dao().FindRecordById("machines", machine.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if machine.GetInt("port") != 2222 {
+		t.Errorf("existing machine port = %d, want 2222", machine.GetInt("port"))
+	}
+
+	// Pruning removes everything else and is applied in one transaction
+	plan, err = PlanApply(app, spec, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := FormatPlan(plan)
+	if !strings.Contains(diff, "- groups ") || strings.Contains(diff, "- groups gitops-ops") {
+		t.Errorf("prune plan doesn't delete the other groups:\n%s", diff)
+	}
+	if err := ExecuteApply(app, plan); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := app.Dao().FindRecordsByFilter("groups", "id != ''", "", 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Errorf("%d groups left after prune, want 1", len(groups))
+	}
+	if plan, err = PlanApply(app, spec, true); err != nil || len(plan.Changes) != 0 {
+		t.Errorf("plan after prune = %v, %v, want no changes", plan, err)
+	}
+}
+
+func TestPlanApplyErrors(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{name: "Unknown field", spec: "groups:\n  - name: a\n    linux_user: a\n"},
+		{name: "Unknown group", spec: "permissions:\n  - name: a\n    groups: [no-such-group]\n"},
+		{name: "Unknown user", spec: "users:\n  - name: nobody@example.invalid\n"},
+		{name: "Invalid username", spec: "groups:\n  - name: a\n    linux_username: 'a b'\n"},
+		{name: "Duplicate", spec: "tags: [a, a]\n"},
+		{name: "Missing machine", spec: "machines:\n  - name: no-such-machine\n"},
+		{name: "Unknown setting", spec: "settings:\n  no_such_setting: x\n"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := ParseApplySpec(strings.NewReader(tt.spec))
+			if err == nil {
+				_, err = PlanApply(app, spec, false)
+			}
+			if err == nil {
+				t.Errorf("PlanApply() expected an error for %q", tt.spec)
+			}
+		})
+	}
+}
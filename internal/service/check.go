@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Check states, a machine is ready if no check failed
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is the outcome of a single readiness check
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// Readiness reports if nexus can manage a machine, saved on the machine
+type Readiness struct {
+	Ready   bool      `json:"ready"`
+	Checked time.Time `json:"checked"`
+	Checks  []Check   `json:"checks"`
+}
+
+func (r *Readiness) add(name, status, format string, args ...any) {
+	r.Checks = append(r.Checks, Check{
+		Name:    name,
+		Status:  status,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// skip marks the remaining checks as skipped
+func (r *Readiness) skip(reason string, names ...string) {
+	for _, name := range names {
+		r.add(name, CheckSkip, "%s", reason)
+	}
+}
+
+// CheckMachine tests if nexus can reach and manage a machine without
+// changing anything on it and saves the report on the machine. A machine
+// which isn't ready is a result, errors are only returned if the report
+// can't be saved.
+func CheckMachine(ctx context.Context, app core.App, machine *models.Record) (*Readiness, error) {
+	report := checkMachine(ctx, app, machine)
+	machine.Set("readiness", report)
+	if err := app.Dao().SaveRecord(machine); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (r *Readiness) failed() string {
+	var names []string
+	for _, check := range r.Checks {
+		if check.Status == CheckFail {
+			names = append(names, check.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func checkMachine(ctx context.Context, app core.App, machine *models.Record) *Readiness {
+	report := &Readiness{Checked: time.Now().UTC()}
+	defer func() {
+		report.Ready = report.failed() == ""
+	}()
+
+	hops, err := jumpChain(app, machine, map[string]bool{})
+	addr := net.JoinHostPort(machine.GetString("host"), machine.GetString("port"))
+	switch {
+	case err != nil:
+		report.add("reachable", CheckFail, "invalid jump host: %v", err)
+	case len(hops) > 0:
+		report.add("reachable", CheckSkip, "reached through jump host %s", hops[len(hops)-1].name)
+	default:
+		dialer := net.Dialer{Timeout: 5 * time.Second}
+		tcp, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			report.add("reachable", CheckFail, "%v", err)
+			report.skip("machine is not reachable", "ssh", "privileges", "openssh", "sshd_include", "init_system", "agent")
+			return report
+		}
+		tcp.Close()
+		report.add("reachable", CheckOK, "%s is open", addr)
+	}
+
+	conn, err := connectContext(ctx, app, machine)
+	if err != nil {
+		report.add("ssh", CheckFail, "%v", err)
+		report.skip("no ssh connection", "privileges", "openssh", "sshd_include", "init_system", "agent")
+		return report
+	}
+	defer conn.Close()
+	report.add("ssh", CheckOK, "logged in as %s with the nexus key", conn.user)
+
+	// Unprivileged probes keep working if the privilege escalation doesn't
+	plain := &remoteConn{Client: conn.Client, user: conn.user, become: host.BecomeNone}
+	version, versionErr := checkOpenSSH(plain)
+
+	privileged := true
+	if output, err := run(conn, "id -u"); err != nil {
+		privileged = false
+		report.add("privileges", CheckFail, "%s can't become root with %s: %v", conn.user, conn.become, err)
+	} else if uid := strings.TrimSpace(string(output)); uid != "0" {
+		privileged = false
+		report.add("privileges", CheckFail, "running as uid %s instead of root", uid)
+	} else if conn.become == host.BecomeNone {
+		report.add("privileges", CheckOK, "logged in as root")
+	} else {
+		report.add("privileges", CheckOK, "%s becomes root with %s", conn.user, conn.become)
+	}
+
+	switch {
+	case versionErr != nil:
+		report.add("openssh", CheckFail, "%v", versionErr)
+	case !host.VersionAtLeast(version, host.MinCertificateVersion):
+		report.add("openssh", CheckFail, "OpenSSH %d.%d doesn't support certificate principals", version[0], version[1])
+	default:
+		report.add("openssh", CheckOK, "OpenSSH %d.%d", version[0], version[1])
+	}
+
+	if !privileged {
+		report.skip("no root privileges", "sshd_include", "init_system", "agent")
+		return report
+	}
+
+	output, err := run(conn, fmt.Sprintf(
+		`grep -Eis '^[[:space:]]*Include[[:space:]].*sshd_config\.d' %s || true`,
+		host.Quote(data.SSHDConfigPath),
+	))
+	switch {
+	case err != nil:
+		report.add("sshd_include", CheckFail, "%v", err)
+	case strings.TrimSpace(string(output)) != "":
+		report.add("sshd_include", CheckOK, "%s includes sshd_config.d", data.SSHDConfigPath)
+	case versionErr == nil && !host.VersionAtLeast(version, host.MinIncludeVersion):
+		report.add("sshd_include", CheckFail, "OpenSSH %d.%d doesn't support Include in sshd_config", version[0], version[1])
+	default:
+		report.add("sshd_include", CheckFail, "%s doesn't include sshd_config.d", data.SSHDConfigPath)
+	}
+
+	service, err := remoteInit(conn)
+	if err != nil {
+		report.add("init_system", CheckFail, "%v", err)
+		report.skip("unsupported init system", "agent")
+		return report
+	}
+	report.add("init_system", CheckOK, "%s", service.Name)
+
+	output, err = run(conn, fmt.Sprintf(
+		"if [ -x %s ]; then echo installed; fi; if %s >/dev/null 2>&1; then echo running; fi",
+		host.Quote(data.AgentPath), service.Status,
+	))
+	switch {
+	case err != nil:
+		report.add("agent", CheckFail, "%v", err)
+	case strings.Contains(string(output), "running"):
+		report.add("agent", CheckOK, "installed and running")
+	case strings.Contains(string(output), "installed"):
+		report.add("agent", CheckWarn, "installed but not running")
+	default:
+		report.add("agent", CheckWarn, "not installed")
+	}
+	return report
+}
+
+// checkOpenSSH returns the version of the OpenSSH client on the machine, which
+// ships together with sshd
+func checkOpenSSH(conn *remoteConn) ([2]int, error) {
+	output, err := run(conn, "ssh -V 2>&1 || true")
+	if err != nil {
+		return [2]int{}, err
+	}
+	return host.ParseOpenSSHVersion(string(output))
+}
+
+// checkMachines checks the given machines or all machines in a job
+func checkMachines(app core.App, user string, ids []string) (*models.Record, error) {
+	var (
+		machines []*models.Record
+		err      error
+	)
+	if len(ids) == 0 {
+		machines, err = app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
+	} else {
+		machines, err = app.Dao().FindRecordsByIds("machines", ids)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return startJob(app, "check_machines", user, machineTargets(
+		machines,
+		func(ctx context.Context, machine *models.Record) error {
+			// Not ready machines aren't retried, the report is on the machine
+			report, err := CheckMachine(ctx, app, machine)
+			if err == nil && !report.Ready {
+				slog.Debug("Machine is not ready", "name", machine.GetString("name"), "failed", report.failed())
+			}
+			return err
+		},
+	))
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/test"
+)
+
+func TestCheckMachine(t *testing.T) {
+	app := test.SetupApp(t)
+	machine := test.GetRecord(t, "machines", "agent = false")
+
+	// Grab a free port and close it again so nothing listens on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	machine.Set("host", "127.0.0.1")
+	machine.Set("port", strconv.Itoa(port))
+	machine.Set("jump_host", "")
+	machine.Set("jump_address", "")
+
+	report, err := CheckMachine(context.Background(), app, machine)
+	if err != nil {
+		t.Fatalf("CheckMachine() error = %v, want the report only", err)
+	}
+	if report.Ready {
+		t.Error("CheckMachine() reported an unreachable machine as ready")
+	}
+	if len(report.Checks) == 0 || report.Checks[0].Name != "reachable" ||
+		report.Checks[0].Status != CheckFail {
+		t.Fatalf("CheckMachine() checks = %+v, want a failed reachable check first", report.Checks)
+	}
+	for _, check := range report.Checks[1:] {
+		if check.Status != CheckSkip {
+			t.Errorf("check %s = %s, want %s", check.Name, check.Status, CheckSkip)
+		}
+	}
+
+	saved, err := app.Dao().FindRecordById("machines", machine.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Readiness
+	if err := saved.UnmarshalJSONField("readiness", &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Ready || len(stored.Checks) != len(report.Checks) {
+		t.Errorf("saved readiness = %+v, want %+v", stored, report)
+	}
+}
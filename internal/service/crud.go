@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"slices"
 
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/apis"
@@ -40,10 +41,14 @@ type Machine struct {
 }
 
 type Group struct {
-	ID          string `json:"id,omitempty"`
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
-	Username    string `json:"linux_username,omitempty"`
+	ID                  string `json:"id,omitempty"`
+	Name                string `json:"name,omitempty"`
+	Description         string `json:"description,omitempty"`
+	Username            string `json:"linux_username,omitempty"`
+	Shell               string `json:"shell,omitempty"`
+	Home                string `json:"home,omitempty"`
+	SupplementaryGroups string `json:"supplementary_groups,omitempty"`
+	Sudoers             string `json:"sudoers,omitempty"`
 }
 
 type Tag struct {
@@ -220,3 +225,21 @@ func insertAuditlog(
 
 	return app.Dao().SaveRecord(auditlog)
 }
+
+// insertRestoreLog keeps the restore report of a machine in the auditlog
+func insertRestoreLog(app core.App, machine *models.Record, restored []host.Restored) error {
+	auditlogCollection, err := app.Dao().FindCollectionByNameOrId("auditlog")
+	if err != nil {
+		return err
+	}
+
+	auditlog := models.NewRecord(auditlogCollection)
+	auditlog.Set("collection", machine.Collection().Name)
+	auditlog.Set("record", machine.Id)
+	auditlog.Set("event", "restore")
+	auditlog.Set("data", map[string]any{
+		"name":     machine.GetString("name"),
+		"restored": restored,
+	})
+	return app.Dao().SaveRecord(auditlog)
+}
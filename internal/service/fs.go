@@ -0,0 +1,170 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+)
+
+// remoteFS implements host.FS on a machine over sftp
+type remoteFS struct {
+	client *sftp.Client
+}
+
+func (r remoteFS) ReadFile(name string) ([]byte, error) {
+	file, err := r.client.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (r remoteFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return r.WriteFrom(name, bytes.NewReader(data), perm)
+}
+
+// WriteFrom replaces a file atomically. The data is written and synced to a
+// temporary file next to it, which gets the mode and owner and is then
+// renamed over the file. Readers never see a partially written file.
+func (r remoteFS) WriteFrom(name string, src io.Reader, perm fs.FileMode) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	dir, base := path.Split(name)
+	tmp := path.Join(dir, "."+base+".nexus-"+hex.EncodeToString(suffix))
+
+	if err := r.writeTemp(tmp, name, src, perm); err != nil {
+		_ = r.client.Remove(tmp)
+		return err
+	}
+	if _, ok := r.client.HasExtension("posix-rename@openssh.com"); ok {
+		if err := r.client.PosixRename(tmp, name); err != nil {
+			_ = r.client.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+
+	// Plain sftp renames fail if the target exists
+	if err := r.RemoveAll(name); err != nil {
+		_ = r.client.Remove(tmp)
+		return err
+	}
+	if err := r.client.Rename(tmp, name); err != nil {
+		_ = r.client.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (r remoteFS) writeTemp(tmp, name string, src io.Reader, perm fs.FileMode) error {
+	file, err := r.client.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return err
+	}
+	// Mode and owner are set while the file is still empty, the contents
+	// are tokens or keys other users must never read
+	if err := r.setTempOwner(tmp, name, perm); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := io.Copy(file, src); err != nil {
+		file.Close()
+		return err
+	}
+	if _, ok := r.client.HasExtension("fsync@openssh.com"); ok {
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+func (r remoteFS) setTempOwner(tmp, name string, perm fs.FileMode) error {
+	if err := r.client.Chmod(tmp, perm); err != nil {
+		return err
+	}
+
+	// Keep the owner of the replaced file
+	info, err := r.client.Lstat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	uid, gid, ok := r.Owner(info)
+	if !ok {
+		return nil
+	}
+	tmpInfo, err := r.client.Lstat(tmp)
+	if err != nil {
+		return err
+	}
+	if tmpUID, tmpGID, ok := r.Owner(tmpInfo); ok && tmpUID == uid && tmpGID == gid {
+		return nil
+	}
+	return r.client.Chown(tmp, uid, gid)
+}
+
+func (r remoteFS) Stat(name string) (fs.FileInfo, error) {
+	return r.client.Stat(name)
+}
+
+func (r remoteFS) Lstat(name string) (fs.FileInfo, error) {
+	return r.client.Lstat(name)
+}
+
+func (r remoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	infos, err := r.client.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+func (r remoteFS) MkdirAll(path string, perm fs.FileMode) error {
+	// Like os.MkdirAll, existing directories keep their mode
+	if info, err := r.client.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	if err := r.client.MkdirAll(path); err != nil {
+		return err
+	}
+	return r.client.Chmod(path, perm)
+}
+
+func (r remoteFS) RemoveAll(path string) error {
+	if _, err := r.client.Lstat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return r.client.RemoveAll(path)
+}
+
+func (r remoteFS) Chown(name string, uid, gid int) error {
+	return r.client.Chown(name, uid, gid)
+}
+
+func (r remoteFS) Owner(info fs.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(stat.UID), int(stat.GID), true
+}
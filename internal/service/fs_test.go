@@ -0,0 +1,84 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// pipeConn joins the two ends of the sftp server pipes
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+func newTestSFTP(t *testing.T) *sftp.Client {
+	t.Helper()
+	serverReader, clientWriter := io.Pipe()
+	clientReader, serverWriter := io.Pipe()
+	server, err := sftp.NewServer(pipeConn{Reader: serverReader, WriteCloser: serverWriter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = server.Serve() }()
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+// modeReader records the mode of the temporary file when its data is read
+type modeReader struct {
+	io.Reader
+	dir  string
+	mode os.FileMode
+}
+
+func (r *modeReader) Read(p []byte) (int, error) {
+	if r.mode == 0 {
+		matches, _ := filepath.Glob(filepath.Join(r.dir, ".token.nexus-*"))
+		for _, match := range matches {
+			if info, err := os.Lstat(match); err == nil {
+				r.mode = info.Mode().Perm()
+			}
+		}
+	}
+	return r.Reader.Read(p)
+}
+
+func TestRemoteFSWriteFrom(t *testing.T) {
+	fsys := remoteFS{client: newTestSFTP(t)}
+	dir := t.TempDir()
+	name := filepath.Join(dir, "token")
+	if err := os.WriteFile(name, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	src := &modeReader{Reader: strings.NewReader("secret"), dir: dir}
+	if err := fsys.WriteFrom(name, src, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if src.mode != 0o600 {
+		t.Errorf("temporary file mode while writing = %v, want 0600", src.mode)
+	}
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "secret" || info.Mode().Perm() != 0o600 {
+		t.Errorf("file = %q with mode %v, want secret with 0600", content, info.Mode().Perm())
+	}
+}
@@ -11,12 +11,15 @@ import (
 	"github.com/MizuchiLabs/ssh-nexus/api/server"
 	"github.com/MizuchiLabs/ssh-nexus/internal/config"
 	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/MizuchiLabs/ssh-nexus/tools/updater"
 	"github.com/MizuchiLabs/ssh-nexus/tools/util"
 	"github.com/MizuchiLabs/ssh-nexus/web"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
 	"github.com/pocketbase/pocketbase/tools/cron"
 	"github.com/spf13/cobra"
 )
@@ -37,6 +40,8 @@ func Server() error {
 			updater.UpdateSelf(updater.Version, true)
 		},
 	})
+	app.RootCmd.AddCommand(importCommand(app))
+	app.RootCmd.AddCommand(applyCommand(app))
 
 	if err := AppEventHandler(app.App); err != nil {
 		return err
@@ -50,6 +55,15 @@ func Server() error {
 	if err := MachineEventHandler(app.App); err != nil {
 		return err
 	}
+	if err := GroupEventHandler(app.App); err != nil {
+		return err
+	}
+	if err := PublicKeyEventHandler(app.App); err != nil {
+		return err
+	}
+	if err := JumpHostEventHandler(app.App); err != nil {
+		return err
+	}
 
 	if len(os.Args) <= 1 {
 		os.Args = append(os.Args, "serve")
@@ -107,13 +121,18 @@ func AppEventHandler(app core.App) error {
 		// Start gRPC server
 		server.Server(app)
 
+		// Jobs of the last run can't finish anymore
+		if err := recoverJobs(app); err != nil {
+			return err
+		}
+
 		// Setup tasks and schedule them
-		util.Execute(func() { syncProviders(app) })
+		util.Execute(func() { startProviderSync(app) })
 		util.Execute(func() { cleanupAudit(app) })
 
 		scheduler := cron.New()
 		scheduler.MustAdd("Sync Providers", "0 * * * *", func() { // every hour
-			util.Execute(func() { syncProviders(app) })
+			util.Execute(func() { startProviderSync(app) })
 		})
 		scheduler.MustAdd("Cleanup Auditlog", "0 0 * * 0", func() { // sunday midnight
 			util.Execute(func() { cleanupAudit(app) })
@@ -237,6 +256,13 @@ func MachineEventHandler(app core.App) error {
 			return nil
 		})
 
+	app.OnRecordBeforeUpdateRequest("machines").
+		Add(func(e *core.RecordUpdateEvent) error {
+			// The pinned host key can only be changed by re-pinning
+			e.Record.Set("host_key", e.Record.OriginalCopy().GetString("host_key"))
+			return nil
+		})
+
 	app.OnRecordAfterUpdateRequest("machines").
 		Add(func(e *core.RecordUpdateEvent) error {
 			// Manual update if agent is not connected
@@ -250,7 +276,7 @@ func MachineEventHandler(app core.App) error {
 	app.OnRecordBeforeDeleteRequest("machines").
 		Add(func(e *core.RecordDeleteEvent) error {
 			// Manual restore if agent is not connected
-			util.Execute(func() { Restore(e.Record) })
+			util.Execute(func() { Restore(app, e.Record) })
 			if err := cleanupTags(app); err != nil {
 				return err
 			}
@@ -260,15 +286,162 @@ func MachineEventHandler(app core.App) error {
 	// Sync Providers on create/update
 	app.OnRecordAfterCreateRequest("providers").
 		Add(func(e *core.RecordCreateEvent) error {
-			util.Execute(func() { syncProviders(app) })
+			util.Execute(func() { syncEditedProvider(app, e.Record) })
 			return nil
 		})
 
 	app.OnRecordAfterUpdateRequest("providers").
 		Add(func(e *core.RecordUpdateEvent) error {
-			util.Execute(func() { syncProviders(app) })
+			util.Execute(func() { syncEditedProvider(app, e.Record) })
+			return nil
+		})
+
+	return nil
+}
+
+func GroupEventHandler(app core.App) error {
+	// The linux username ends up in file paths and commands on the machines
+	validate := func(record *models.Record) error {
+		name := record.GetString("linux_username")
+		if name != "" && !host.ValidUsername(name) {
+			return apis.NewBadRequestError(
+				fmt.Sprintf("Invalid linux username %q.", name),
+				nil,
+			)
+		}
+		return nil
+	}
+	app.OnRecordBeforeCreateRequest("groups").
+		Add(func(e *core.RecordCreateEvent) error { return validate(e.Record) })
+	app.OnRecordBeforeUpdateRequest("groups").
+		Add(func(e *core.RecordUpdateEvent) error { return validate(e.Record) })
+
+	// Update machines if the linux account of a group changes
+	app.OnRecordAfterUpdateRequest("groups").
+		Add(func(e *core.RecordUpdateEvent) error {
+			machines, err := app.Dao().FindRecordsByFilter(
+				"machines",
+				"groups.id ?= {:group_id}",
+				"", 0, 0,
+				dbx.Params{"group_id": e.Record.Id},
+			)
+			if err != nil {
+				return err
+			}
+			for _, machine := range machines {
+				util.Execute(func() { ManualUpdate(app, machine) })
+			}
+			return nil
+		})
+
+	return nil
+}
+
+func PublicKeyEventHandler(app core.App) error {
+	validate := func(record *models.Record) error {
+		_, err := host.PublicKey{
+			Key:     record.GetString("key"),
+			From:    record.GetString("from"),
+			Command: record.GetString("command"),
+		}.Line()
+		if err != nil {
+			return apis.NewBadRequestError(err.Error(), nil)
+		}
+		return nil
+	}
+	// Update all machines the owner of the key has access to
+	update := func(record *models.Record) error {
+		user, err := app.Dao().FindRecordById("users", record.GetString("user"))
+		if err != nil {
+			return err
+		}
+		machines, err := GetUserMachines(app, user)
+		if err != nil {
+			return err
+		}
+		for _, machine := range machines {
+			util.Execute(func() { ManualUpdate(app, machine) })
+		}
+		return nil
+	}
+
+	app.OnRecordBeforeCreateRequest("public_keys").
+		Add(func(e *core.RecordCreateEvent) error { return validate(e.Record) })
+	app.OnRecordBeforeUpdateRequest("public_keys").
+		Add(func(e *core.RecordUpdateEvent) error { return validate(e.Record) })
+	app.OnRecordAfterCreateRequest("public_keys").
+		Add(func(e *core.RecordCreateEvent) error { return update(e.Record) })
+	app.OnRecordAfterUpdateRequest("public_keys").
+		Add(func(e *core.RecordUpdateEvent) error { return update(e.Record) })
+	app.OnRecordAfterDeleteRequest("public_keys").
+		Add(func(e *core.RecordDeleteEvent) error { return update(e.Record) })
+
+	// Remove the keys of a user before the machines are updated
+	app.OnRecordBeforeDeleteRequest("users").
+		Add(func(e *core.RecordDeleteEvent) error {
+			keys, err := app.Dao().FindRecordsByFilter(
+				"public_keys",
+				"user = {:user}",
+				"", 0, 0,
+				dbx.Params{"user": e.Record.Id},
+			)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if err := app.Dao().DeleteRecord(key); err != nil {
+					return err
+				}
+			}
+			if len(keys) == 0 {
+				return nil
+			}
+
+			machines, err := GetUserMachines(app, e.Record)
+			if err != nil {
+				return err
+			}
+			for _, machine := range machines {
+				util.Execute(func() { ManualUpdate(app, machine) })
+			}
 			return nil
 		})
 
 	return nil
 }
+
+func JumpHostEventHandler(app core.App) error {
+	validate := func(record *models.Record) error {
+		if record.Collection().Name == "machines" && record.GetString("jump_host") == record.Id &&
+			record.Id != "" {
+			return apis.NewBadRequestError("A machine can't be its own jump host.", nil)
+		}
+		if address := record.GetString("jump_address"); address != "" {
+			if _, _, err := parseJumpAddress(address); err != nil {
+				return apis.NewBadRequestError(err.Error(), nil)
+			}
+		}
+		return nil
+	}
+
+	for _, name := range []string{"machines", "tags", "providers"} {
+		app.OnRecordBeforeCreateRequest(name).
+			Add(func(e *core.RecordCreateEvent) error {
+				// The jump host key is pinned on first use
+				e.Record.Set("jump_host_key", "")
+				return validate(e.Record)
+			})
+		app.OnRecordBeforeUpdateRequest(name).
+			Add(func(e *core.RecordUpdateEvent) error {
+				// Pin the key again if the jump host changed
+				original := e.Record.OriginalCopy()
+				if e.Record.GetString("jump_address") != original.GetString("jump_address") {
+					e.Record.Set("jump_host_key", "")
+				} else {
+					e.Record.Set("jump_host_key", original.GetString("jump_host_key"))
+				}
+				return validate(e.Record)
+			})
+	}
+	return nil
+}
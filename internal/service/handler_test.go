@@ -135,3 +135,25 @@ func TestMachineEventHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestGroupEventHandler(t *testing.T) {
+	type args struct {
+		app *tests.TestApp
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{name: "Valid App", args: args{app: test.SetupApp(t)}, wantErr: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := GroupEventHandler(tt.args.app); (err != nil) != tt.wantErr {
+				t.Errorf("GroupEventHandler() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
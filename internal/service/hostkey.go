@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostKeyCallback accepts host certificates signed by the nexus host CA for
+// this machine, otherwise the host key must match the pinned key. The first
+// key seen is pinned on the machine (trust on first use).
+func hostKeyCallback(machine *models.Record) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if cert, ok := key.(*ssh.Certificate); ok {
+			err := checkHostCertificate(machine, hostname, remote, cert)
+			if err == nil {
+				return nil
+			}
+			slog.Debug(
+				"Host certificate not accepted, checking pinned key",
+				"name", machine.GetString("name"),
+				"err", err,
+			)
+			key = cert.Key
+		}
+		return checkPinnedKey(machine, key)
+	}
+}
+
+func checkHostCertificate(
+	machine *models.Record,
+	hostname string,
+	remote net.Addr,
+	cert *ssh.Certificate,
+) error {
+	if cert.KeyId != machine.GetString("name")+"@ssh-nexus" {
+		return fmt.Errorf("certificate was issued for %q", cert.KeyId)
+	}
+
+	signer, err := data.GetHostSigner()
+	if err != nil {
+		return err
+	}
+	ca := signer.PublicKey().Marshal()
+	checker := &ssh.CertChecker{
+		IsHostAuthority: func(auth ssh.PublicKey, _ string) bool {
+			return bytes.Equal(auth.Marshal(), ca)
+		},
+	}
+	return checker.CheckHostKey(hostname, remote, cert)
+}
+
+func checkPinnedKey(machine *models.Record, key ssh.PublicKey) error {
+	return checkPinned(machine, "host_key", key)
+}
+
+// checkPinned compares the key with the one pinned in a field of the record
+// and pins it if the field is empty
+func checkPinned(record *models.Record, field string, key ssh.PublicKey) error {
+	pinned := strings.TrimSpace(record.GetString(field))
+	if pinned == "" {
+		record.Set(field, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+		slog.Info(
+			"Pinned host key",
+			"name", record.GetString("name"),
+			"fingerprint", ssh.FingerprintSHA256(key),
+		)
+		return nil
+	}
+
+	pinnedKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pinned))
+	if err != nil {
+		return fmt.Errorf("invalid pinned host key: %w", err)
+	}
+	if !bytes.Equal(pinnedKey.Marshal(), key.Marshal()) {
+		return fmt.Errorf(
+			"host key mismatch: expected %s, got %s (re-pin the machine if the key changed on purpose)",
+			ssh.FingerprintSHA256(pinnedKey),
+			ssh.FingerprintSHA256(key),
+		)
+	}
+	return nil
+}
+
+// RepinHostKey drops the pinned host key of a machine and pins the key the
+// machine presents now
+func RepinHostKey(app core.App, machine *models.Record) (string, error) {
+	if machine == nil {
+		return "", fmt.Errorf("no machine provided")
+	}
+
+	previous := machine.GetString("host_key")
+	machine.Set("host_key", "")
+	conn, err := connect(app, machine)
+	if err != nil {
+		machine.Set("host_key", previous)
+		return "", err
+	}
+	conn.Close()
+
+	machine.Set("error", "")
+	if err := app.Dao().SaveRecord(machine); err != nil {
+		return "", err
+	}
+	slog.Info("Re-pinned host key", "name", machine.GetString("name"))
+	return machine.GetString("host_key"), nil
+}
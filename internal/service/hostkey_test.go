@@ -0,0 +1,40 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/test"
+	"golang.org/x/crypto/ssh"
+)
+
+func Test_checkPinnedKey(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	machine := test.GetRecord(t, "machines", "id != ''")
+	machine.Set("host_key", "")
+	pinned, other := newKey(), newKey()
+
+	if err := checkPinnedKey(machine, pinned); err != nil {
+		t.Fatalf("checkPinnedKey() first use error = %v", err)
+	}
+	if machine.GetString("host_key") == "" {
+		t.Fatal("checkPinnedKey() did not pin the host key")
+	}
+	if err := checkPinnedKey(machine, pinned); err != nil {
+		t.Errorf("checkPinnedKey() same key error = %v", err)
+	}
+	if err := checkPinnedKey(machine, other); err == nil {
+		t.Error("checkPinnedKey() accepted a different host key")
+	}
+}
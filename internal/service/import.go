@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/inventory"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+	"github.com/spf13/cobra"
+)
+
+// Import actions per host
+const (
+	ImportCreate  = "create"
+	ImportExists  = "exists"
+	ImportInvalid = "invalid"
+)
+
+// ImportOptions controls how inventory hosts become machines
+type ImportOptions struct {
+	DryRun       bool     `json:"dry_run"`
+	InstallAgent bool     `json:"install_agent"`
+	Tags         []string `json:"tags"`
+	Groups       []string `json:"groups"`
+}
+
+// ImportResult is the outcome of a single host
+type ImportResult struct {
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name"`
+	Host   string   `json:"host"`
+	Port   int      `json:"port"`
+	Tags   []string `json:"tags,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	Action string   `json:"action"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// ImportSummary is the outcome of an import, the job installs the agents or
+// updates the created machines
+type ImportSummary struct {
+	DryRun        bool           `json:"dry_run"`
+	Created       int            `json:"created"`
+	Existing      int            `json:"existing"`
+	Invalid       int            `json:"invalid"`
+	NewTags       []string       `json:"new_tags,omitempty"`
+	MissingGroups []string       `json:"missing_groups,omitempty"`
+	Machines      []ImportResult `json:"machines"`
+	Job           string         `json:"job,omitempty"`
+}
+
+// ImportMachines creates machines for the hosts of an inventory. Hosts which
+// already exist with the same host and port are skipped, tags are created
+// on demand and unknown groups are left out. Nothing is saved on a dry run.
+func ImportMachines(
+	app core.App,
+	user string,
+	hosts []inventory.Host,
+	opts ImportOptions,
+) (*ImportSummary, error) {
+	summary := &ImportSummary{DryRun: opts.DryRun, Machines: []ImportResult{}}
+
+	existing := make(map[string]bool)
+	machines, err := app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, machine := range machines {
+		address := inventory.Host{Host: machine.GetString("host"), Port: machine.GetInt("port")}.Address()
+		existing[address] = true
+	}
+
+	var created []*models.Record
+	err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		collection, err := txDao.FindCollectionByNameOrId("machines")
+		if err != nil {
+			return err
+		}
+		tags := make(map[string]string)
+		groups := make(map[string]string)
+
+		for _, h := range hosts {
+			result := ImportResult{
+				Name:   h.Name,
+				Host:   h.Host,
+				Port:   h.Port,
+				Tags:   mergeNames(h.Tags, opts.Tags),
+				Groups: mergeNames(h.Groups, opts.Groups),
+			}
+			if existing[h.Address()] {
+				result.Action = ImportExists
+				summary.Existing++
+				summary.Machines = append(summary.Machines, result)
+				continue
+			}
+
+			tagIDs, err := importTags(txDao, tags, result.Tags, summary, opts.DryRun)
+			if err != nil {
+				return err
+			}
+			var groupIDs []string
+			for _, name := range result.Groups {
+				if id := importGroup(txDao, groups, name, summary); id != "" {
+					groupIDs = append(groupIDs, id)
+				}
+			}
+
+			machine := models.NewRecord(collection)
+			form := forms.NewRecordUpsert(app, machine)
+			form.SetDao(txDao)
+			if err := form.LoadData(map[string]any{
+				"name":     h.Name,
+				"host":     h.Host,
+				"port":     h.Port,
+				"ssh_user": h.User,
+				"tags":     tagIDs,
+				"groups":   groupIDs,
+			}); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				err = form.Validate()
+			} else {
+				err = form.Submit()
+			}
+			if err != nil {
+				result.Action = ImportInvalid
+				result.Error = err.Error()
+				summary.Invalid++
+				summary.Machines = append(summary.Machines, result)
+				continue
+			}
+
+			existing[h.Address()] = true
+			result.ID = machine.Id
+			result.Action = ImportCreate
+			summary.Created++
+			summary.Machines = append(summary.Machines, result)
+			if !opts.DryRun {
+				created = append(created, machine)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(created) == 0 {
+		return summary, nil
+	}
+	// New machines get their configuration right away, from the agent or
+	// over ssh like after an edit
+	var job *models.Record
+	if opts.InstallAgent {
+		job, err = startJob(app, "install_agents", user, machineTargets(
+			created,
+			func(ctx context.Context, machine *models.Record) error {
+				return installAgent(ctx, app, machine)
+			},
+		))
+	} else {
+		job, err = updateMachines(app, user, created)
+	}
+	if err != nil {
+		return summary, err
+	}
+	if job != nil {
+		summary.Job = job.Id
+	}
+	return summary, nil
+}
+
+// importTags returns the ids of tags by name, missing tags are created
+func importTags(
+	dao *daos.Dao,
+	cache map[string]string,
+	names []string,
+	summary *ImportSummary,
+	dryRun bool,
+) ([]string, error) {
+	collection, err := dao.FindCollectionByNameOrId("tags")
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, name := range names {
+		id, ok := cache[name]
+		if !ok {
+			tag, _ := dao.FindFirstRecordByData("tags", "name", name)
+			if tag == nil {
+				tag = models.NewRecord(collection)
+				tag.Set("name", name)
+				if !dryRun {
+					if err := dao.SaveRecord(tag); err != nil {
+						return nil, fmt.Errorf("failed to save tag %s: %w", name, err)
+					}
+				}
+				summary.NewTags = append(summary.NewTags, name)
+			}
+			id = tag.Id
+			cache[name] = id
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// importGroup returns the id of a group by name, groups define linux
+// accounts and are never created by an import
+func importGroup(
+	dao *daos.Dao,
+	cache map[string]string,
+	name string,
+	summary *ImportSummary,
+) string {
+	if id, ok := cache[name]; ok {
+		return id
+	}
+	group, _ := dao.FindFirstRecordByData("groups", "name", name)
+	if group == nil {
+		summary.MissingGroups = append(summary.MissingGroups, name)
+		cache[name] = ""
+		return ""
+	}
+	cache[name] = group.Id
+	return group.Id
+}
+
+func mergeNames(names, extra []string) []string {
+	result := slices.Clone(names)
+	for _, name := range extra {
+		if !slices.Contains(result, name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// parseInventory reads the hosts of an inventory, the format is detected if
+// it's empty
+func parseInventory(format, name string, content []byte) ([]inventory.Host, error) {
+	if format == "" {
+		format = inventory.DetectFormat(name, content)
+	}
+	return inventory.Parse(format, bytes.NewReader(content))
+}
+
+// importCommand imports machines from the command line
+func importCommand(app core.App) *cobra.Command {
+	var (
+		format string
+		opts   ImportOptions
+	)
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import machines from an ssh_config, Ansible inventory or CSV file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			content, err := os.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			hosts, err := parseInventory(format, args[0], content)
+			if err != nil {
+				return err
+			}
+			summary, err := ImportMachines(app, "", hosts, opts)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ACTION\tNAME\tADDRESS\tTAGS\tGROUPS\tERROR")
+			for _, m := range summary.Machines {
+				fmt.Fprintf(w, "%s\t%s\t%s:%d\t%s\t%s\t%s\n",
+					m.Action, m.Name, m.Host, m.Port,
+					strings.Join(m.Tags, ","), strings.Join(m.Groups, ","), m.Error,
+				)
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if len(summary.NewTags) > 0 {
+				fmt.Fprintf(out, "New tags: %s\n", strings.Join(summary.NewTags, ", "))
+			}
+			if len(summary.MissingGroups) > 0 {
+				fmt.Fprintf(out, "Unknown groups, skipped: %s\n", strings.Join(summary.MissingGroups, ", "))
+			}
+			verb := "Imported"
+			if opts.DryRun {
+				verb = "Would import"
+			}
+			fmt.Fprintf(out, "%s %d machines, %d already exist, %d invalid\n",
+				verb, summary.Created, summary.Existing, summary.Invalid)
+
+			if summary.Job == "" {
+				return nil
+			}
+			// The process would stop the job on exit
+			label := "Machine update"
+			if opts.InstallAgent {
+				label = "Agent installation"
+			}
+			fmt.Fprintf(out, "%s...\n", label)
+			job, err := waitForJob(app, summary.Job)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "%s %s (%d/%d failed)\n",
+				label, job.GetString("status"), job.GetInt("failed"), job.GetInt("total"))
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "",
+		"inventory format: "+strings.Join(inventory.Formats, ", ")+" (detected if empty)")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "show what would be imported without saving")
+	cmd.Flags().BoolVar(&opts.InstallAgent, "install-agent", false, "install the agent on imported machines")
+	cmd.Flags().StringSliceVar(&opts.Tags, "tags", nil, "tags added to all imported machines")
+	cmd.Flags().StringSliceVar(&opts.Groups, "groups", nil, "groups added to all imported machines")
+	return cmd
+}
+
+// waitForJob polls a job until it finished
+func waitForJob(app core.App, id string) (*models.Record, error) {
+	for {
+		job, err := app.Dao().FindRecordById("jobs", id)
+		if err != nil {
+			return nil, err
+		}
+		switch job.GetString("status") {
+		case JobSucceeded, JobFailed, JobCanceled:
+			return job, nil
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/inventory"
+	"github.com/MizuchiLabs/ssh-nexus/test"
+)
+
+func TestImportMachines(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	existing, err := app.Dao().FindFirstRecordByFilter("machines", "id != ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group, err := app.Dao().FindFirstRecordByFilter("groups", "id != ''")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosts := []inventory.Host{
+		{Name: "imported-web", Host: "10.250.0.1", Port: 22, Tags: []string{"imported"}},
+		{
+			Name:   "imported-db",
+			Host:   "10.250.0.2",
+			Port:   2222,
+			User:   "deploy",
+			Groups: []string{group.GetString("name"), "no-such-group"},
+		},
+		{Name: "invalid", Host: "not a host", Port: 22},
+		{
+			Name: "duplicate",
+			Host: existing.GetString("host"),
+			Port: existing.GetInt("port"),
+		},
+	}
+
+	countMachines := func() int {
+		machines, err := app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(machines)
+	}
+	before := countMachines()
+
+	summary, err := ImportMachines(app, "", hosts, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 2 || summary.Existing != 1 || summary.Invalid != 1 {
+		t.Errorf("dry run summary = %+v, want 2 created, 1 existing and 1 invalid", summary)
+	}
+	if summary.Job != "" {
+		t.Errorf("dry run started job %s", summary.Job)
+	}
+	if got := countMachines(); got != before {
+		t.Fatalf("dry run saved machines: %d, want %d", got, before)
+	}
+
+	summary, err = ImportMachines(app, "", hosts, ImportOptions{Tags: []string{"batch"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := countMachines(); got != before+2 {
+		t.Fatalf("import saved %d machines, want %d", got-before, 2)
+	}
+	job, err := app.Dao().FindRecordById("jobs", summary.Job)
+	if err != nil {
+		t.Fatalf("import started no update job: %v", err)
+	}
+	CancelJob(job.Id)
+	if job.GetString("kind") != "sync_machines" || job.GetInt("total") != 2 {
+		t.Errorf("update job = %s for %d machines, want sync_machines for 2",
+			job.GetString("kind"), job.GetInt("total"))
+	}
+	if len(summary.MissingGroups) != 1 || summary.MissingGroups[0] != "no-such-group" {
+		t.Errorf("missing groups = %v, want [no-such-group]", summary.MissingGroups)
+	}
+
+	db, err := app.Dao().FindFirstRecordByData("machines", "host", "10.250.0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.GetString("ssh_user") != "deploy" || strconv.Itoa(db.GetInt("port")) != "2222" {
+		t.Errorf("imported machine = %v", db.PublicExport())
+	}
+	if groups := db.GetStringSlice("groups"); len(groups) != 1 || groups[0] != group.Id {
+		t.Errorf("imported groups = %v, want [%s]", groups, group.Id)
+	}
+	if tags := db.GetStringSlice("tags"); len(tags) != 1 {
+		t.Errorf("imported tags = %v, want the batch tag", tags)
+	}
+
+	// A second import finds everything
+	summary, err = ImportMachines(app, "", hosts[:2], ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 0 || summary.Existing != 2 {
+		t.Errorf("second import summary = %+v, want 2 existing", summary)
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/inventory"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// AnsibleInventory returns the machines a caller can log in to as an Ansible
+// dynamic inventory. Admins see all machines, users only their own and
+// connect as the linux user of their group on the machine.
+func AnsibleInventory(app core.App, user *models.Record) (*inventory.AnsibleExport, error) {
+	var (
+		machines []*models.Record
+		err      error
+	)
+	if user == nil {
+		machines, err = app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
+	} else {
+		machines, err = GetUserMachines(app, user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(machines, func(a, b *models.Record) int {
+		return strings.Compare(a.GetString("name"), b.GetString("name"))
+	})
+
+	export := inventory.NewAnsibleExport()
+	for _, machine := range machines {
+		if errs := app.Dao().ExpandRecord(machine, []string{"tags", "groups", "provider"}, nil); len(errs) > 0 {
+			return nil, fmt.Errorf("failed to expand: %v", errs)
+		}
+
+		var groups []string
+		for _, tag := range machine.ExpandedAll("tags") {
+			groups = append(groups, inventory.AnsibleGroupName("tag", tag.GetString("name")))
+		}
+		for _, group := range machine.ExpandedAll("groups") {
+			// Users only see the groups they are part of
+			if user != nil && !slices.Contains(user.GetStringSlice("groups"), group.Id) {
+				continue
+			}
+			groups = append(groups, inventory.AnsibleGroupName("group", group.GetString("name")))
+		}
+		if provider := machine.ExpandedOne("provider"); provider != nil {
+			groups = append(groups, inventory.AnsibleGroupName("provider", provider.GetString("name")))
+		}
+
+		export.AddHost(machine.GetString("name"), machine.Id, map[string]any{
+			"ansible_host": machine.GetString("host"),
+			"ansible_port": machine.GetInt("port"),
+			"ansible_user": inventoryUser(app, machine, user),
+			"nexus_id":     machine.Id,
+			"nexus_agent":  machine.GetBool("agent"),
+		}, groups...)
+	}
+	return export, nil
+}
+
+// inventoryUser returns the linux user a caller logs in with on a machine,
+// the groups of the machine have to be expanded
+func inventoryUser(app core.App, machine *models.Record, user *models.Record) string {
+	// Admins use the login of the server
+	if user == nil {
+		login, _ := sshLogin(app, machine)
+		return login
+	}
+	if slices.Contains(machine.GetStringSlice("users"), user.Id) {
+		return "root"
+	}
+
+	var names []string
+	for _, group := range machine.ExpandedAll("groups") {
+		name := group.GetString("linux_username")
+		if name != "" && slices.Contains(user.GetStringSlice("groups"), group.Id) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "root"
+	}
+	slices.Sort(names)
+	return names[0]
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/inventory"
+	"github.com/MizuchiLabs/ssh-nexus/test"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestAnsibleInventory(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	type ansibleJSON struct {
+		Meta struct {
+			Hostvars map[string]map[string]any `json:"hostvars"`
+		} `json:"_meta"`
+		All struct {
+			Children []string `json:"children"`
+		} `json:"all"`
+	}
+	load := func(user *models.Record) ansibleJSON {
+		export, err := AnsibleInventory(app, user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := json.Marshal(export)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result ansibleJSON
+		if err := json.Unmarshal(raw, &result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	machines, err := app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := load(nil)
+	if len(all.Meta.Hostvars) != len(machines) {
+		t.Errorf("admin inventory has %d hosts, want %d", len(all.Meta.Hostvars), len(machines))
+	}
+	for name, vars := range all.Meta.Hostvars {
+		if vars["ansible_host"] == "" || vars["ansible_user"] == "" || vars["ansible_port"] == nil {
+			t.Errorf("host %s misses connection variables: %v", name, vars)
+		}
+	}
+
+	user, err := app.Dao().FindFirstRecordByFilter("users", "groups:length > 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	own, err := GetUserMachines(app, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mine := load(user)
+	if len(mine.Meta.Hostvars) != len(own) {
+		t.Errorf("user inventory has %d hosts, want %d", len(mine.Meta.Hostvars), len(own))
+	}
+
+	// Users only see the nexus groups they are part of
+	groups, err := app.Dao().FindRecordsByIds("groups", user.GetStringSlice("groups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, child := range mine.All.Children {
+		if !strings.HasPrefix(child, "group_") {
+			continue
+		}
+		if !slices.ContainsFunc(groups, func(g *models.Record) bool {
+			return child == inventory.AnsibleGroupName("group", g.GetString("name"))
+		}) {
+			t.Errorf("user inventory has foreign group %s", child)
+		}
+	}
+}
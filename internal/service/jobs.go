@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/util"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+	// JobSkipped is only used for targets which had nothing to do
+	JobSkipped = "skipped"
+)
+
+var (
+	// Targets of a job running at the same time, every job has its own
+	// workers so a large job doesn't hold up the others
+	jobConcurrency = 8
+	// Least time between two saves of the progress of a job
+	jobSaveInterval = time.Second
+	// Attempts per target and the delay before the first retry, doubled
+	// after every attempt
+	jobAttempts = 3
+	jobBackoff  = 2 * time.Second
+	// Time a single attempt may take
+	jobTimeout = 2 * time.Minute
+
+	// Cancel functions of the running jobs by id
+	jobCancels sync.Map
+
+	// errJobSkipped is wrapped by targets which didn't run, they are
+	// neither retried nor counted as failed
+	errJobSkipped = errors.New("skipped")
+)
+
+// jobTarget is a single unit of work of a job, e.g. one machine
+type jobTarget struct {
+	ID   string
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// JobResult is the outcome of a target, saved on the job
+type JobResult struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+}
+
+// startJob saves a new job and works through its targets in the background
+func startJob(app core.App, kind string, user string, targets []jobTarget) (*models.Record, error) {
+	collection, err := app.Dao().FindCollectionByNameOrId("jobs")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]JobResult, len(targets))
+	for i, target := range targets {
+		results[i] = JobResult{ID: target.ID, Name: target.Name, Status: JobQueued}
+	}
+	job := models.NewRecord(collection)
+	job.Set("kind", kind)
+	job.Set("user", user)
+	job.Set("status", JobQueued)
+	job.Set("total", len(targets))
+	job.Set("results", results)
+	if err := app.Dao().SaveRecord(job); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	jobCancels.Store(job.Id, cancel)
+	util.Execute(func() {
+		defer jobCancels.Delete(job.Id)
+		defer cancel()
+		runJob(ctx, app, job, targets, results)
+	})
+	return job, nil
+}
+
+func runJob(
+	ctx context.Context,
+	app core.App,
+	job *models.Record,
+	targets []jobTarget,
+	results []JobResult,
+) {
+	var mu sync.Mutex
+	save := func() {
+		if err := app.Dao().SaveRecord(job); err != nil {
+			slog.Error("Failed to save job", "id", job.Id, "err", err)
+		}
+	}
+
+	mu.Lock()
+	job.Set("status", JobRunning)
+	job.Set("started", time.Now().UTC())
+	save()
+	mu.Unlock()
+
+	// Results change with every target, they are saved at most once per
+	// interval instead of after every change
+	changed := false
+	update := func(change func()) {
+		mu.Lock()
+		defer mu.Unlock()
+		change()
+		job.Set("results", results)
+		changed = true
+	}
+	stopSaving := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		ticker := time.NewTicker(jobSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				if changed {
+					save()
+					changed = false
+				}
+				mu.Unlock()
+			case <-stopSaving:
+				return
+			}
+		}
+	}()
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(jobConcurrency, len(targets)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				update(func() { results[i].Status = JobRunning })
+				attempts, err := runTarget(ctx, targets[i], jobBackoff)
+				update(func() {
+					results[i].Attempts = attempts
+					switch {
+					case err == nil:
+						results[i].Status = JobSucceeded
+					case errors.Is(err, errJobSkipped):
+						results[i].Status = JobSkipped
+						results[i].Error = err.Error()
+					case ctx.Err() != nil:
+						results[i].Status = JobCanceled
+						results[i].Error = err.Error()
+					default:
+						results[i].Status = JobFailed
+						results[i].Error = err.Error()
+						job.Set("failed", job.GetInt("failed")+1)
+					}
+					job.Set("done", job.GetInt("done")+1)
+				})
+			}
+		}()
+	}
+queue:
+	for i := range targets {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			// Targets which never started
+			update(func() {
+				for j := i; j < len(targets); j++ {
+					results[j].Status = JobCanceled
+				}
+			})
+			break queue
+		}
+	}
+	close(next)
+	wg.Wait()
+	close(stopSaving)
+	<-saved
+
+	status := JobSucceeded
+	switch {
+	case ctx.Err() != nil:
+		status = JobCanceled
+	case job.GetInt("failed") > 0:
+		status = JobFailed
+		job.Set("error", fmt.Sprintf("%d of %d targets failed", job.GetInt("failed"), len(targets)))
+	}
+	job.Set("results", results)
+	job.Set("status", status)
+	job.Set("finished", time.Now().UTC())
+	save()
+	slog.Info(
+		"Finished job",
+		"id", job.Id,
+		"kind", job.GetString("kind"),
+		"status", status,
+		"failed", job.GetInt("failed"),
+	)
+}
+
+// runTarget runs a target until it succeeds, retrying with backoff
+func runTarget(ctx context.Context, target jobTarget, backoff time.Duration) (int, error) {
+	var err error
+	for attempt := 1; attempt <= jobAttempts; attempt++ {
+		err = runAttempt(ctx, target)
+		if err == nil || errors.Is(err, errJobSkipped) || ctx.Err() != nil || attempt == jobAttempts {
+			return attempt, err
+		}
+
+		slog.Debug("Retrying job target", "name", target.Name, "attempt", attempt, "err", err)
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return attempt, err
+		}
+	}
+	return jobAttempts, err
+}
+
+func runAttempt(ctx context.Context, target jobTarget) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, jobTimeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	err = target.Run(ctx)
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", jobTimeout)
+	}
+	return err
+}
+
+// CancelJob stops a running job, targets already running are interrupted
+func CancelJob(id string) bool {
+	cancel, ok := jobCancels.Load(id)
+	if !ok {
+		return false
+	}
+	cancel.(context.CancelFunc)()
+	return true
+}
+
+// recoverJobs cancels the jobs which were queued or running when the server
+// stopped, nothing is left to finish or cancel them
+func recoverJobs(app core.App) error {
+	jobs, err := app.Dao().FindRecordsByFilter(
+		"jobs", "status = {:queued} || status = {:running}", "", 0, 0,
+		dbx.Params{"queued": JobQueued, "running": JobRunning},
+	)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		var results []JobResult
+		if err := job.UnmarshalJSONField("results", &results); err != nil {
+			slog.Error("Failed to read job results", "id", job.Id, "err", err)
+		}
+		for i := range results {
+			if results[i].Status == JobQueued || results[i].Status == JobRunning {
+				results[i].Status = JobCanceled
+				results[i].Error = "interrupted by a server restart"
+			}
+		}
+		job.Set("results", results)
+		job.Set("status", JobCanceled)
+		job.Set("error", "interrupted by a server restart")
+		job.Set("finished", time.Now().UTC())
+		if err := app.Dao().SaveRecord(job); err != nil {
+			return err
+		}
+		slog.Warn("Canceled interrupted job", "id", job.Id, "kind", job.GetString("kind"))
+	}
+	return nil
+}
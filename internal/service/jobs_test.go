@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/test"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func Test_runTarget(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "Success", failures: 0, wantAttempts: 1},
+		{name: "Retry", failures: 2, wantAttempts: 3},
+		{name: "Give up", failures: 5, wantAttempts: jobAttempts, wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			calls := 0
+			target := jobTarget{Name: tt.name, Run: func(context.Context) error {
+				calls++
+				if calls <= tt.failures {
+					return errors.New("unreachable")
+				}
+				return nil
+			}}
+			attempts, err := runTarget(context.Background(), target, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("runTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("runTarget() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func Test_startJob(t *testing.T) {
+	app := test.SetupApp(t)
+	job, err := startJob(app, "test", "", []jobTarget{
+		{ID: "a", Name: "a", Run: func(context.Context) error { return nil }},
+		{ID: "b", Name: "b", Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	})
+	if err != nil {
+		t.Fatalf("startJob() error = %v", err)
+	}
+	if !CancelJob(job.Id) {
+		t.Fatal("CancelJob() = false for a running job")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err = app.Dao().FindRecordById("jobs", job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.GetString("status") == JobCanceled {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("job status = %q, want %q", job.GetString("status"), JobCanceled)
+}
+
+func Test_startJobSkipped(t *testing.T) {
+	app := test.SetupApp(t)
+	calls := 0
+	job, err := startJob(app, "test", "", []jobTarget{
+		{ID: "a", Name: "a", Run: func(context.Context) error {
+			calls++
+			return fmt.Errorf("%w: nothing to do", errJobSkipped)
+		}},
+	})
+	if err != nil {
+		t.Fatalf("startJob() error = %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err = app.Dao().FindRecordById("jobs", job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.GetString("status") == JobSucceeded {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	var results []JobResult
+	if err := job.UnmarshalJSONField("results", &results); err != nil {
+		t.Fatal(err)
+	}
+	if job.GetString("status") != JobSucceeded || len(results) != 1 || results[0].Status != JobSkipped {
+		t.Errorf("job = %s %+v, want succeeded with a skipped target", job.GetString("status"), results)
+	}
+	if calls != 1 {
+		t.Errorf("skipped target ran %d times, want 1", calls)
+	}
+}
+
+func Test_recoverJobs(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := models.NewRecord(collection)
+	job.Set("kind", "test")
+	job.Set("status", JobRunning)
+	job.Set("total", 2)
+	job.Set("done", 1)
+	job.Set("results", []JobResult{
+		{ID: "a", Name: "a", Status: JobSucceeded, Attempts: 1},
+		{ID: "b", Name: "b", Status: JobRunning},
+	})
+	if err := app.Dao().SaveRecord(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := recoverJobs(app); err != nil {
+		t.Fatalf("recoverJobs() error = %v", err)
+	}
+	job, err = app.Dao().FindRecordById("jobs", job.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []JobResult
+	if err := job.UnmarshalJSONField("results", &results); err != nil {
+		t.Fatal(err)
+	}
+	if job.GetString("status") != JobCanceled || job.GetDateTime("finished").IsZero() {
+		t.Errorf("job = %v, want canceled and finished", job.PublicExport())
+	}
+	if results[0].Status != JobSucceeded || results[1].Status != JobCanceled {
+		t.Errorf("results = %+v, want the running target canceled", results)
+	}
+}
+
+func Test_runJobConcurrency(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	var saves atomic.Int32
+	app.OnModelAfterUpdate("jobs").Add(func(*core.ModelEvent) error {
+		saves.Add(1)
+		return nil
+	})
+
+	var running, peak atomic.Int32
+	targets := make([]jobTarget, 40)
+	for i := range targets {
+		targets[i] = jobTarget{ID: fmt.Sprint(i), Name: fmt.Sprint(i), Run: func(context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}}
+	}
+
+	collection, err := app.Dao().FindCollectionByNameOrId("jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := models.NewRecord(collection)
+	job.Set("kind", "test")
+	job.Set("status", JobQueued)
+	if err := app.Dao().SaveRecord(job); err != nil {
+		t.Fatal(err)
+	}
+	results := make([]JobResult, len(targets))
+	runJob(context.Background(), app, job, targets, results)
+
+	if job.GetString("status") != JobSucceeded || job.GetInt("done") != len(targets) {
+		t.Errorf("job = %s with %d done, want succeeded with %d", job.GetString("status"), job.GetInt("done"), len(targets))
+	}
+	if p := peak.Load(); p > int32(jobConcurrency) {
+		t.Errorf("%d targets ran at the same time, want at most %d", p, jobConcurrency)
+	}
+	// Started, finished and at most a few progress saves in between
+	if n := saves.Load(); n > 5 {
+		t.Errorf("job saved %d times for %d targets", n, len(targets))
+	}
+}
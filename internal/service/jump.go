@@ -0,0 +1,173 @@
+package service
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// Longest chain of jump hosts, catches misconfigured chains early
+const maxJumpHops = 8
+
+// jumpHop is a host the connection to a machine is tunneled through
+type jumpHop struct {
+	name    string
+	addr    string
+	user    string
+	hostKey ssh.HostKeyCallback
+	// pinned is called after the hop connected to save a pinned host key
+	pinned func()
+}
+
+// jumpSource returns the record configuring the jump host of a machine. The
+// machine itself wins over its tags and the tags over its provider.
+func jumpSource(app core.App, machine *models.Record) *models.Record {
+	if hasJump(machine, machine) {
+		return machine
+	}
+	if app == nil {
+		return nil
+	}
+	for _, id := range machine.GetStringSlice("tags") {
+		tag, err := app.Dao().FindRecordById("tags", id)
+		if err == nil && hasJump(tag, machine) {
+			return tag
+		}
+	}
+	if id := machine.GetString("provider"); id != "" {
+		provider, err := app.Dao().FindRecordById("providers", id)
+		if err == nil && hasJump(provider, machine) {
+			return provider
+		}
+	}
+	return nil
+}
+
+// hasJump reports if the record sets a jump host for the machine, the jump
+// host itself is reached directly even if it shares the tag or provider
+func hasJump(record, machine *models.Record) bool {
+	jumpHost := record.GetString("jump_host")
+	return (jumpHost != "" && jumpHost != machine.Id) || record.GetString("jump_address") != ""
+}
+
+// jumpChain returns the hops to a machine in the order they are dialed
+func jumpChain(app core.App, machine *models.Record, seen map[string]bool) ([]jumpHop, error) {
+	source := jumpSource(app, machine)
+	if source == nil {
+		return nil, nil
+	}
+	seen[machine.Id] = true
+	if len(seen) > maxJumpHops {
+		return nil, fmt.Errorf("more than %d jump hosts", maxJumpHops)
+	}
+
+	if id := source.GetString("jump_host"); id != "" && id != machine.Id {
+		if seen[id] {
+			return nil, fmt.Errorf("jump host loop at %s", machine.GetString("name"))
+		}
+		jump, err := app.Dao().FindRecordById("machines", id)
+		if err != nil {
+			return nil, fmt.Errorf("jump host of %s: %w", machine.GetString("name"), err)
+		}
+		chain, err := jumpChain(app, jump, seen)
+		if err != nil {
+			return nil, err
+		}
+
+		user, _ := sshLogin(app, jump)
+		previous := jump.GetString("host_key")
+		return append(chain, jumpHop{
+			name:    jump.GetString("name"),
+			addr:    net.JoinHostPort(jump.GetString("host"), jump.GetString("port")),
+			user:    user,
+			hostKey: hostKeyCallback(jump),
+			pinned: func() {
+				if jump.GetString("host_key") == previous {
+					return
+				}
+				if err := app.Dao().SaveRecord(jump); err != nil {
+					slog.Error("Failed to save jump host", "name", jump.GetString("name"), "err", err)
+				}
+			},
+		}), nil
+	}
+
+	user, addr, err := parseJumpAddress(source.GetString("jump_address"))
+	if err != nil {
+		return nil, err
+	}
+	previous := source.GetString("jump_host_key")
+	return []jumpHop{{
+		name: addr,
+		addr: addr,
+		user: user,
+		hostKey: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			if cert, ok := key.(*ssh.Certificate); ok {
+				key = cert.Key
+			}
+			return checkPinned(source, "jump_host_key", key)
+		},
+		pinned: func() {
+			// The machine is saved by the caller
+			if source.Id == machine.Id || source.GetString("jump_host_key") == previous {
+				return
+			}
+			if err := app.Dao().SaveRecord(source); err != nil {
+				slog.Error("Failed to save jump host key", "name", source.GetString("name"), "err", err)
+			}
+		},
+	}}, nil
+}
+
+// parseJumpAddress parses a jump host in the form [user@]host[:port]
+func parseJumpAddress(address string) (string, string, error) {
+	user, hostport := "root", strings.TrimSpace(address)
+	if i := strings.LastIndex(hostport, "@"); i >= 0 {
+		user, hostport = hostport[:i], hostport[i+1:]
+	}
+	if !host.ValidUsername(user) {
+		return "", "", fmt.Errorf("invalid jump host user %q", user)
+	}
+
+	hostname, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		hostname, port = strings.Trim(hostport, "[]"), "22"
+	}
+	if hostname == "" || strings.ContainsAny(hostname, " \t/@") {
+		return "", "", fmt.Errorf("invalid jump host %q", address)
+	}
+	return user, net.JoinHostPort(hostname, port), nil
+}
+
+// dial opens an SSH connection, through the via connection if there is one
+func dial(via *ssh.Client, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Tunneled connections have no deadlines, close them if the handshake hangs
+	timer := time.AfterFunc(config.Timeout, func() { conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if !timer.Stop() {
+		if err == nil {
+			c.Close()
+		}
+		return nil, fmt.Errorf("ssh handshake with %s timed out", addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
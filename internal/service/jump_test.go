@@ -0,0 +1,64 @@
+package service
+
+import "testing"
+
+func Test_parseJumpAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  string
+		wantUser string
+		wantAddr string
+		wantErr  bool
+	}{
+		{
+			name:     "Host only",
+			address:  "bastion.example.com",
+			wantUser: "root",
+			wantAddr: "bastion.example.com:22",
+		},
+		{
+			name:     "User and port",
+			address:  "deploy@10.0.0.1:2222",
+			wantUser: "deploy",
+			wantAddr: "10.0.0.1:2222",
+		},
+		{
+			name:     "IPv6",
+			address:  "jump@[2001:db8::1]:22",
+			wantUser: "jump",
+			wantAddr: "[2001:db8::1]:22",
+		},
+		{
+			name:     "Bare IPv6",
+			address:  "2001:db8::1",
+			wantUser: "root",
+			wantAddr: "[2001:db8::1]:22",
+		},
+		{
+			name:    "Invalid user",
+			address: "Bad User@host",
+			wantErr: true,
+		},
+		{
+			name:    "Empty",
+			address: "deploy@",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			user, addr, err := parseJumpAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJumpAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if user != tt.wantUser || addr != tt.wantAddr {
+				t.Errorf(
+					"parseJumpAddress() = %q, %q, want %q, %q",
+					user, addr, tt.wantUser, tt.wantAddr,
+				)
+			}
+		})
+	}
+}
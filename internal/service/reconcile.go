@@ -0,0 +1,389 @@
+package service
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/provider"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/daos"
+	"github.com/pocketbase/pocketbase/forms"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+// Actions for machines which vanished from their provider
+const (
+	StaleKeep   = "keep"
+	StaleDelete = "delete"
+)
+
+// defaultStaleGrace is used if the provider has no stale_grace in hours
+const defaultStaleGrace = 24 * time.Hour
+
+// SyncSummary is the outcome of a provider sync, saved on the provider
+type SyncSummary struct {
+	Time      time.Time `json:"time"`
+	Found     int       `json:"found"`
+	Filtered  int       `json:"filtered"`
+	Created   int       `json:"created"`
+	Updated   int       `json:"updated"`
+	Unchanged int       `json:"unchanged"`
+	Restored  int       `json:"restored"`
+	Stale     int       `json:"stale"`
+	Deleted   int       `json:"deleted"`
+	Failed    int       `json:"failed"`
+	// Skipped machines are in regions which failed to sync
+	Skipped int      `json:"skipped"`
+	Errors  []string `json:"errors,omitempty"`
+	// FailedRegions are the regions or nodes which failed to sync
+	FailedRegions map[string]string `json:"failed_regions,omitempty"`
+	// MissingGroups are assigned by label rules but don't exist
+	MissingGroups []string `json:"missing_groups,omitempty"`
+}
+
+func newSyncSummary(now time.Time, failed provider.RegionErrors) *SyncSummary {
+	summary := &SyncSummary{Time: now}
+	for region, err := range failed {
+		if summary.FailedRegions == nil {
+			summary.FailedRegions = make(map[string]string)
+		}
+		summary.FailedRegions[region] = err.Error()
+	}
+	return summary
+}
+
+func (s *SyncSummary) fail(name string, err error) {
+	s.Failed++
+	s.Errors = append(s.Errors, fmt.Sprintf("%s: %v", name, err))
+}
+
+// reconcileProvider brings the machines of a provider in line with what the
+// provider reported. Machines are matched on (provider, external_id), new
+// ones are created and known ones get their name, host, running state and
+// the tags and groups of the label rules updated. Vanished machines are
+// marked stale and deleted after the grace period if the provider asks for
+// it, they are restored if they come back. Machines in failed regions, or
+// without a region if any failed, are left alone. The machines whose groups
+// changed are returned once the changes are committed, they need an update.
+func reconcileProvider(
+	app core.App,
+	p *models.Record,
+	found []provider.ProviderMachine,
+	failed provider.RegionErrors,
+	now time.Time,
+) (*SyncSummary, []*models.Record, error) {
+	summary := newSyncSummary(now, failed)
+	summary.Found = len(found)
+
+	rules, err := provider.NewLabelRules(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	grace := time.Duration(p.GetInt("stale_grace")) * time.Hour
+	if grace == 0 {
+		grace = defaultStaleGrace
+	}
+
+	var regrouped []*models.Record
+	err = app.Dao().RunInTransaction(func(txDao *daos.Dao) error {
+		assigner := &labelAssigner{
+			dao:     txDao,
+			rules:   rules,
+			tags:    make(map[string]string),
+			groups:  make(map[string]string),
+			summary: summary,
+		}
+		existing, err := txDao.FindRecordsByFilter(
+			"machines", "provider = {:provider}", "", 0, 0,
+			dbx.Params{"provider": p.Id},
+		)
+		if err != nil {
+			return err
+		}
+		byID := make(map[string]*models.Record)
+		byName := make(map[string]*models.Record)
+		for _, machine := range existing {
+			if id := machine.GetString("external_id"); id != "" {
+				byID[id] = machine
+			} else {
+				// Machines synced before they had an external id
+				byName[machine.GetString("name")] = machine
+			}
+		}
+
+		seen := make(map[string]bool)
+		matched := make(map[string]bool)
+		for _, pm := range found {
+			if pm.ID == "" {
+				summary.fail(pm.Name, fmt.Errorf("missing instance id"))
+				continue
+			}
+			if seen[pm.ID] {
+				continue
+			}
+			seen[pm.ID] = true
+
+			machine := byID[pm.ID]
+			if machine == nil && byName[pm.Name] != nil {
+				machine = byName[pm.Name]
+				delete(byName, pm.Name)
+			}
+			assigned, err := assigner.assign(pm.Labels)
+			if err != nil {
+				return err
+			}
+			if machine == nil {
+				created, err := createProviderMachine(app, txDao, p, pm, assigned)
+				if err != nil {
+					summary.fail(pm.Name, err)
+					continue
+				}
+				if len(assigned.Groups) > 0 {
+					regrouped = append(regrouped, created)
+				}
+				summary.Created++
+				continue
+			}
+			matched[machine.Id] = true
+
+			data := map[string]any{}
+			if machine.GetString("external_id") != pm.ID {
+				data["external_id"] = pm.ID
+			}
+			if pm.Name != "" && machine.GetString("name") != pm.Name {
+				data["name"] = pm.Name
+			}
+			// Instances without an address keep the last known one
+			if pm.Host != "" && machine.GetString("host") != pm.Host {
+				data["host"] = pm.Host
+			}
+			if pm.Port != 0 && machine.GetInt("port") != pm.Port {
+				data["port"] = pm.Port
+			}
+			if machine.GetBool("running") != pm.Running {
+				data["running"] = pm.Running
+			}
+			if machine.GetString("region") != pm.Region {
+				data["region"] = pm.Region
+			}
+			reassign(machine, assigned, data)
+			stale := !machine.GetDateTime("stale_since").IsZero()
+			if stale {
+				data["stale_since"] = ""
+			}
+			if len(data) == 0 {
+				summary.Unchanged++
+				continue
+			}
+			if err := saveMachine(app, txDao, machine, data); err != nil {
+				summary.fail(pm.Name, err)
+				continue
+			}
+			if _, ok := data["groups"]; ok {
+				regrouped = append(regrouped, machine)
+			}
+			if stale {
+				summary.Restored++
+			} else {
+				summary.Updated++
+			}
+		}
+
+		for _, machine := range existing {
+			if matched[machine.Id] {
+				continue
+			}
+			if region := machine.GetString("region"); len(failed) > 0 {
+				if _, ok := failed[region]; ok || region == "" {
+					summary.Skipped++
+					continue
+				}
+			}
+			name := machine.GetString("name")
+			since := machine.GetDateTime("stale_since")
+			if since.IsZero() {
+				err := saveMachine(app, txDao, machine, map[string]any{
+					"stale_since": now,
+					"running":     false,
+				})
+				if err != nil {
+					summary.fail(name, err)
+					continue
+				}
+				summary.Stale++
+				continue
+			}
+			if p.GetString("stale_action") == StaleDelete && now.Sub(since.Time()) >= grace {
+				if err := txDao.DeleteRecord(machine); err != nil {
+					summary.fail(name, err)
+					continue
+				}
+				summary.Deleted++
+				continue
+			}
+			summary.Stale++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return summary, regrouped, nil
+}
+
+// createProviderMachine adds a machine of a provider, tagged with the
+// provider type
+func createProviderMachine(
+	app core.App,
+	dao *daos.Dao,
+	p *models.Record,
+	pm provider.ProviderMachine,
+	assigned ruleAssignments,
+) (*models.Record, error) {
+	if pm.Host == "" {
+		return nil, fmt.Errorf("no address")
+	}
+	collection, err := dao.FindCollectionByNameOrId("machines")
+	if err != nil {
+		return nil, err
+	}
+	tag, err := ensureTag(dao, p.GetString("type"))
+	if err != nil {
+		return nil, err
+	}
+	machine := models.NewRecord(collection)
+	err = saveMachine(app, dao, machine, map[string]any{
+		"name":             pm.Name,
+		"host":             pm.Host,
+		"port":             cmp.Or(pm.Port, 22),
+		"provider":         p.Id,
+		"tags":             mergeNames([]string{tag}, assigned.Tags),
+		"groups":           assigned.Groups,
+		"rule_assignments": assigned,
+		"external_id":      pm.ID,
+		"running":          pm.Running,
+		"region":           pm.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return machine, nil
+}
+
+// ruleAssignments are the tags and groups label rules assigned to a machine
+type ruleAssignments struct {
+	Tags   []string `json:"tags"`
+	Groups []string `json:"groups"`
+}
+
+// labelAssigner resolves the tags and groups of label rules to ids, tags
+// are created on demand while groups define linux accounts and have to exist
+type labelAssigner struct {
+	dao     *daos.Dao
+	rules   []provider.LabelRule
+	tags    map[string]string
+	groups  map[string]string
+	summary *SyncSummary
+}
+
+func (a *labelAssigner) assign(labels map[string]string) (ruleAssignments, error) {
+	result := ruleAssignments{Tags: []string{}, Groups: []string{}}
+	tags, groups := provider.MapLabels(a.rules, labels)
+	for _, name := range tags {
+		if _, ok := a.tags[name]; !ok {
+			id, err := ensureTag(a.dao, name)
+			if err != nil {
+				return result, err
+			}
+			a.tags[name] = id
+		}
+		result.Tags = append(result.Tags, a.tags[name])
+	}
+	for _, name := range groups {
+		if _, ok := a.groups[name]; !ok {
+			if group, _ := a.dao.FindFirstRecordByData("groups", "name", name); group != nil {
+				a.groups[name] = group.Id
+			} else {
+				a.groups[name] = ""
+				a.summary.MissingGroups = append(a.summary.MissingGroups, name)
+			}
+		}
+		if id := a.groups[name]; id != "" {
+			result.Groups = append(result.Groups, id)
+		}
+	}
+	return result, nil
+}
+
+// reassign replaces the tags and groups the label rules assigned before,
+// tags and groups set by hand are kept
+func reassign(machine *models.Record, assigned ruleAssignments, data map[string]any) {
+	var previous ruleAssignments
+	if raw := machine.GetString("rule_assignments"); raw != "" && raw != "null" {
+		_ = json.Unmarshal([]byte(raw), &previous)
+	}
+	for _, field := range []struct {
+		name     string
+		previous []string
+		assigned []string
+	}{
+		{name: "tags", previous: previous.Tags, assigned: assigned.Tags},
+		{name: "groups", previous: previous.Groups, assigned: assigned.Groups},
+	} {
+		current := machine.GetStringSlice(field.name)
+		var ids []string
+		for _, id := range current {
+			if !slices.Contains(field.previous, id) {
+				ids = append(ids, id)
+			}
+		}
+		ids = mergeNames(ids, field.assigned)
+		if !sameIDs(ids, current) {
+			data[field.name] = ids
+		}
+	}
+	if !sameIDs(previous.Tags, assigned.Tags) || !sameIDs(previous.Groups, assigned.Groups) {
+		data["rule_assignments"] = assigned
+	}
+}
+
+func sameIDs(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+// ensureTag returns the id of a tag by name, the tag is created if it
+// doesn't exist
+func ensureTag(dao *daos.Dao, name string) (string, error) {
+	tag, _ := dao.FindFirstRecordByData("tags", "name", name)
+	if tag != nil {
+		return tag.Id, nil
+	}
+	collection, err := dao.FindCollectionByNameOrId("tags")
+	if err != nil {
+		return "", err
+	}
+	tag = models.NewRecord(collection)
+	tag.Set("name", name)
+	if err := dao.SaveRecord(tag); err != nil {
+		return "", fmt.Errorf("failed to save tag %s: %w", name, err)
+	}
+	return tag.Id, nil
+}
+
+// saveMachine validates and saves the changed fields of a machine
+func saveMachine(app core.App, dao *daos.Dao, machine *models.Record, data map[string]any) error {
+	form := forms.NewRecordUpsert(app, machine)
+	form.SetDao(dao)
+	if err := form.LoadData(data); err != nil {
+		return err
+	}
+	return form.Submit()
+}
@@ -0,0 +1,250 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/internal/provider"
+	"github.com/MizuchiLabs/ssh-nexus/test"
+	"github.com/pocketbase/pocketbase/models"
+)
+
+func TestReconcileProvider(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := models.NewRecord(collection)
+	p.Set("name", "reconcile")
+	p.Set("type", "hetzner")
+	p.Set("stale_grace", 1)
+	p.Set("stale_action", StaleDelete)
+	if err := app.Dao().SaveRecord(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// A machine synced before machines had an external id
+	machines, err := app.Dao().FindCollectionByNameOrId("machines")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := models.NewRecord(machines)
+	legacy.Set("name", "legacy")
+	legacy.Set("host", "10.252.0.9")
+	legacy.Set("port", 22)
+	legacy.Set("provider", p.Id)
+	if err := app.Dao().SaveRecord(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(id string) *models.Record {
+		machine, _ := app.Dao().FindFirstRecordByFilter(
+			"machines", "provider = {:provider} && external_id = {:id}",
+			map[string]any{"provider": p.Id, "id": id},
+		)
+		return machine
+	}
+	reconcile := func(now time.Time, found ...provider.ProviderMachine) *SyncSummary {
+		t.Helper()
+		summary, _, err := reconcileProvider(app, p, found, nil, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+
+	now := time.Now()
+	found := []provider.ProviderMachine{
+		{ID: "1", Name: "web", Host: "10.252.0.1", Running: true},
+		{ID: "2", Name: "db", Host: "10.252.0.2", Running: true},
+		{ID: "3", Name: "legacy", Host: "10.252.0.9", Running: true},
+		{ID: "4", Name: "no-address"},
+	}
+	summary := reconcile(now, found...)
+	if summary.Created != 2 || summary.Updated != 1 || summary.Failed != 1 {
+		t.Errorf("first sync = %+v, want 2 created, 1 updated and 1 failed", summary)
+	}
+	if machine := find("3"); machine == nil || machine.Id != legacy.Id {
+		t.Errorf("legacy machine wasn't adopted: %v", machine)
+	}
+
+	summary = reconcile(now, found[:3]...)
+	if summary.Created != 0 || summary.Unchanged != 3 {
+		t.Errorf("second sync = %+v, want 3 unchanged", summary)
+	}
+
+	// Renamed and re-IP'd, the db vanished
+	summary = reconcile(now,
+		provider.ProviderMachine{ID: "1", Name: "web-1", Host: "10.252.0.11"},
+		found[2],
+	)
+	if summary.Updated != 1 || summary.Stale != 1 {
+		t.Errorf("third sync = %+v, want 1 updated and 1 stale", summary)
+	}
+	web := find("1")
+	if web.GetString("name") != "web-1" || web.GetString("host") != "10.252.0.11" || web.GetBool("running") {
+		t.Errorf("web wasn't updated: %v", web.PublicExport())
+	}
+	if find("2").GetDateTime("stale_since").IsZero() {
+		t.Error("db wasn't marked stale")
+	}
+
+	// Back within the grace period
+	summary = reconcile(now.Add(time.Minute), found[1])
+	if summary.Restored != 1 || summary.Stale != 2 {
+		t.Errorf("fourth sync = %+v, want 1 restored and 2 stale", summary)
+	}
+	if !find("2").GetDateTime("stale_since").IsZero() {
+		t.Error("db is still stale")
+	}
+
+	// Stale machines are deleted after the grace period
+	summary = reconcile(now.Add(2*time.Hour), found[1])
+	if summary.Deleted != 2 || summary.Unchanged != 1 {
+		t.Errorf("last sync = %+v, want 2 deleted and 1 unchanged", summary)
+	}
+	if find("1") != nil || find("3") != nil {
+		t.Error("stale machines weren't deleted")
+	}
+}
+
+func TestReconcileLabelRules(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	groups, err := app.Dao().FindCollectionByNameOrId("groups")
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := models.NewRecord(groups)
+	group.Set("name", "rules-payments")
+	group.Set("linux_username", "payments")
+	if err := app.Dao().SaveRecord(group); err != nil {
+		t.Fatal(err)
+	}
+
+	providers, err := app.Dao().FindCollectionByNameOrId("providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := models.NewRecord(providers)
+	p.Set("name", "label-rules")
+	p.Set("type", "hetzner")
+	p.Set("label_rules", []provider.LabelRule{
+		{Label: "env=prod", Tag: "rules-prod"},
+		{Label: "team", Group: "rules-{value}"},
+	})
+	if err := app.Dao().SaveRecord(p); err != nil {
+		t.Fatal(err)
+	}
+
+	machine := provider.ProviderMachine{
+		ID:     "1",
+		Name:   "labeled",
+		Host:   "10.253.0.1",
+		Labels: map[string]string{"env": "prod", "team": "payments"},
+	}
+	summary, regrouped, err := reconcileProvider(app, p, []provider.ProviderMachine{machine}, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 1 {
+		t.Fatalf("summary = %+v, want 1 created", summary)
+	}
+	record, err := app.Dao().FindFirstRecordByData("machines", "external_id", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regrouped) != 1 || regrouped[0].Id != record.Id {
+		t.Errorf("regrouped = %v, want the created machine", regrouped)
+	}
+	prod, err := app.Dao().FindFirstRecordByData("tags", "name", "rules-prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(record.GetStringSlice("tags"), prod.Id) {
+		t.Errorf("machine tags = %v, want %s", record.GetStringSlice("tags"), prod.Id)
+	}
+	if groups := record.GetStringSlice("groups"); !reflect.DeepEqual(groups, []string{group.Id}) {
+		t.Errorf("machine groups = %v, want [%s]", groups, group.Id)
+	}
+
+	// Hand assigned tags stay when the labels change
+	handTag, err := ensureTag(app.Dao(), "rules-hand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	record.Set("tags", append(record.GetStringSlice("tags"), handTag))
+	if err := app.Dao().SaveRecord(record); err != nil {
+		t.Fatal(err)
+	}
+	machine.Labels = map[string]string{"env": "dev", "team": "unknown"}
+	summary, regrouped, err = reconcileProvider(app, p, []provider.ProviderMachine{machine}, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regrouped) != 1 || regrouped[0].Id != record.Id {
+		t.Errorf("regrouped = %v, want the updated machine", regrouped)
+	}
+	if summary.Updated != 1 || !slices.Equal(summary.MissingGroups, []string{"rules-unknown"}) {
+		t.Errorf("summary = %+v, want 1 updated and a missing group", summary)
+	}
+	record, err = app.Dao().FindRecordById("machines", record.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := record.GetStringSlice("tags")
+	if slices.Contains(tags, prod.Id) || !slices.Contains(tags, handTag) {
+		t.Errorf("machine tags = %v, want %s but not %s", tags, handTag, prod.Id)
+	}
+	if groups := record.GetStringSlice("groups"); len(groups) != 0 {
+		t.Errorf("machine groups = %v, want none", groups)
+	}
+}
+
+func TestReconcileFailedRegions(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := models.NewRecord(collection)
+	p.Set("name", "regions")
+	p.Set("type", "proxmox")
+	if err := app.Dao().SaveRecord(p); err != nil {
+		t.Fatal(err)
+	}
+
+	found := []provider.ProviderMachine{
+		{ID: "100", Name: "web", Host: "10.254.0.1", Region: "pve1"},
+		{ID: "200", Name: "db", Host: "10.254.0.2", Region: "pve2"},
+	}
+	if _, _, err := reconcileProvider(app, p, found, nil, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// pve2 is offline, its machines aren't reported but also not stale
+	failed := provider.RegionErrors{"pve2": fmt.Errorf("node is offline")}
+	summary, _, err := reconcileProvider(app, p, found[:1], failed, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Skipped != 1 || summary.Stale != 0 || summary.FailedRegions["pve2"] != "node is offline" {
+		t.Errorf("summary = %+v, want 1 skipped and the failed region", summary)
+	}
+	db, err := app.Dao().FindFirstRecordByData("machines", "external_id", "200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.GetString("region") != "pve2" || !db.GetDateTime("stale_since").IsZero() {
+		t.Errorf("db = %v, want region pve2 and not stale", db.PublicExport())
+	}
+}
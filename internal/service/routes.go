@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"github.com/labstack/echo/v5"
 	"github.com/pocketbase/pocketbase/apis"
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/models"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -28,6 +30,35 @@ func initRoutes(app core.App) {
 			func(c echo.Context) error { return getUserMachines(c, app) },
 		)
 
+		authorized.GET(
+			"/sessions/last",
+			func(c echo.Context) error { return getLastLogins(c, app) },
+		)
+
+		authorized.POST(
+			"/machines/:id/repin",
+			func(c echo.Context) error { return repinHostKey(c, app) },
+		)
+		authorized.POST(
+			"/machines/:id/check",
+			func(c echo.Context) error { return checkMachineReadiness(c, app) },
+		)
+		authorized.POST(
+			"/machines/import",
+			func(c echo.Context) error { return importMachines(c, app) },
+		)
+		authorized.POST(
+			"/apply",
+			func(c echo.Context) error { return applyConfig(c, app) },
+		)
+		authorized.POST(
+			"/machines/check",
+			func(c echo.Context) error { return checkMachinesReadiness(c, app) },
+		)
+		authorized.GET(
+			"/inventory/ansible",
+			func(c echo.Context) error { return getAnsibleInventory(c, app) },
+		)
 		api.GET("/rpc/certificate", getServerCertificate)
 		authorized.GET("/rpc/token", getAgentToken)
 		authorized.POST("/rpc/token/rotate", rotateAgentToken)
@@ -62,6 +93,10 @@ func initRoutes(app core.App) {
 			"/sync/providers",
 			func(c echo.Context) error { return forceSync(c, app, syncProviders) },
 		)
+		authorized.POST(
+			"/jobs/:id/cancel",
+			func(c echo.Context) error { return cancelJob(c, app) },
+		)
 
 		return nil
 	})
@@ -150,6 +185,203 @@ func getUserMachines(c echo.Context, app core.App) error {
 	)
 }
 
+func getLastLogins(c echo.Context, app core.App) error {
+	admin := apis.RequestInfo(c).Admin
+	user := apis.RequestInfo(c).AuthRecord
+
+	// Users without access to other users only see their own logins
+	userID := c.QueryParam("user")
+	if admin == nil && user != nil {
+		permission, _ := app.Dao().FindRecordById("permissions", user.GetString("permission"))
+		if permission == nil ||
+			(!permission.GetBool("is_admin") && !permission.GetBool("access_users")) {
+			userID = user.Id
+		}
+	}
+
+	sessions, err := GetLastLogins(app, userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{"sessions": sessions})
+}
+
+func getAnsibleInventory(c echo.Context, app core.App) error {
+	// Admins get all machines, users the ones they can log in to
+	var user *models.Record
+	if apis.RequestInfo(c).Admin == nil {
+		user = apis.RequestInfo(c).AuthRecord
+	}
+
+	export, err := AnsibleInventory(app, user)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, export)
+}
+
+func repinHostKey(c echo.Context, app core.App) error {
+	admin := apis.RequestInfo(c).Admin
+	user := apis.RequestInfo(c).AuthRecord
+
+	if admin == nil {
+		permission, _ := app.Dao().FindRecordById("permissions", user.GetString("permission"))
+		if permission == nil || !permission.GetBool("is_admin") {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can re-pin host keys"})
+		}
+	}
+
+	machine, err := app.Dao().FindRecordById("machines", c.PathParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "machine not found"})
+	}
+
+	hostKey, err := RepinHostKey(app, machine)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"host_key": hostKey})
+}
+
+func checkMachineReadiness(c echo.Context, app core.App) error {
+	if !canManageMachines(c, app) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can check machines"})
+	}
+
+	machine, err := app.Dao().FindRecordById("machines", c.PathParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "machine not found"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), jobTimeout)
+	defer cancel()
+	report, err := CheckMachine(ctx, app, machine)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+func checkMachinesReadiness(c echo.Context, app core.App) error {
+	if !canManageMachines(c, app) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can check machines"})
+	}
+
+	// Without a list all machines are checked
+	var body struct {
+		Machines []string `json:"machines"`
+	}
+	if err := c.Bind(&body); err != nil && c.Request().ContentLength > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var user string
+	if record := apis.RequestInfo(c).AuthRecord; record != nil {
+		user = record.Id
+	}
+	job, err := checkMachines(app, user, body.Machines)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": job.GetString("status"),
+		"job":    job.Id,
+	})
+}
+
+func importMachines(c echo.Context, app core.App) error {
+	if !canManageMachines(c, app) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can import machines"})
+	}
+
+	var body struct {
+		ImportOptions
+		Format   string `json:"format"`
+		Filename string `json:"filename"`
+		Content  string `json:"content"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	hosts, err := parseInventory(body.Format, body.Filename, []byte(body.Content))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var user string
+	if record := apis.RequestInfo(c).AuthRecord; record != nil {
+		user = record.Id
+	}
+	summary, err := ImportMachines(app, user, hosts, body.ImportOptions)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, summary)
+}
+
+func applyConfig(c echo.Context, app core.App) error {
+	if !canManageMachines(c, app) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can apply configurations"})
+	}
+
+	var body struct {
+		Content string `json:"content"`
+		Prune   bool   `json:"prune"`
+		DryRun  bool   `json:"dry_run"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	spec, err := ParseApplySpec(strings.NewReader(body.Content))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	plan, err := PlanApply(app, spec, body.Prune)
+	if err != nil {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	result := map[string]any{
+		"plan":    plan,
+		"diff":    FormatPlan(plan),
+		"applied": false,
+	}
+	if body.DryRun || len(plan.Changes) == 0 {
+		return c.JSON(http.StatusOK, result)
+	}
+	if err := ExecuteApply(app, plan); err != nil {
+		return c.JSON(http.StatusConflict, map[string]any{"error": err.Error(), "plan": plan})
+	}
+	result["applied"] = true
+
+	if plan.needsSync() {
+		var user string
+		if record := apis.RequestInfo(c).AuthRecord; record != nil {
+			user = record.Id
+		}
+		job, err := updateAllMachines(app, user)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		result["job"] = job.Id
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// canManageMachines checks if the request comes from an admin or a user with
+// the admin permission
+func canManageMachines(c echo.Context, app core.App) bool {
+	if apis.RequestInfo(c).Admin != nil {
+		return true
+	}
+	user := apis.RequestInfo(c).AuthRecord
+	if user == nil {
+		return false
+	}
+	permission, _ := app.Dao().FindRecordById("permissions", user.GetString("permission"))
+	return permission != nil && permission.GetBool("is_admin")
+}
+
 func getPublicKey(fetchKey func() ([]byte, error)) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		publicKey, err := fetchKey()
@@ -212,11 +444,48 @@ func rotateAgentToken(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
 
-func forceSync(c echo.Context, app core.App, syncFunc func(core.App) error) error {
-	if err := syncFunc(app); err != nil {
+func forceSync(
+	c echo.Context,
+	app core.App,
+	syncFunc func(core.App, string) (*models.Record, error),
+) error {
+	var user string
+	if record := apis.RequestInfo(c).AuthRecord; record != nil {
+		user = record.Id
+	}
+	job, err := syncFunc(app, user)
+	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	return c.JSON(http.StatusAccepted, map[string]string{
+		"status": job.GetString("status"),
+		"job":    job.Id,
+	})
+}
+
+func cancelJob(c echo.Context, app core.App) error {
+	admin := apis.RequestInfo(c).Admin
+	user := apis.RequestInfo(c).AuthRecord
+
+	job, err := app.Dao().FindRecordById("jobs", c.PathParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "job not found"})
+	}
+
+	// Users can cancel their own jobs
+	if admin == nil && user.Id != job.GetString("user") {
+		permission, _ := app.Dao().FindRecordById("permissions", user.GetString("permission"))
+		if permission == nil || !permission.GetBool("is_admin") {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "only admins can cancel this job"})
+		}
+	}
+	if !CancelJob(job.Id) {
+		return c.JSON(
+			http.StatusConflict,
+			map[string]string{"error": "job is not running", "status": job.GetString("status")},
+		)
+	}
+	return c.JSON(http.StatusAccepted, map[string]string{"status": "canceling", "job": job.Id})
 }
 
 func signUserCertificate(c echo.Context, app core.App) error {
@@ -1,19 +1,19 @@
 package service
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
+	"github.com/MizuchiLabs/ssh-nexus/api/server"
 	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+	"github.com/MizuchiLabs/ssh-nexus/tools/host"
 	"github.com/MizuchiLabs/ssh-nexus/tools/updater"
-	"github.com/MizuchiLabs/ssh-nexus/tools/util"
 	"github.com/pkg/sftp"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
@@ -22,244 +22,403 @@ import (
 
 // ManualUpdate for machines running without an agent
 func ManualUpdate(app core.App, machine *models.Record) {
+	_ = updateMachine(context.Background(), app, machine)
+}
+
+// updateMachine writes the configuration of a machine without an agent, the
+// error is also saved on the machine
+func updateMachine(ctx context.Context, app core.App, machine *models.Record) (err error) {
 	if machine.GetBool("agent") {
 		slog.Debug("Skipping manual update for machine", "name", machine.GetString("name"))
-		return
+		return nil
 	}
-	defer func() {
-		if err := app.Dao().SaveRecord(machine); err != nil {
-			slog.Error("Failed to save machine", "name", machine.GetString("name"), "err", err)
-		}
-	}()
+	defer saveMachineError(app, machine, &err)
 
-	conn, err := connect(machine)
+	conn, err := connectContext(ctx, app, machine)
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 	defer conn.Close()
 
+	client, err := newSFTP(conn)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	fsys := remoteFS{client: client}
+	backup := host.NewBackup(fsys)
+
 	// Prepare SSH Configuration & Principals
 	sshConfig, err := app.Dao().FindFirstRecordByData("settings", "key", "ssh_config")
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 	publicKeyFile, err := data.GetPublicUserKey()
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
-	commands := []string{
-		fmt.Sprintf("mkdir -p %s", data.PrincipalPath),
-		fmt.Sprintf("echo -n '%s' | tee %s", string(publicKeyFile), data.PublicUserKeyPath),
-		fmt.Sprintf("echo -n '%s' | tee %s", sshConfig.GetString("value"), data.SSHConfigPath),
+	if err := backup.Snapshot(data.PublicUserKeyPath, data.SSHConfigPath); err != nil {
+		return err
 	}
-	command := strings.Join(commands, "; ")
-	if _, err = run(conn, command); err != nil {
-		machine.Set("error", err.Error())
-		return
+	if err := fsys.WriteFile(data.PublicUserKeyPath, publicKeyFile, 0644); err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(data.SSHConfigPath), 0755); err != nil {
+		return err
+	}
+	if err := fsys.WriteFile(data.SSHConfigPath, []byte(sshConfig.GetString("value")), 0644); err != nil {
+		return err
+	}
+
+	accounts, err := server.MachineAccounts(app, machine)
+	if err != nil {
+		return err
+	}
+
+	if err := setAccounts(conn, backup, accounts, server.AccountPolicy(app)); err != nil {
+		return err
 	}
 
 	groups, err := GetMachineUsers(app, machine)
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 
-	if err := setPrincipals(conn, groups); err != nil {
-		machine.Set("error", err.Error())
-		return
+	if err := setPrincipals(fsys, backup, groups); err != nil {
+		return err
 	}
+
+	keys, err := server.MachineAuthorizedKeys(app, machine)
+	if err != nil {
+		return err
+	}
+
+	if err := setAuthorizedKeys(conn, fsys, backup, keys); err != nil {
+		return err
+	}
+	return nil
 }
 
-// TODO: Check if agent is installed and running, if not try to restart
+// InstallAgent installs the agent on a machine
 func InstallAgent(app core.App, machine *models.Record) {
+	_ = installAgent(context.Background(), app, machine)
+}
+
+// TODO: Check if agent is installed and running, if not try to restart
+func installAgent(ctx context.Context, app core.App, machine *models.Record) (err error) {
 	if machine.GetBool("agent") {
 		slog.Debug("Skipping install for machine", "name", machine.GetString("name"))
-		return
+		return nil
 	}
-	defer func() {
-		if err := app.Dao().SaveRecord(machine); err != nil {
-			slog.Error("Failed to save machine", "name", machine.GetString("name"), "err", err)
-		}
-	}()
+	defer saveMachineError(app, machine, &err)
 
 	settings, err := app.Dao().FindSettings(os.Getenv("PB_ENCRYPTION_KEY"))
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 
-	conn, err := connect(machine)
+	conn, err := connectContext(ctx, app, machine)
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 	defer conn.Close()
 
 	agentToken, err := data.GetToken()
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
 	}
 
-	if err = uploadAgent(conn); err != nil {
-		machine.Set("error", err.Error())
-		return
+	client, err := newSFTP(conn)
+	if err != nil {
+		return err
 	}
+	defer client.Close()
+	fsys := remoteFS{client: client}
 
-	appURL, err := url.Parse(settings.Meta.AppUrl)
+	platform, err := remotePlatform(conn)
 	if err != nil {
-		machine.Set("error", err.Error())
-		return
+		return err
+	}
+	service, err := remoteInit(conn)
+	if err != nil {
+		return err
 	}
+	machine.Set("init_system", service.Name)
 
-	agentPath := "/usr/local/bin/nexus-agent"
-	systemdPath := "/etc/systemd/system/nexus-agent.service"
-	systemdConfig := fmt.Sprintf(`[Unit]
-Description=Nexus Agent
-After=network.target
+	paths := append([]string{data.AgentPath, data.Token}, service.Paths...)
+	if err := host.NewBackup(fsys).Snapshot(paths...); err != nil {
+		return err
+	}
 
-[Service]
-Type=simple
-User=root
-Group=root
-ExecStart=%s -server %s
-Restart=always
-RestartSec=5
+	if err := uploadAgent(fsys, platform); err != nil {
+		return err
+	}
 
-[Install]
-WantedBy=multi-user.target`, agentPath, appURL.Hostname())
+	appURL, err := url.Parse(settings.Meta.AppUrl)
+	if err != nil {
+		return err
+	}
 
 	// Install Agent
-	commands := []string{
-		fmt.Sprintf("chmod +x %s", agentPath),
-		fmt.Sprintf("echo -n '%s' | tee %s", systemdConfig, systemdPath),
-		fmt.Sprintf("echo -n '%s' | tee %s", agentToken, data.Token),
-		"systemctl daemon-reload",
-		"systemctl enable nexus-agent",
-		"systemctl start nexus-agent",
-	}
-	command := strings.Join(commands, "; ")
-	if _, err := run(conn, command); err != nil {
-		machine.Set("error", err.Error())
-		return
+	if err := fsys.MkdirAll(filepath.Dir(service.Path), 0755); err != nil {
+		return err
+	}
+	definition := service.Render(data.AgentPath, appURL.Hostname())
+	if err := fsys.WriteFile(service.Path, []byte(definition), service.Mode); err != nil {
+		return err
+	}
+	if err := writeToken(fsys, []byte(agentToken)); err != nil {
+		return err
+	}
+	if _, err := run(conn, service.Enable); err != nil {
+		return fmt.Errorf("failed to enable the agent with %s: %w", service.Name, err)
+	}
+	if err := waitForAgent(ctx, conn, service); err != nil {
+		return fmt.Errorf("agent is not running after install with %s: %w", service.Name, err)
+	}
+	return nil
+}
+
+// waitForAgent checks the status of the agent until it runs, supervisors
+// like runit only pick up new services after a few seconds
+func waitForAgent(ctx context.Context, conn *remoteConn, service host.InitSystem) error {
+	var err error
+	for range 5 {
+		if _, err = run(conn, service.Status); err == nil {
+			return nil
+		}
+		select {
+		case <-time.After(2 * time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
+
+// remoteInit detects the init system of a machine
+func remoteInit(conn *remoteConn) (host.InitSystem, error) {
+	output, err := run(conn, host.DetectInitScript)
+	if err != nil {
+		return host.InitSystem{}, fmt.Errorf("failed to detect init system: %w", err)
+	}
+	return host.DetectInit(string(output))
+}
+
+// saveMachineError saves the outcome of a task on the machine
+func saveMachineError(app core.App, machine *models.Record, err *error) {
+	if *err != nil {
+		machine.Set("error", (*err).Error())
+	} else {
+		machine.Set("error", "")
+	}
+	if err := app.Dao().SaveRecord(machine); err != nil {
+		slog.Error("Failed to save machine", "name", machine.GetString("name"), "err", err)
 	}
 }
 
-func Restore(machine *models.Record) {
+// Restore resets the files on a machine to their state before nexus was installed
+func Restore(app core.App, machine *models.Record) {
 	if machine.GetBool("agent") {
 		slog.Debug("Skipping restore for machine", "name", machine.GetString("name"))
 		return
 	}
 
-	conn, err := connect(machine)
+	conn, err := connect(app, machine)
 	if err != nil {
 		slog.Error("Failed to connect to machine", "name", machine.GetString("name"), "err", err)
 		return
 	}
 	defer conn.Close()
 
-	commands := []string{
-		fmt.Sprintf("rm -rf %s", data.PrincipalPath),
-		fmt.Sprintf("rm %s", data.SSHConfigPath),
-		fmt.Sprintf("rm %s", data.PublicUserKeyPath),
-		fmt.Sprintf("rm %s", data.PublicHostKeyPath),
-		fmt.Sprintf("rm %s", data.AgentPath),
-		fmt.Sprintf("rm %s", data.AgentService),
-		fmt.Sprintf("rm %s", data.Token),
-		"systemctl disable nexus-agent.service",
-		"systemctl stop nexus-agent.service",
-		"systemctl daemon-reload",
-	}
-
-	command := strings.Join(commands, "; ")
-	if _, err := run(conn, command); err != nil {
+	// Ignore errors, the agent might not be installed
+	service, err := remoteInit(conn)
+	if err != nil {
+		slog.Warn("Failed to detect init system", "name", machine.GetString("name"), "err", err)
+	} else {
+		_, _ = run(conn, service.Stop)
+		_, _ = run(conn, service.Disable)
+	}
+
+	client, err := newSFTP(conn)
+	if err != nil {
 		slog.Error("Failed to restore machine", "name", machine.GetString("name"), "err", err)
 		return
 	}
+	defer client.Close()
+
+	// Files which only exist because of nexus, in case there is no backup
+	leftovers := append([]string{
+		data.PrincipalPath,
+		data.SSHConfigPath,
+		data.PublicUserKeyPath,
+		data.AgentPath,
+		data.Token,
+	}, host.AgentServicePaths()...)
+	restored, err := host.NewBackup(remoteFS{client: client}).Restore(leftovers...)
+	for _, file := range restored {
+		slog.Info(
+			"Restored file",
+			"name", machine.GetString("name"),
+			"path", file.Path,
+			"action", file.Action,
+		)
+	}
+	if err != nil {
+		slog.Error("Failed to restore machine", "name", machine.GetString("name"), "err", err)
+	}
+	if err := insertRestoreLog(app, machine, restored); err != nil {
+		slog.Error("Failed to save restore report", "name", machine.GetString("name"), "err", err)
+	}
+
+	if service.Reload != "" {
+		if _, err := run(conn, service.Reload); err != nil {
+			slog.Error("Failed to reload init system", "name", machine.GetString("name"), "err", err)
+		}
+	}
 }
 
-func uploadAgent(conn *ssh.Client) error {
-	if conn == nil {
+// remotePlatform detects the os and architecture of a machine
+func remotePlatform(conn *remoteConn) (updater.Platform, error) {
+	output, err := run(conn, "uname -sm")
+	if err != nil {
+		return updater.Platform{}, fmt.Errorf("failed to detect platform: %w", err)
+	}
+	return updater.ParseUname(string(output))
+}
+
+// uploadAgent installs the agent build matching the platform of the machine
+func uploadAgent(fsys remoteFS, platform updater.Platform) error {
+	if fsys.client == nil {
 		return fmt.Errorf("no connection provided")
 	}
 
-	if err := updater.CheckAgent(); err != nil {
+	agentPath, err := updater.AgentBinary(platform)
+	if err != nil {
 		return err
 	}
 
-	localAgent, err := os.Open(data.AgentDownloadPath)
+	localAgent, err := os.Open(agentPath)
 	if err != nil {
 		return err
 	}
 	defer localAgent.Close()
 
-	client, err := sftp.NewClient(conn)
-	if err != nil {
+	return fsys.WriteFrom(data.AgentPath, localAgent, 0755)
+}
+
+// writeToken saves the agent token on a machine
+func writeToken(fsys remoteFS, token []byte) error {
+	if err := fsys.MkdirAll(filepath.Dir(data.Token), 0700); err != nil {
 		return err
 	}
-	defer client.Close()
+	return fsys.WriteFile(data.Token, token, 0600)
+}
 
-	remoteAgentPath := "/usr/local/bin/nexus-agent"
-	remoteAgent, err := client.Create(remoteAgentPath)
-	if err != nil {
-		return err
+// setAccounts makes sure the linux accounts exist on a machine
+func setAccounts(conn *remoteConn, backup *host.Backup, accounts []host.Account, policy string) error {
+	if conn == nil {
+		return fmt.Errorf("no connection provided")
 	}
-	defer remoteAgent.Close()
 
-	_, err = io.Copy(remoteAgent, localAgent)
+	script, err := host.AccountScript(accounts, policy)
 	if err != nil {
 		return err
 	}
-
-	if err := client.Chmod(remoteAgentPath, 0755); err != nil {
-		return err
+	if err := backup.Snapshot(host.AccountPaths(accounts)...); err != nil {
+		return fmt.Errorf("failed to backup files: %w", err)
+	}
+	if _, err := run(conn, "sh -c "+host.Quote(script)); err != nil {
+		return fmt.Errorf("failed to update accounts: %w", err)
 	}
-
 	return nil
 }
 
-// UpdatePrincipal checks the principals on a machine and updates them if necessary.
-func setPrincipals(conn *ssh.Client, groups map[string][]string) error {
-	var groupsList []string
-	for group, principals := range groups {
-		groupsList = append(groupsList, group)
-		GroupPath := filepath.Join(data.PrincipalPath, group)
+// setAuthorizedKeys renders the managed authorized_keys blocks on a machine
+func setAuthorizedKeys(
+	conn *remoteConn,
+	fsys host.FS,
+	backup *host.Backup,
+	keys map[string][]string,
+) error {
+	if conn == nil {
+		return fmt.Errorf("no connection provided")
+	}
 
-		commands := []string{
-			fmt.Sprintf("touch %s", GroupPath),
-			fmt.Sprintf("echo -e '%s' | tee %s", strings.Join(principals, "\n"), GroupPath),
-		}
-		command := strings.Join(commands, "; ")
-		if _, err := run(conn, command); err != nil {
-			return err
+	lookup := func(name string) (*host.LinuxUser, error) {
+		passwd, err := run(conn, "getent passwd "+host.Quote(name))
+		if err != nil {
+			return nil, err
 		}
+		return host.ParsePasswd(string(passwd))
 	}
+	if err := host.UpdateAuthorizedKeys(fsys, backup, lookup, keys); err != nil {
+		return fmt.Errorf("failed to update authorized keys: %w", err)
+	}
+	return nil
+}
 
-	// Get the current groups on the machine and compare them
-	currentGroups, err := run(conn, "ls -1 "+data.PrincipalPath)
-	if err != nil {
-		return err
+// setPrincipals writes the principals of every linux user on a machine
+func setPrincipals(fsys host.FS, backup *host.Backup, groups map[string][]string) error {
+	if err := host.UpdatePrincipals(fsys, backup, data.PrincipalPath, groups); err != nil {
+		return fmt.Errorf("failed to update principals: %w", err)
 	}
+	return nil
+}
 
-	// Check if the groups are the same if not, delete them
-	groupState := strings.Split(strings.TrimSpace(string(currentGroups)), "\n")
-	groupDiff := util.Diff(groupState, groupsList)
-	if len(groupDiff) > 0 {
-		for _, group := range groupDiff {
-			if _, err = run(conn, "rm -f "+data.PrincipalPath+group); err != nil {
-				return err
+// remoteConn is an SSH connection to a machine, commands are escalated to
+// root if the login user isn't root
+type remoteConn struct {
+	*ssh.Client
+	user   string
+	become string
+	// jumps are the connections to the jump hosts, in dial order
+	jumps []*ssh.Client
+	// stop releases the context of the connection
+	stop func() bool
+}
+
+// Close closes the connection and all jump host connections
+func (c *remoteConn) Close() error {
+	if c.stop != nil {
+		c.stop()
+	}
+	err := c.Client.Close()
+	for i := len(c.jumps) - 1; i >= 0; i-- {
+		c.jumps[i].Close()
+	}
+	return err
+}
+
+// sshLogin returns the login user and privilege escalation of a machine, the
+// provider of the machine supplies the defaults
+func sshLogin(app core.App, machine *models.Record) (string, string) {
+	user := machine.GetString("ssh_user")
+	become := machine.GetString("become")
+	if providerID := machine.GetString("provider"); providerID != "" && app != nil &&
+		(user == "" || become == "") {
+		provider, err := app.Dao().FindRecordById("providers", providerID)
+		if err == nil {
+			if user == "" {
+				user = provider.GetString("ssh_user")
+			}
+			if become == "" {
+				become = provider.GetString("become")
 			}
 		}
 	}
 
-	return nil
+	if user == "" {
+		user = "root"
+	}
+	if user == "root" || become == "" {
+		become = host.DefaultBecome(user)
+	}
+	return user, become
 }
 
 // Opens a new SSH connection
-func connect(machine *models.Record) (*ssh.Client, error) {
+func connect(app core.App, machine *models.Record) (*remoteConn, error) {
 	if machine == nil {
 		return nil, fmt.Errorf("no machine provided")
 	}
@@ -269,21 +428,104 @@ func connect(machine *models.Record) (*ssh.Client, error) {
 		return nil, err
 	}
 
+	hops, err := jumpChain(app, machine, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	auth := []ssh.AuthMethod{ssh.PublicKeys(signer)}
+
+	var jumps []*ssh.Client
+	closeJumps := func() {
+		for i := len(jumps) - 1; i >= 0; i-- {
+			jumps[i].Close()
+		}
+	}
+	var via *ssh.Client
+	for _, hop := range hops {
+		client, err := dial(via, hop.addr, &ssh.ClientConfig{
+			User:            hop.user,
+			Auth:            auth,
+			HostKeyCallback: hop.hostKey,
+			Timeout:         5 * time.Second,
+		})
+		if err != nil {
+			closeJumps()
+			return nil, fmt.Errorf("jump host %s: %w", hop.name, err)
+		}
+		hop.pinned()
+		jumps = append(jumps, client)
+		via = client
+	}
+
+	user, become := sshLogin(app, machine)
 	addr := net.JoinHostPort(machine.GetString("host"), machine.GetString("port"))
-	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
-		User:            "root",
-		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	conn, err := dial(via, addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback(machine),
 		Timeout:         5 * time.Second,
 	})
 	if err != nil {
+		closeJumps()
 		return nil, err
 	}
 
+	return &remoteConn{Client: conn, user: user, become: become, jumps: jumps}, nil
+}
+
+// connectContext opens a new SSH connection which is closed when the context
+// is done, interrupting everything running over it
+func connectContext(ctx context.Context, app core.App, machine *models.Record) (*remoteConn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := connect(app, machine)
+	if err != nil {
+		return nil, err
+	}
+	conn.stop = context.AfterFunc(ctx, func() { conn.Close() })
 	return conn, nil
 }
 
-func run(client *ssh.Client, command string) ([]byte, error) {
+// newSFTP opens an sftp session as root. Non-root logins run sftp-server
+// through sudo or doas instead of uploading to a temporary file and moving
+// it with sudo install: the file operations also read, stat, back up and
+// chown root owned files, and every other command already needs the same
+// unrestricted escalation.
+func newSFTP(conn *remoteConn) (*sftp.Client, error) {
+	if conn.become == host.BecomeNone {
+		return sftp.NewClient(conn.Client)
+	}
+
+	session, err := conn.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(host.Privileged(conn.become, host.SFTPServerCommand())); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start sftp-server: %w", err)
+	}
+
+	client, err := sftp.NewClientPipe(stdout, stdin)
+	if err != nil {
+		session.Close()
+		return nil, fmt.Errorf("failed to start sftp-server with %s: %w", conn.become, err)
+	}
+	return client, nil
+}
+
+func run(client *remoteConn, command string) ([]byte, error) {
+	command = host.Privileged(client.become, command)
 	var lastErr error
 	for attempt := 0; attempt < 3; attempt++ {
 		session, err := client.NewSession()
@@ -5,8 +5,9 @@ import (
 	"testing"
 
 	"github.com/MizuchiLabs/ssh-nexus/test"
+	"github.com/MizuchiLabs/ssh-nexus/tools/updater"
+	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
-	"golang.org/x/crypto/ssh"
 )
 
 // func TestManualUpdate(t *testing.T) {
@@ -76,6 +77,7 @@ import (
 //
 // func TestRestore(t *testing.T) {
 // 	type args struct {
+// 		app     core.App
 // 		machine *models.Record
 // 	}
 // 	tests := []struct {
@@ -88,14 +90,15 @@ import (
 // 		tt := tt
 // 		t.Run(tt.name, func(t *testing.T) {
 // 			t.Parallel()
-// 			Restore(tt.args.machine)
+// 			Restore(tt.args.app, tt.args.machine)
 // 		})
 // 	}
 // }
 
 func Test_uploadAgent(t *testing.T) {
 	type args struct {
-		conn *ssh.Client
+		fsys     remoteFS
+		platform updater.Platform
 	}
 	tests := []struct {
 		name    string
@@ -105,7 +108,8 @@ func Test_uploadAgent(t *testing.T) {
 		{
 			name: "Not connected",
 			args: args{
-				conn: nil,
+				fsys:     remoteFS{},
+				platform: updater.Platform{OS: "linux", Arch: "amd64"},
 			},
 			wantErr: true,
 		},
@@ -114,44 +118,22 @@ func Test_uploadAgent(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if err := uploadAgent(tt.args.conn); (err != nil) != tt.wantErr {
+			if err := uploadAgent(tt.args.fsys, tt.args.platform); (err != nil) != tt.wantErr {
 				t.Errorf("uploadAgent() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
-func Test_setPrincipals(t *testing.T) {
-	type args struct {
-		conn   *ssh.Client
-		groups map[string][]string
-	}
-	tests := []struct {
-		name    string
-		args    args
-		wantErr bool
-	}{
-		// TODO: Add test cases.
-	}
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			t.Parallel()
-			if err := setPrincipals(tt.args.conn, tt.args.groups); (err != nil) != tt.wantErr {
-				t.Errorf("setPrincipals() error = %v, wantErr %v", err, tt.wantErr)
-			}
-		})
-	}
-}
-
 func Test_connect(t *testing.T) {
 	type args struct {
+		app     core.App
 		machine *models.Record
 	}
 	tests := []struct {
 		name    string
 		args    args
-		want    *ssh.Client
+		want    *remoteConn
 		wantErr bool
 	}{
 		{
@@ -165,6 +147,7 @@ func Test_connect(t *testing.T) {
 		{
 			name: "Connected",
 			args: args{
+				app:     test.SetupApp(t),
 				machine: test.GetRecord(t, "machines", "agent = false"),
 			},
 			want:    nil,
@@ -175,7 +158,7 @@ func Test_connect(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			got, err := connect(tt.args.machine)
+			got, err := connect(tt.args.app, tt.args.machine)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("connect() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -189,7 +172,7 @@ func Test_connect(t *testing.T) {
 
 func Test_run(t *testing.T) {
 	type args struct {
-		client  *ssh.Client
+		client  *remoteConn
 		command string
 	}
 	tests := []struct {
@@ -215,3 +198,56 @@ func Test_run(t *testing.T) {
 		})
 	}
 }
+
+func Test_sshLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		become     string
+		wantUser   string
+		wantBecome string
+	}{
+		{
+			name:       "Default",
+			wantUser:   "root",
+			wantBecome: "none",
+		},
+		{
+			name:       "Deploy user",
+			user:       "deploy",
+			wantUser:   "deploy",
+			wantBecome: "sudo",
+		},
+		{
+			name:       "Doas",
+			user:       "deploy",
+			become:     "doas",
+			wantUser:   "deploy",
+			wantBecome: "doas",
+		},
+		{
+			name:       "Root never escalates",
+			user:       "root",
+			become:     "sudo",
+			wantUser:   "root",
+			wantBecome: "none",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			machine := test.GetRecord(t, "machines", "agent = false")
+			machine.Set("provider", "")
+			machine.Set("ssh_user", tt.user)
+			machine.Set("become", tt.become)
+			user, become := sshLogin(nil, machine)
+			if user != tt.wantUser || become != tt.wantBecome {
+				t.Errorf(
+					"sshLogin() = %q, %q, want %q, %q",
+					user, become, tt.wantUser, tt.wantBecome,
+				)
+			}
+		})
+	}
+}
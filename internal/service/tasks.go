@@ -1,19 +1,20 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/MizuchiLabs/ssh-nexus/api/server"
 	"github.com/MizuchiLabs/ssh-nexus/internal/provider"
 	"github.com/MizuchiLabs/ssh-nexus/tools/data"
-	"github.com/MizuchiLabs/ssh-nexus/tools/util"
-	"github.com/pkg/sftp"
 	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 	"github.com/pocketbase/pocketbase/models"
@@ -58,6 +59,46 @@ func GetMachineUsers(
 	return data, nil
 }
 
+// GetLastLogins fetches the latest accepted login of every user per machine,
+// optionally only for a single user
+func GetLastLogins(app core.App, userID string) ([]*models.Record, error) {
+	rows := []struct {
+		ID string `db:"id"`
+	}{}
+	err := app.Dao().DB().NewQuery(`
+		SELECT s.id
+		FROM sessions s
+		WHERE s.accepted = TRUE
+			AND s.user != ''
+			AND ({:user} = '' OR s.user = {:user})
+			AND s.time = (
+				SELECT MAX(s2.time)
+				FROM sessions s2
+				WHERE s2.accepted = TRUE AND s2.user = s.user AND s2.machine = s.machine
+			)
+		GROUP BY s.user, s.machine
+	`).Bind(dbx.Params{"user": userID}).All(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find last logins: %v", err)
+	}
+
+	var ids []string
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	sessions, err := app.Dao().FindRecordsByIds("sessions", ids)
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(sessions, func(a, b *models.Record) int {
+		return b.GetDateTime("time").Time().Compare(a.GetDateTime("time").Time())
+	})
+	if errs := app.Dao().ExpandRecords(sessions, []string{"user", "machine"}, nil); len(errs) > 0 {
+		return nil, fmt.Errorf("failed to expand: %v", errs)
+	}
+	return sessions, nil
+}
+
 // GetUserMachines fetches all machines based on a user
 func GetUserMachines(
 	app core.App,
@@ -106,178 +147,240 @@ func GetUserMachines(
 	return machines, nil
 }
 
+// machineTargets turns machines into job targets
+func machineTargets(
+	machines []*models.Record,
+	run func(ctx context.Context, machine *models.Record) error,
+) []jobTarget {
+	targets := make([]jobTarget, 0, len(machines))
+	for _, machine := range machines {
+		targets = append(targets, jobTarget{
+			ID:   machine.Id,
+			Name: machine.GetString("name"),
+			Run:  func(ctx context.Context) error { return run(ctx, machine) },
+		})
+	}
+	return targets
+}
+
 // syncMachines forces a manual update of all machines which are not connected to an agent
-func syncMachines(app core.App) error {
+func syncMachines(app core.App, user string) (*models.Record, error) {
 	machines, err := app.Dao().
 		FindRecordsByFilter("machines", "agent = false", "", 0, 0, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if len(machines) == 0 {
-		return nil
+	return startJob(app, "sync_machines", user, machineTargets(
+		machines,
+		func(ctx context.Context, machine *models.Record) error {
+			return updateMachine(ctx, app, machine)
+		},
+	))
+}
+
+// updateAllMachines pushes the configuration to all connected agents and
+// starts a job updating the machines without one
+func updateAllMachines(app core.App, user string) (*models.Record, error) {
+	agents, err := app.Dao().
+		FindRecordsByFilter("machines", "agent = true", "", 0, 0, nil)
+	if err != nil {
+		return nil, err
 	}
+	server.PushMachines(agents)
+	return syncMachines(app, user)
+}
 
-	for _, machine := range machines {
-		util.Execute(func() { ManualUpdate(app, machine) })
+// updateMachines pushes the configuration to the given machines, connected
+// agents get it right away and the others are updated in a job. No job is
+// started if all machines have an agent.
+func updateMachines(app core.App, user string, machines []*models.Record) (*models.Record, error) {
+	server.PushMachines(machines)
+	manual := slices.DeleteFunc(slices.Clone(machines), func(m *models.Record) bool {
+		return m.GetBool("agent")
+	})
+	if len(manual) == 0 {
+		return nil, nil
 	}
-	return nil
+	return startJob(app, "sync_machines", user, machineTargets(
+		manual,
+		func(ctx context.Context, machine *models.Record) error {
+			return updateMachine(ctx, app, machine)
+		},
+	))
 }
 
 // syncAgents tries to install agents on all machines
-func syncAgents(app core.App) error {
+func syncAgents(app core.App, user string) (*models.Record, error) {
 	machines, err := app.Dao().
 		FindRecordsByFilter("machines", "agent = false", "", 0, 0, nil)
 	if err != nil {
-		return err
-	}
-	if len(machines) == 0 {
-		return nil
-	}
-	for _, machine := range machines {
-		util.Execute(func() { InstallAgent(app, machine) })
+		return nil, err
 	}
-	return nil
+	return startJob(app, "sync_agents", user, machineTargets(
+		machines,
+		func(ctx context.Context, machine *models.Record) error {
+			return installAgent(ctx, app, machine)
+		},
+	))
 }
 
 // syncAgentToken tries to send the agent token to the machine in case it was rotated
-func syncAgentToken(app core.App) error {
+func syncAgentToken(app core.App, user string) (*models.Record, error) {
 	machines, err := app.Dao().FindRecordsByFilter("machines", "id != ''", "", 0, 0, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, machine := range machines {
-		defer func() {
-			if err := app.Dao().SaveRecord(machine); err != nil {
-				slog.Error("Failed to save machine", "name", machine.GetString("name"), "err", err)
-			}
-		}()
+	return startJob(app, "sync_token", user, machineTargets(
+		machines,
+		func(ctx context.Context, machine *models.Record) error {
+			return pushAgentToken(ctx, app, machine)
+		},
+	))
+}
 
-		conn, err := connect(machine)
-		if err != nil {
-			machine.Set("error", err.Error())
-			return err
-		}
-		defer conn.Close()
+// pushAgentToken writes the current agent token to a machine
+func pushAgentToken(ctx context.Context, app core.App, machine *models.Record) (err error) {
+	defer saveMachineError(app, machine, &err)
 
-		token, err := os.Open(data.Token)
-		if err != nil {
-			machine.Set("error", err.Error())
-			return err
-		}
-		defer token.Close()
-
-		client, err := sftp.NewClient(conn)
-		if err != nil {
-			machine.Set("error", err.Error())
-			return err
-		}
-		defer client.Close()
+	token, err := os.ReadFile(data.Token)
+	if err != nil {
+		return err
+	}
 
-		remoteToken, err := client.Create(data.Token)
-		if err != nil {
-			machine.Set("error", err.Error())
-			return err
-		}
-		defer remoteToken.Close()
+	conn, err := connectContext(ctx, app, machine)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-		_, err = io.Copy(remoteToken, token)
-		if err != nil {
-			machine.Set("error", err.Error())
-			return err
-		}
+	client, err := newSFTP(conn)
+	if err != nil {
+		return err
 	}
+	defer client.Close()
 
-	return nil
+	return writeToken(remoteFS{client: client}, token)
 }
 
 // syncProviders syncs cloud providers
-func syncProviders(app core.App) error {
+func syncProviders(app core.App, user string) (*models.Record, error) {
 	providers, err := app.Dao().FindRecordsByFilter("providers", "type != ''", "", 0, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return startProviderJob(app, user, providers, true)
+}
 
-	if len(providers) == 0 {
-		return nil
+// startProviderJob syncs the providers in a job, unless forced providers
+// synced in the last 2 minutes are skipped
+func startProviderJob(app core.App, user string, providers []*models.Record, force bool) (*models.Record, error) {
+	targets := make([]jobTarget, 0, len(providers))
+	for _, p := range providers {
+		targets = append(targets, jobTarget{
+			ID:   p.Id,
+			Name: p.GetString("name"),
+			Run:  func(ctx context.Context) error { return syncProvider(ctx, app, p, force) },
+		})
 	}
+	return startJob(app, "sync_providers", user, targets)
+}
 
-	machines, err := app.Dao().FindCollectionByNameOrId("machines")
-	if err != nil {
-		return err
+// startProviderSync syncs the providers on schedule
+func startProviderSync(app core.App) {
+	providers, err := app.Dao().FindRecordsByFilter("providers", "type != ''", "", 0, 0)
+	if err == nil {
+		_, err = startProviderJob(app, "", providers, false)
 	}
-
-	tags, err := app.Dao().FindCollectionByNameOrId("tags")
 	if err != nil {
-		return err
+		slog.Error("Failed to sync providers", "err", err)
 	}
+}
 
-	go func() {
-		for _, p := range providers {
-			lastSync := p.GetTime("last_sync")
+// syncEditedProvider syncs a created or updated provider right away
+func syncEditedProvider(app core.App, p *models.Record) {
+	if _, err := startProviderJob(app, "", []*models.Record{p}, true); err != nil {
+		slog.Error("Failed to sync provider", "name", p.GetString("name"), "err", err)
+	}
+}
 
-			// Skip if last sync was less than 2 minutes ago
-			if lastSync.After(time.Now().Add(-2 * time.Minute)) {
-				continue
-			}
+// syncProvider reconciles the machines of a provider
+func syncProvider(ctx context.Context, app core.App, p *models.Record, force bool) error {
+	lastSync := p.GetDateTime("last_sync").Time()
 
-			provider, err := provider.NewProvider(p)
-			if err != nil {
-				p.Set("error", err.Error())
-				if err = app.Dao().SaveRecord(p); err != nil {
-					slog.Error("failed to save provider", "err", err)
-				}
-				continue
-			}
+	// Skip if last sync was less than 2 minutes ago
+	if !force && lastSync.After(time.Now().Add(-2*time.Minute)) {
+		return fmt.Errorf("%w: synced less than 2 minutes ago", errJobSkipped)
+	}
 
-			pMachines, err := provider.Sync()
-			if err != nil {
-				p.Set("error", err.Error())
-				if err := app.Dao().SaveRecord(p); err != nil {
-					slog.Error("failed to save provider", "err", err)
-				}
-				continue
-			} else if len(pMachines) == 0 {
-				p.Set("error", "no machines found")
-				if err := app.Dao().SaveRecord(p); err != nil {
-					slog.Error("failed to save provider", "err", err)
-				}
-				continue
-			}
+	fail := func(err error) error {
+		p.Set("error", err.Error())
+		if err := app.Dao().SaveRecord(p); err != nil {
+			slog.Error("failed to save provider", "err", err)
+		}
+		return err
+	}
 
-			// Update last sync time
-			p.Set("error", "")
-			p.Set("last_sync", time.Now())
-			if err := app.Dao().SaveRecord(p); err != nil {
-				slog.Error("failed to save provider", "err", err)
-				continue
-			}
+	filter, err := provider.NewFilter(p)
+	if err != nil {
+		return fail(err)
+	}
+	source, err := provider.NewProvider(p)
+	if err != nil {
+		return fail(err)
+	}
 
-			// Add tag if it doesn't exist
-			tag, _ := app.Dao().FindFirstRecordByData("tags", "name", p.GetString("type"))
-			if tag == nil {
-				tag = models.NewRecord(tags)
-				tag.Set("name", p.GetString("type"))
-				if err := app.Dao().SaveRecord(tag); err != nil {
-					slog.Error("failed to save tag", "err", err)
-				}
-			}
+	// Failed regions, like an offline Proxmox node, don't stop the others
+	pMachines, err := source.Sync(ctx)
+	var failed provider.RegionErrors
+	if errors.As(err, &failed) {
+		err = nil
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-			for _, pm := range pMachines {
-				machine := models.NewRecord(machines)
-				machine.Set("name", pm.Name)
-				machine.Set("host", pm.Host)
-				machine.Set("port", "22")
-				machine.Set("provider", p.Id)
-				machine.Set("tags", tag.Id)
-				if err := app.Dao().SaveRecord(machine); err != nil {
-					slog.Error("failed to save machine", "err", err)
-					continue
-				}
-			}
+	// A provider which suddenly reports nothing is rather broken than empty,
+	// its machines only become stale if the next sync finds none either
+	var previous SyncSummary
+	_ = p.UnmarshalJSONField("sync_summary", &previous)
+	if len(pMachines) == 0 && (previous.Time.IsZero() || previous.Found > 0) {
+		summary := newSyncSummary(time.Now(), failed)
+		problems := []string{"no machines found, they are marked stale if the next sync finds none"}
+		if len(failed) > 0 {
+			problems = append(problems, failed.Error())
 		}
-	}()
+		p.Set("error", strings.Join(problems, "; "))
+		p.Set("last_sync", summary.Time)
+		p.Set("sync_summary", summary)
+		return app.Dao().SaveRecord(p)
+	}
 
-	return nil
+	managed := filter.Apply(pMachines)
+	summary, regrouped, err := reconcileProvider(app, p, managed, failed, time.Now())
+	if err != nil {
+		return fail(err)
+	}
+	summary.Filtered = len(pMachines) - len(managed)
+
+	// Label rules changed the accounts on these machines
+	if _, err := updateMachines(app, "", regrouped); err != nil {
+		slog.Error("failed to update machines", "provider", p.GetString("name"), "err", err)
+	}
+
+	var problems []string
+	if len(failed) > 0 {
+		problems = append(problems, failed.Error())
+	}
+	if summary.Failed > 0 {
+		problems = append(problems, fmt.Sprintf("%d machines failed to sync", summary.Failed))
+	}
+	p.Set("error", strings.Join(problems, "; "))
+	p.Set("last_sync", summary.Time)
+	p.Set("sync_summary", summary)
+	return app.Dao().SaveRecord(p)
 }
 
 // cleanupAudit cleans up audit log based on retention
@@ -295,12 +398,14 @@ func cleanupAudit(app core.App) error {
 		retention = time.Now().UTC().Add(-time.Duration(seconds) * time.Second)
 	}
 
-	records, _ := app.Dao().
-		FindRecordsByFilter("auditlog", "created <= {:created}", "-created", 0, 0, dbx.Params{"created": retention})
-	for _, record := range records {
-		if err := app.Dao().DeleteRecord(record); err != nil {
-			slog.Error("failed to delete record", "err", err)
-			continue // ignore
+	for _, collection := range []string{"auditlog", "sessions", "jobs"} {
+		records, _ := app.Dao().
+			FindRecordsByFilter(collection, "created <= {:created}", "-created", 0, 0, dbx.Params{"created": retention})
+		for _, record := range records {
+			if err := app.Dao().DeleteRecord(record); err != nil {
+				slog.Error("failed to delete record", "err", err)
+				continue // ignore
+			}
 		}
 	}
 
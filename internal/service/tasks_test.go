@@ -1,8 +1,13 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/MizuchiLabs/ssh-nexus/test"
 	"github.com/pocketbase/pocketbase/core"
@@ -58,6 +63,40 @@ func TestGetMachineUsers(t *testing.T) {
 	}
 }
 
+func TestGetLastLogins(t *testing.T) {
+	app := test.SetupApp(t)
+	user := test.GetRecord(t, "users", "id != ''")
+	machine := test.GetRecord(t, "machines", "id != ''")
+
+	sessions, err := app.Dao().FindCollectionByNameOrId("sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	for i, accepted := range []bool{true, true, false} {
+		session := models.NewRecord(sessions)
+		session.Set("machine", machine.Id)
+		session.Set("user", user.Id)
+		session.Set("linux_username", "root")
+		session.Set("accepted", accepted)
+		session.Set("time", now.Add(time.Duration(i)*time.Minute))
+		if err := app.Dao().SaveRecord(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GetLastLogins(app, user.Id)
+	if err != nil {
+		t.Fatalf("GetLastLogins() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("GetLastLogins() = %v, want 1 session", got)
+	}
+	if want := now.Add(time.Minute); !got[0].GetDateTime("time").Time().Equal(want) {
+		t.Errorf("GetLastLogins() time = %v, want %v", got[0].GetDateTime("time"), want)
+	}
+}
+
 func TestGetUserMachines(t *testing.T) {
 	type args struct {
 		app  core.App
@@ -102,7 +141,7 @@ func Test_syncMachines(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if err := syncMachines(tt.args.app); (err != nil) != tt.wantErr {
+			if _, err := syncMachines(tt.args.app, ""); (err != nil) != tt.wantErr {
 				t.Errorf("syncMachines() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -124,7 +163,7 @@ func Test_syncAgents(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if err := syncAgents(tt.args.app); (err != nil) != tt.wantErr {
+			if _, err := syncAgents(tt.args.app, ""); (err != nil) != tt.wantErr {
 				t.Errorf("syncAgents() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -146,7 +185,7 @@ func Test_syncAgentToken(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if err := syncAgentToken(tt.args.app); (err != nil) != tt.wantErr {
+			if _, err := syncAgentToken(tt.args.app, ""); (err != nil) != tt.wantErr {
 				t.Errorf("syncAgentToken() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -168,7 +207,7 @@ func Test_syncProviders(t *testing.T) {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			t.Parallel()
-			if err := syncProviders(tt.args.app); (err != nil) != tt.wantErr {
+			if _, err := syncProviders(tt.args.app, ""); (err != nil) != tt.wantErr {
 				t.Errorf("syncProviders() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -194,3 +233,76 @@ func Test_cleanupAudit(t *testing.T) {
 		})
 	}
 }
+
+func Test_syncProvider(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	inventory := filepath.Join(t.TempDir(), "machines.json")
+	collection, err := app.Dao().FindCollectionByNameOrId("providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := models.NewRecord(collection)
+	p.Set("name", "sync")
+	p.Set("type", "static")
+	p.Set("url", inventory)
+	p.Set("stale_grace", 1)
+	p.Set("stale_action", StaleDelete)
+	if err := app.Dao().SaveRecord(p); err != nil {
+		t.Fatal(err)
+	}
+
+	sync := func(machines string, wantErr bool) *SyncSummary {
+		t.Helper()
+		if err := os.WriteFile(inventory, []byte(machines), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := syncProvider(context.Background(), app, p, true); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.GetString("error") != ""; got != wantErr {
+			t.Errorf("provider error = %q, want an error: %v", p.GetString("error"), wantErr)
+		}
+		var summary SyncSummary
+		if err := p.UnmarshalJSONField("sync_summary", &summary); err != nil {
+			t.Fatal(err)
+		}
+		return &summary
+	}
+
+	if summary := sync(`[{"name": "web", "host": "10.253.0.1"}]`, false); summary.Created != 1 {
+		t.Errorf("first sync = %+v, want 1 created", summary)
+	}
+	// A single empty sync could be a broken provider
+	if summary := sync(`[]`, true); summary.Stale != 0 {
+		t.Errorf("empty sync = %+v, want nothing stale", summary)
+	}
+	// The last instance was terminated
+	if summary := sync(`[]`, false); summary.Stale != 1 {
+		t.Errorf("second empty sync = %+v, want 1 stale", summary)
+	}
+}
+
+func Test_syncProviderSkip(t *testing.T) {
+	app := test.SetupApp(t)
+	defer app.Cleanup()
+
+	collection, err := app.Dao().FindCollectionByNameOrId("providers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := models.NewRecord(collection)
+	p.Set("name", "skip")
+	p.Set("type", "static")
+	p.Set("url", filepath.Join(t.TempDir(), "missing.json"))
+	p.Set("last_sync", time.Now())
+
+	if err := syncProvider(context.Background(), app, p, false); !errors.Is(err, errJobSkipped) {
+		t.Errorf("syncProvider() error = %v, want skipped", err)
+	}
+	// Forced syncs run, the inventory is missing
+	if err := syncProvider(context.Background(), app, p, true); err == nil || errors.Is(err, errJobSkipped) {
+		t.Errorf("forced syncProvider() error = %v, want a failed sync", err)
+	}
+}
@@ -92,6 +92,8 @@ func generateMockData(
 			record.Set("name", gofakeit.JobLevel()+gofakeit.UUID()[:8])
 			record.Set("description", gofakeit.Sentence(10))
 			record.Set("linux_username", strings.ToLower(gofakeit.Username()))
+			record.Set("shell", "/bin/bash")
+			record.Set("supplementary_groups", "sudo")
 		case "tags":
 			record.Set("name", gofakeit.Gamertag())
 			record.Set("description", gofakeit.Sentence(10))
@@ -1,10 +1,5 @@
 package data
 
-import (
-	"os"
-	"path/filepath"
-)
-
 var (
 	// Certificates & Keys for the grpc server
 	BaseCertDir  = Path("certs")
@@ -23,18 +18,17 @@ var (
 	Token = Path("token")
 
 	// Various paths used on the server
+	SSHDConfigPath     = "/etc/ssh/sshd_config"
 	SSHConfigPath      = "/etc/ssh/sshd_config.d/nexus.conf"
 	PrincipalPath      = "/etc/ssh/nexus_principals/"
 	PublicUserKeyPath  = "/etc/ssh/nexus_user.pub"
 	PrivateHostKeyPath = "/etc/ssh/ssh_host_ed25519_key"
 	PublicHostKeyPath  = "/etc/ssh/ssh_host_ed25519_key.pub"
 	CertHostPath       = "/etc/ssh/ssh_host_ed25519_key-cert.pub"
-	AuthorizedKeysPath = "~/.ssh/authorized_keys"
 
 	// Path to the agent binary
-	AgentPath    = "/usr/local/bin/nexus-agent"
-	AgentService = "/etc/systemd/system/nexus-agent.service"
+	AgentPath = "/usr/local/bin/nexus-agent"
 
-	// Path to the temporary agent binary (for downloads and updates)
-	AgentDownloadPath = filepath.Join(os.TempDir(), "nexus-agent")
+	// Downloaded agent binaries, one directory per platform
+	AgentCacheDir = Path("agents")
 )
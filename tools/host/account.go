@@ -0,0 +1,200 @@
+// Package host contains the logic shared by the agent and the server to
+// manage accounts and files on a machine
+package host
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Policies for accounts created by nexus which are no longer referenced
+const (
+	AccountPolicyKeep   = "keep"
+	AccountPolicyLock   = "lock"
+	AccountPolicyRemove = "remove"
+)
+
+// AccountsPath keeps track of the accounts created by nexus
+const AccountsPath = "/etc/ssh/nexus_accounts"
+
+// SudoersPath is the directory for the sudoers drop-ins
+const SudoersPath = "/etc/sudoers.d"
+
+var usernameRegex = regexp.MustCompile(`^[a-z_][a-z0-9_-]{0,31}$`)
+
+// Account describes a linux account which should exist on a machine
+type Account struct {
+	Name    string   `json:"name"`
+	Shell   string   `json:"shell,omitempty"`
+	Home    string   `json:"home,omitempty"`
+	Groups  []string `json:"groups,omitempty"`
+	Sudoers string   `json:"sudoers,omitempty"`
+}
+
+// ValidUsername checks if the name is a safe linux user or group name
+func ValidUsername(name string) bool {
+	return usernameRegex.MatchString(name)
+}
+
+// Validate checks all fields of the account before they are used in a script
+func (a *Account) Validate() error {
+	if !ValidUsername(a.Name) {
+		return fmt.Errorf("invalid username: %q", a.Name)
+	}
+	if a.Shell != "" && !validPath(a.Shell) {
+		return fmt.Errorf("invalid shell for %s: %q", a.Name, a.Shell)
+	}
+	if a.Home != "" && !validPath(a.Home) {
+		return fmt.Errorf("invalid home for %s: %q", a.Name, a.Home)
+	}
+	for _, group := range a.Groups {
+		if !ValidUsername(group) {
+			return fmt.Errorf("invalid group for %s: %q", a.Name, group)
+		}
+	}
+	if strings.ContainsAny(a.Sudoers, "\n\r") {
+		return fmt.Errorf("invalid sudoers rule for %s", a.Name)
+	}
+	return nil
+}
+
+// ParseGroups splits a comma or space separated list of groups
+func ParseGroups(groups string) []string {
+	var result []string
+	for _, group := range strings.FieldsFunc(groups, func(r rune) bool {
+		return r == ',' || r == ' '
+	}) {
+		if !slices.Contains(result, group) {
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+// ValidPolicy returns the policy or the default if it's unknown
+func ValidPolicy(policy string) string {
+	switch policy {
+	case AccountPolicyLock, AccountPolicyRemove:
+		return policy
+	default:
+		return AccountPolicyKeep
+	}
+}
+
+// AccountScript creates a shell script which ensures the accounts exist and
+// handles previously created accounts according to the policy
+func AccountScript(accounts []Account, policy string) (string, error) {
+	var names []string
+	var script strings.Builder
+
+	script.WriteString("set -e\n")
+	script.WriteString(fmt.Sprintf("touch %s\n", AccountsPath))
+	for _, account := range accounts {
+		if err := account.Validate(); err != nil {
+			return "", err
+		}
+		if account.Name == "root" {
+			continue
+		}
+		names = append(names, account.Name)
+
+		shell := account.Shell
+		if shell == "" {
+			shell = "/bin/sh"
+		}
+		home := account.Home
+		if home == "" {
+			home = filepath.Join("/home", account.Name)
+		}
+		name := Quote(account.Name)
+
+		// Create the account if it doesn't exist yet
+		script.WriteString(fmt.Sprintf("if ! id -u %s >/dev/null 2>&1; then\n", name))
+		script.WriteString(fmt.Sprintf(
+			"  if command -v useradd >/dev/null 2>&1; then useradd -m -d %s -s %s %s; "+
+				"else adduser -D -h %s -s %s %s; fi\n",
+			Quote(home), Quote(shell), name,
+			Quote(home), Quote(shell), name,
+		))
+		script.WriteString(fmt.Sprintf("  echo %s >> %s\n", name, AccountsPath))
+		script.WriteString("fi\n")
+
+		// Existing accounts are only changed where the group sets a value explicitly
+		if account.Shell != "" {
+			script.WriteString(fmt.Sprintf(
+				"[ \"$(getent passwd %s | cut -d: -f7)\" = %s ] || usermod -s %s %s\n",
+				name, Quote(account.Shell), Quote(account.Shell), name,
+			))
+		}
+		for _, group := range account.Groups {
+			script.WriteString(fmt.Sprintf(
+				"if getent group %s >/dev/null 2>&1; then usermod -aG %s %s; fi\n",
+				Quote(group), Quote(group), name,
+			))
+		}
+		// Unlock accounts which were locked by the policy before
+		script.WriteString(fmt.Sprintf(
+			"if grep -qx %s %s; then usermod -e '' %s 2>/dev/null || true; usermod -U %s 2>/dev/null || true; fi\n",
+			name, AccountsPath, name, name,
+		))
+
+		// Sudoers drop-in, validated with visudo before it's moved into place
+		sudoers := filepath.Join(SudoersPath, "nexus-"+account.Name)
+		if account.Sudoers != "" {
+			script.WriteString(fmt.Sprintf("mkdir -p %s\n", SudoersPath))
+			script.WriteString(fmt.Sprintf(
+				"printf '%%s\\n' %s > %s.tmp\n",
+				Quote(account.Name+" "+account.Sudoers), sudoers,
+			))
+			script.WriteString(fmt.Sprintf("chmod 0440 %s.tmp\n", sudoers))
+			script.WriteString(fmt.Sprintf(
+				"if command -v visudo >/dev/null 2>&1 && ! visudo -cf %s.tmp >/dev/null; then "+
+					"rm -f %s.tmp; echo 'invalid sudoers rule for %s' >&2; exit 1; fi\n",
+				sudoers, sudoers, account.Name,
+			))
+			script.WriteString(fmt.Sprintf("mv %s.tmp %s\n", sudoers, sudoers))
+		} else {
+			script.WriteString(fmt.Sprintf("rm -f %s\n", sudoers))
+		}
+	}
+
+	// Handle accounts created by nexus which are no longer referenced
+	script.WriteString(fmt.Sprintf("for account in $(cat %s); do\n", AccountsPath))
+	script.WriteString(fmt.Sprintf("  case \" %s \" in *\" $account \"*) continue ;; esac\n", strings.Join(names, " ")))
+	script.WriteString(fmt.Sprintf("  rm -f %s/nexus-\"$account\"\n", SudoersPath))
+	switch ValidPolicy(policy) {
+	case AccountPolicyLock:
+		script.WriteString("  usermod -L -e 1 \"$account\" 2>/dev/null || true\n")
+	case AccountPolicyRemove:
+		script.WriteString("  userdel -r \"$account\" 2>/dev/null || deluser --remove-home \"$account\" 2>/dev/null || true\n")
+		script.WriteString(fmt.Sprintf("  sed -i \"/^$account\\$/d\" %s\n", AccountsPath))
+	}
+	script.WriteString("done\n")
+
+	return script.String(), nil
+}
+
+// AccountPaths returns the files changed by the account script
+func AccountPaths(accounts []Account) []string {
+	paths := []string{AccountsPath}
+	for _, account := range accounts {
+		if account.Name == "root" || !ValidUsername(account.Name) {
+			continue
+		}
+		paths = append(paths, filepath.Join(SudoersPath, "nexus-"+account.Name))
+	}
+	return paths
+}
+
+// Quote escapes a string to be used as a single shell argument
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func validPath(path string) bool {
+	return filepath.IsAbs(path) && filepath.Clean(path) == path &&
+		!strings.ContainsAny(path, "\n\r\x00")
+}
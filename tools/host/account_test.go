@@ -0,0 +1,99 @@
+package host
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestAccountScript(t *testing.T) {
+	type args struct {
+		accounts []Account
+		policy   string
+	}
+	tests := []struct {
+		name     string
+		args     args
+		contains []string
+		wantErr  bool
+	}{
+		{
+			name: "Create account with sudo",
+			args: args{
+				accounts: []Account{{
+					Name:    "deploy",
+					Shell:   "/bin/bash",
+					Groups:  []string{"sudo", "wheel"},
+					Sudoers: "ALL=(ALL) NOPASSWD:ALL",
+				}},
+				policy: AccountPolicyLock,
+			},
+			contains: []string{
+				"useradd -m -d '/home/deploy' -s '/bin/bash' 'deploy'",
+				"usermod -aG 'wheel' 'deploy'",
+				"'deploy ALL=(ALL) NOPASSWD:ALL'",
+				"usermod -L -e 1",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Skip root",
+			args: args{
+				accounts: []Account{{Name: "root"}},
+				policy:   AccountPolicyRemove,
+			},
+			contains: []string{"userdel -r"},
+			wantErr:  false,
+		},
+		{
+			name: "Invalid username",
+			args: args{
+				accounts: []Account{{Name: "foo; rm -rf /"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid shell",
+			args: args{
+				accounts: []Account{{Name: "foo", Shell: "bash"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid sudoers",
+			args: args{
+				accounts: []Account{{Name: "foo", Sudoers: "ALL\nroot ALL"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := AccountScript(tt.args.accounts, tt.args.policy)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AccountScript() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(got, want) {
+					t.Errorf("AccountScript() = %v, want to contain %v", got, want)
+				}
+			}
+			if got != "" {
+				if out, err := exec.Command("sh", "-n", "-c", got).CombinedOutput(); err != nil {
+					t.Errorf("AccountScript() invalid shell syntax: %v: %s", err, out)
+				}
+			}
+		})
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	got := ParseGroups("sudo, docker wheel,sudo")
+	want := []string{"sudo", "docker", "wheel"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ParseGroups() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKeysStatePath keeps track of the users with a managed block
+const AuthorizedKeysStatePath = "/etc/ssh/nexus_authorized_keys"
+
+// Markers around the keys managed by nexus in an authorized_keys file
+const (
+	KeysBeginMarker = "# BEGIN SSH NEXUS MANAGED KEYS - changes will be overwritten"
+	KeysEndMarker   = "# END SSH NEXUS MANAGED KEYS"
+)
+
+var fromRegex = regexp.MustCompile(`^[0-9A-Za-z.:/*?!,_-]+$`)
+
+// PublicKey is a plain public key registered by a user
+type PublicKey struct {
+	Key     string `json:"key"`
+	From    string `json:"from,omitempty"`
+	Command string `json:"command,omitempty"`
+}
+
+// Line validates the key and returns it as a single authorized_keys line
+func (k PublicKey) Line() (string, error) {
+	if strings.ContainsAny(k.Key, "\n\r") {
+		return "", fmt.Errorf("public key must be a single line")
+	}
+	pub, comment, options, _, err := ssh.ParseAuthorizedKey([]byte(k.Key))
+	if err != nil {
+		return "", fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(options) > 0 {
+		return "", fmt.Errorf("public key must not contain options, use from and command instead")
+	}
+	if _, ok := pub.(*ssh.Certificate); ok {
+		return "", fmt.Errorf("certificates are not allowed as public keys")
+	}
+
+	var opts []string
+	if k.From != "" {
+		if !fromRegex.MatchString(k.From) {
+			return "", fmt.Errorf("invalid from option: %q", k.From)
+		}
+		opts = append(opts, fmt.Sprintf("from=%q", k.From))
+	}
+	if k.Command != "" {
+		if strings.ContainsAny(k.Command, "\n\r\x00") {
+			return "", fmt.Errorf("command option must be a single line")
+		}
+		// sshd only unescapes \", a trailing backslash would escape the
+		// closing quote and break the whole line
+		if strings.HasSuffix(k.Command, `\`) {
+			return "", fmt.Errorf("command option must not end with a backslash")
+		}
+		opts = append(opts, `command="`+strings.ReplaceAll(k.Command, `"`, `\"`)+`"`)
+	}
+
+	line := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(pub)))
+	if comment != "" {
+		line += " " + comment
+	}
+	if len(opts) > 0 {
+		line = strings.Join(opts, ",") + " " + line
+	}
+	return line, nil
+}
+
+// RenderAuthorizedKeys replaces the managed block of an authorized_keys file
+// and keeps all other lines as they are. Without keys the block is removed.
+func RenderAuthorizedKeys(content string, keys []string) string {
+	var lines []string
+	managed := false
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case line == KeysBeginMarker:
+			managed = true
+		case line == KeysEndMarker:
+			managed = false
+		case !managed:
+			lines = append(lines, line)
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	if len(keys) > 0 {
+		lines = append(lines, KeysBeginMarker)
+		lines = append(lines, keys...)
+		lines = append(lines, KeysEndMarker)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// LinuxUser contains the details of an account needed to write its files
+type LinuxUser struct {
+	UID  int
+	GID  int
+	Home string
+}
+
+// ParsePasswd parses a single line of /etc/passwd (e.g. from getent)
+func ParsePasswd(line string) (*LinuxUser, error) {
+	fields := strings.Split(strings.TrimSpace(line), ":")
+	if len(fields) < 7 {
+		return nil, fmt.Errorf("invalid passwd entry: %q", line)
+	}
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid in passwd entry: %q", line)
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid in passwd entry: %q", line)
+	}
+	if !validPath(fields[5]) {
+		return nil, fmt.Errorf("invalid home in passwd entry: %q", line)
+	}
+	return &LinuxUser{UID: uid, GID: gid, Home: fields[5]}, nil
+}
+
+// UpdateAuthorizedKeys renders the managed block for every linux user and
+// removes the block of users which no longer have any keys
+func UpdateAuthorizedKeys(
+	fsys FS,
+	backup *Backup,
+	lookup func(name string) (*LinuxUser, error),
+	keys map[string][]string,
+) error {
+	var previous []string
+	if content, err := fsys.ReadFile(AuthorizedKeysStatePath); err == nil {
+		previous = strings.Fields(string(content))
+	}
+
+	var users, current []string
+	for name := range keys {
+		users = append(users, name)
+	}
+	for _, name := range previous {
+		if !slices.Contains(users, name) {
+			users = append(users, name)
+		}
+	}
+	slices.Sort(users)
+
+	var errs []error
+	for _, name := range users {
+		if !ValidUsername(name) {
+			errs = append(errs, fmt.Errorf("invalid username: %q", name))
+			continue
+		}
+		user, err := lookup(name)
+		if err != nil {
+			// Users which don't exist (anymore) can't have keys
+			continue
+		}
+		if err := writeAuthorizedKeys(fsys, backup, user, keys[name]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to update keys of %s: %w", name, err))
+			continue
+		}
+		if len(keys[name]) > 0 {
+			current = append(current, name)
+		}
+	}
+
+	if err := backup.Snapshot(AuthorizedKeysStatePath); err != nil {
+		return err
+	}
+	state := strings.Join(current, "\n")
+	if state != "" {
+		state += "\n"
+	}
+	if err := fsys.WriteFile(AuthorizedKeysStatePath, []byte(state), 0600); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func writeAuthorizedKeys(fsys FS, backup *Backup, user *LinuxUser, keys []string) error {
+	dir := filepath.Join(user.Home, ".ssh")
+	path := filepath.Join(dir, "authorized_keys")
+
+	// Never follow links in directories owned by the user, the file itself
+	// is replaced by a rename which doesn't follow a link swapped in later
+	for _, p := range []string{dir, path} {
+		if info, err := fsys.Lstat(p); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink %s", p)
+		}
+	}
+	if info, err := fsys.Lstat(dir); err == nil {
+		if uid, _, ok := fsys.Owner(info); ok && uid != 0 && uid != user.UID {
+			return fmt.Errorf("refusing to write to %s owned by uid %d", dir, uid)
+		}
+	}
+
+	content, err := fsys.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	rendered := RenderAuthorizedKeys(string(content), keys)
+	if rendered == string(content) {
+		return nil
+	}
+
+	if err := backup.Snapshot(dir, path); err != nil {
+		return err
+	}
+	if _, err := fsys.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		if err := fsys.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := fsys.Chown(dir, user.UID, user.GID); err != nil {
+			return err
+		}
+	}
+	if err := fsys.WriteFile(path, []byte(rendered), 0600); err != nil {
+		return err
+	}
+	return fsys.Chown(path, user.UID, user.GID)
+}
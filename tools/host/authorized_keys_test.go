@@ -0,0 +1,132 @@
+package host
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T) string {
+	t.Helper()
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+func TestPublicKeyLine(t *testing.T) {
+	key := testKey(t)
+	tests := []struct {
+		name    string
+		key     PublicKey
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Plain key",
+			key:  PublicKey{Key: key + " deploy@ci"},
+			want: key + " deploy@ci",
+		},
+		{
+			name: "Key with options",
+			key:  PublicKey{Key: key, From: "10.0.0.0/8,*.example.com", Command: `echo "hi"`},
+			want: `from="10.0.0.0/8,*.example.com",command="echo \"hi\"" ` + key,
+		},
+		{
+			name:    "Invalid key",
+			key:     PublicKey{Key: "ssh-ed25519 invalid"},
+			wantErr: true,
+		},
+		{
+			name:    "Options in key",
+			key:     PublicKey{Key: `no-pty ` + key},
+			wantErr: true,
+		},
+		{
+			name:    "Invalid from",
+			key:     PublicKey{Key: key, From: `10.0.0.1" ,command="sh`},
+			wantErr: true,
+		},
+		{
+			name:    "Multiline command",
+			key:     PublicKey{Key: key, Command: "true\n" + key},
+			wantErr: true,
+		},
+		{
+			name:    "Trailing backslash in command",
+			key:     PublicKey{Key: key, Command: `echo \`},
+			wantErr: true,
+		},
+		{
+			name: "Backslash in command",
+			key:  PublicKey{Key: key, Command: `printf 'a\tb'`},
+			want: `command="printf 'a\tb'" ` + key,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tt.key.Line()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Line() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Line() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderAuthorizedKeys(t *testing.T) {
+	block := KeysBeginMarker + "\nssh-ed25519 OLD\n" + KeysEndMarker + "\n"
+	tests := []struct {
+		name    string
+		content string
+		keys    []string
+		want    string
+	}{
+		{
+			name:    "Empty file",
+			content: "",
+			keys:    []string{"ssh-ed25519 NEW"},
+			want:    KeysBeginMarker + "\nssh-ed25519 NEW\n" + KeysEndMarker + "\n",
+		},
+		{
+			name:    "Keep unmanaged lines",
+			content: "ssh-rsa MINE\n" + block + "# comment\n",
+			keys:    []string{"ssh-ed25519 NEW"},
+			want:    "ssh-rsa MINE\n# comment\n" + KeysBeginMarker + "\nssh-ed25519 NEW\n" + KeysEndMarker + "\n",
+		},
+		{
+			name:    "Remove block",
+			content: "ssh-rsa MINE\n\n" + block,
+			keys:    nil,
+			want:    "ssh-rsa MINE\n",
+		},
+		{
+			name:    "Only managed block",
+			content: block,
+			keys:    nil,
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := RenderAuthorizedKeys(tt.content, tt.keys); got != tt.want {
+				t.Errorf("RenderAuthorizedKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
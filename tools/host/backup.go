@@ -0,0 +1,237 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// BackupPath contains the original files before nexus modified them
+const BackupPath = "/etc/ssh/nexus_backup"
+
+// States of a file before nexus touched it
+const (
+	stateSaved   = "saved"   // file existed, a copy was saved
+	stateAbsent  = "absent"  // didn't exist, will be removed on restore
+	statePresent = "present" // directory existed, nothing to restore
+)
+
+// Actions reported after a restore
+const (
+	ActionRestored = "restored"
+	ActionRemoved  = "removed"
+)
+
+// Restored describes a single file which was reset to its original state
+type Restored struct {
+	Path   string `json:"path"`
+	Action string `json:"action"`
+}
+
+type backupEntry struct {
+	state string
+	mode  fs.FileMode
+	uid   int
+	gid   int
+	owner bool
+	path  string
+}
+
+// Backup snapshots files before their first modification and restores them
+type Backup struct {
+	FS  FS
+	Dir string
+}
+
+// NewBackup creates a backup using the default location
+func NewBackup(fsys FS) *Backup {
+	return &Backup{FS: fsys, Dir: BackupPath}
+}
+
+func (b *Backup) manifestPath() string {
+	return filepath.Join(b.Dir, "manifest")
+}
+
+func (b *Backup) copyPath(path string) string {
+	return filepath.Join(b.Dir, "files", path)
+}
+
+// Snapshot saves the current state of the given paths, paths which were
+// already saved before are skipped so the original state is always kept
+func (b *Backup) Snapshot(paths ...string) error {
+	entries, err := b.entries()
+	if err != nil {
+		return err
+	}
+
+	var added []backupEntry
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("backup path must be absolute: %s", path)
+		}
+		if path == b.Dir || strings.HasPrefix(path, b.Dir+"/") {
+			continue
+		}
+		if slices.ContainsFunc(entries, func(e backupEntry) bool { return e.path == path }) ||
+			slices.ContainsFunc(added, func(e backupEntry) bool { return e.path == path }) {
+			continue
+		}
+
+		entry := backupEntry{path: path}
+		info, err := b.FS.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			entry.state = stateAbsent
+		case err != nil:
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		case info.IsDir():
+			entry.state = statePresent
+			entry.mode = info.Mode().Perm()
+		default:
+			content, err := b.FS.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			if err := b.FS.MkdirAll(filepath.Dir(b.copyPath(path)), 0700); err != nil {
+				return err
+			}
+			if err := b.FS.WriteFile(b.copyPath(path), content, 0600); err != nil {
+				return fmt.Errorf("failed to save %s: %w", path, err)
+			}
+			entry.state = stateSaved
+			entry.mode = info.Mode().Perm()
+			entry.uid, entry.gid, entry.owner = b.FS.Owner(info)
+		}
+		added = append(added, entry)
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+	return b.writeManifest(append(entries, added...))
+}
+
+// Restore resets all saved files to their original state in reverse order
+// and removes the backup afterwards. Leftovers are files only nexus creates,
+// they are removed if the backup doesn't track them (e.g. older installs).
+func (b *Backup) Restore(leftovers ...string) ([]Restored, error) {
+	entries, err := b.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []Restored
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		switch entry.state {
+		case stateSaved:
+			content, err := b.FS.ReadFile(b.copyPath(entry.path))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read backup of %s: %w", entry.path, err))
+				continue
+			}
+			if err := b.FS.MkdirAll(filepath.Dir(entry.path), 0755); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := b.FS.WriteFile(entry.path, content, entry.mode); err != nil {
+				errs = append(errs, fmt.Errorf("failed to restore %s: %w", entry.path, err))
+				continue
+			}
+			if entry.owner {
+				if err := b.FS.Chown(entry.path, entry.uid, entry.gid); err != nil {
+					errs = append(errs, fmt.Errorf("failed to restore owner of %s: %w", entry.path, err))
+				}
+			}
+			restored = append(restored, Restored{Path: entry.path, Action: ActionRestored})
+		case stateAbsent:
+			if _, err := b.FS.Stat(entry.path); err != nil {
+				continue
+			}
+			if err := b.FS.RemoveAll(entry.path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove %s: %w", entry.path, err))
+				continue
+			}
+			restored = append(restored, Restored{Path: entry.path, Action: ActionRemoved})
+		}
+	}
+
+	for _, path := range leftovers {
+		path = filepath.Clean(path)
+		if slices.ContainsFunc(entries, func(e backupEntry) bool { return e.path == path }) {
+			continue
+		}
+		if _, err := b.FS.Stat(path); err != nil {
+			continue
+		}
+		if err := b.FS.RemoveAll(path); err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", path, err))
+			continue
+		}
+		restored = append(restored, Restored{Path: path, Action: ActionRemoved})
+	}
+
+	if len(errs) > 0 {
+		return restored, errors.Join(errs...)
+	}
+	return restored, b.FS.RemoveAll(b.Dir)
+}
+
+func (b *Backup) entries() ([]backupEntry, error) {
+	content, err := b.FS.ReadFile(b.manifestPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+
+	var entries []backupEntry
+	for _, line := range strings.Split(string(content), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.SplitN(line, "\t", 4)
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("invalid backup manifest line: %q", line)
+		}
+		mode, err := strconv.ParseUint(parts[1], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backup manifest mode: %q", line)
+		}
+		entry := backupEntry{state: parts[0], mode: fs.FileMode(mode), path: parts[3]}
+		if parts[2] != "-" {
+			if _, err := fmt.Sscanf(parts[2], "%d:%d", &entry.uid, &entry.gid); err != nil {
+				return nil, fmt.Errorf("invalid backup manifest owner: %q", line)
+			}
+			entry.owner = true
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *Backup) writeManifest(entries []backupEntry) error {
+	var manifest strings.Builder
+	for _, entry := range entries {
+		owner := "-"
+		if entry.owner {
+			owner = fmt.Sprintf("%d:%d", entry.uid, entry.gid)
+		}
+		manifest.WriteString(fmt.Sprintf(
+			"%s\t%04o\t%s\t%s\n",
+			entry.state, entry.mode, owner, entry.path,
+		))
+	}
+
+	if err := b.FS.MkdirAll(b.Dir, 0700); err != nil {
+		return err
+	}
+	return b.FS.WriteFile(b.manifestPath(), []byte(manifest.String()), 0600)
+}
@@ -0,0 +1,79 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	root := t.TempDir()
+	backup := &Backup{FS: Local{}, Dir: filepath.Join(root, "backup")}
+
+	existing := filepath.Join(root, "authorized_keys")
+	created := filepath.Join(root, "nexus.conf")
+	dir := filepath.Join(root, "principals")
+	leftover := filepath.Join(root, "nexus-agent")
+	if err := os.WriteFile(existing, []byte("ssh-ed25519 AAAA user\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(leftover, []byte("agent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := backup.Snapshot(existing, created, dir); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := os.WriteFile(existing, []byte("nexus ca"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A second snapshot must keep the original state
+	if err := backup.Snapshot(existing); err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if err := os.WriteFile(created, []byte("config"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "root"), []byte("root"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := backup.Restore(leftover)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	want := []Restored{
+		{Path: dir, Action: ActionRemoved},
+		{Path: created, Action: ActionRemoved},
+		{Path: existing, Action: ActionRestored},
+		{Path: leftover, Action: ActionRemoved},
+	}
+	if len(restored) != len(want) {
+		t.Fatalf("Restore() = %v, want %v", restored, want)
+	}
+	for i := range want {
+		if restored[i] != want[i] {
+			t.Errorf("Restore()[%d] = %v, want %v", i, restored[i], want[i])
+		}
+	}
+
+	content, err := os.ReadFile(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "ssh-ed25519 AAAA user\n" {
+		t.Errorf("restored content = %q", content)
+	}
+	if info, _ := os.Stat(existing); info.Mode().Perm() != 0640 {
+		t.Errorf("restored mode = %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+	for _, path := range []string{created, dir, leftover, backup.Dir} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s still exists after restore", path)
+		}
+	}
+}
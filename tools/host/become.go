@@ -0,0 +1,51 @@
+package host
+
+import "strings"
+
+// Privilege escalation modes for a non-root login user
+const (
+	BecomeNone = "none"
+	BecomeSudo = "sudo"
+	BecomeDoas = "doas"
+)
+
+// Known locations of the sftp-server binary of OpenSSH
+var SFTPServerPaths = []string{
+	"/usr/lib/openssh/sftp-server",
+	"/usr/libexec/openssh/sftp-server",
+	"/usr/lib/ssh/sftp-server",
+	"/usr/libexec/sftp-server",
+	"/usr/lib/sftp-server",
+}
+
+// DefaultBecome returns the escalation mode used if none is configured
+func DefaultBecome(user string) string {
+	if user == "" || user == "root" {
+		return BecomeNone
+	}
+	return BecomeSudo
+}
+
+// Privileged wraps a shell command so it runs as root with the given mode.
+// Escalation never prompts, a missing sudo/doas rule fails the command.
+func Privileged(mode, command string) string {
+	switch mode {
+	case BecomeSudo:
+		return "sudo -n sh -c " + Quote(command)
+	case BecomeDoas:
+		return "doas -n sh -c " + Quote(command)
+	default:
+		return command
+	}
+}
+
+// SFTPServerCommand starts the first sftp-server found on the machine
+func SFTPServerCommand() string {
+	var b strings.Builder
+	b.WriteString("for p in")
+	for _, path := range SFTPServerPaths {
+		b.WriteString(" " + path)
+	}
+	b.WriteString(`; do [ -x "$p" ] && exec "$p"; done; echo "sftp-server not found" >&2; exit 127`)
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package host
+
+import "testing"
+
+func TestPrivileged(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		command string
+		want    string
+	}{
+		{
+			name:    "None",
+			mode:    BecomeNone,
+			command: "systemctl daemon-reload",
+			want:    "systemctl daemon-reload",
+		},
+		{
+			name:    "Sudo",
+			mode:    BecomeSudo,
+			command: "echo -n 'a' | tee /etc/ssh/x; ls -1 /etc/ssh",
+			want:    `sudo -n sh -c 'echo -n '\''a'\'' | tee /etc/ssh/x; ls -1 /etc/ssh'`,
+		},
+		{
+			name:    "Doas",
+			mode:    BecomeDoas,
+			command: "rm -f /tmp/x",
+			want:    "doas -n sh -c 'rm -f /tmp/x'",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Privileged(tt.mode, tt.command); got != tt.want {
+				t.Errorf("Privileged() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultBecome(t *testing.T) {
+	if got := DefaultBecome("root"); got != BecomeNone {
+		t.Errorf("DefaultBecome(root) = %q, want %q", got, BecomeNone)
+	}
+	if got := DefaultBecome("deploy"); got != BecomeSudo {
+		t.Errorf("DefaultBecome(deploy) = %q, want %q", got, BecomeSudo)
+	}
+}
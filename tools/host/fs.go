@@ -0,0 +1,108 @@
+package host
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is the minimal set of file operations needed on a machine, implemented
+// locally by the agent and remotely by the server over sftp
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	MkdirAll(path string, perm fs.FileMode) error
+	RemoveAll(path string) error
+	Chown(name string, uid, gid int) error
+	Owner(info fs.FileInfo) (uid, gid int, ok bool)
+}
+
+// Local implements FS for the machine the process is running on
+type Local struct{}
+
+func (Local) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// WriteFile replaces a file atomically like the sftp implementation. The
+// temporary file gets its mode before any data is written and the rename
+// replaces a symlink at the name instead of following it.
+func (Local) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	dir, base := filepath.Split(name)
+	file, err := os.CreateTemp(dir, "."+base+".nexus-*")
+	if err != nil {
+		return err
+	}
+	tmp := file.Name()
+	if err := writeTemp(file, name, data, perm); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func writeTemp(file *os.File, name string, data []byte, perm fs.FileMode) error {
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return err
+	}
+	// Keep the owner of the replaced file
+	if info, err := os.Lstat(name); err == nil {
+		uid, gid, ok := fileOwner(info)
+		tmpInfo, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if tmpUID, tmpGID, _ := fileOwner(tmpInfo); ok && (tmpUID != uid || tmpGID != gid) {
+			if err := file.Chown(uid, gid); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (Local) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (Local) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (Local) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (Local) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (Local) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (Local) Chown(name string, uid, gid int) error {
+	return os.Lchown(name, uid, gid)
+}
+
+func (Local) Owner(info fs.FileInfo) (int, int, bool) {
+	return fileOwner(info)
+}
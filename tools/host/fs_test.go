@@ -0,0 +1,66 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "shadow")
+	if err := os.WriteFile(outside, []byte("root:x\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "authorized_keys")
+	if err := os.Symlink(outside, path); err != nil {
+		t.Fatal(err)
+	}
+
+	// A link swapped in is replaced, never written through
+	if err := (Local{}).WriteFile(path, []byte("ssh-ed25519 AAAA\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(outside); string(content) != "root:x\n" {
+		t.Errorf("link target = %q, want it unchanged", content)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || info.Mode().Perm() != 0o600 {
+		t.Errorf("file mode = %v, want a regular file with 0600", info.Mode())
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("%d files left in %s, want only the written one", len(entries), dir)
+	}
+}
+
+func TestWriteAuthorizedKeysOwner(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner needs root")
+	}
+	home := t.TempDir()
+	dir := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	backup := &Backup{FS: Local{}, Dir: filepath.Join(t.TempDir(), "backup")}
+	user := &LinuxUser{UID: 1000, GID: 1000, Home: home}
+	keys := []string{"ssh-ed25519 AAAA"}
+
+	if err := writeAuthorizedKeys(Local{}, backup, user, keys); err != nil {
+		t.Fatalf("writeAuthorizedKeys() to a root owned directory: %v", err)
+	}
+	// Owned by someone else, e.g. a directory moved in by another user
+	if err := os.Chown(dir, 1001, 1001); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAuthorizedKeys(Local{}, backup, user, []string{"ssh-ed25519 BBBB"}); err == nil {
+		t.Error("writeAuthorizedKeys() wrote to a directory of another user")
+	}
+}
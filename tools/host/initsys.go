@@ -0,0 +1,217 @@
+package host
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// DetectInitScript prints the name of the init system of a machine
+const DetectInitScript = `if [ -d /run/systemd/system ]; then echo systemd; ` +
+	`elif [ -x /sbin/openrc-run ] || command -v openrc-run >/dev/null 2>&1; then echo openrc; ` +
+	`elif [ -d /etc/sv ] && command -v sv >/dev/null 2>&1 && [ -d /run/runit ]; then echo runit; ` +
+	`elif [ -d /etc/init.d ]; then echo sysvinit; ` +
+	`else echo unknown; fi`
+
+// InitSystem knows how to install and manage the agent with a service manager
+type InitSystem struct {
+	Name string
+	// Path of the service definition and its mode
+	Path string
+	Mode fs.FileMode
+	// Paths created by installing the service, removed on restore
+	Paths []string
+	// Render returns the service definition for the agent
+	Render func(agent, server string) string
+	// Shell commands to start the service on boot and now, to stop it, to
+	// remove it from boot and to run after the definition is removed
+	Enable  string
+	Stop    string
+	Disable string
+	Reload  string
+	// Status exits with 0 if the agent is running
+	Status string
+}
+
+// Directories runit supervises, depending on the distribution
+var runitServiceDirs = []string{"/var/service", "/etc/service", "/service"}
+
+var InitSystems = map[string]InitSystem{
+	"systemd": {
+		Name:    "systemd",
+		Path:    "/etc/systemd/system/nexus-agent.service",
+		Mode:    0644,
+		Paths:   []string{"/etc/systemd/system/nexus-agent.service"},
+		Render:  renderSystemd,
+		Enable:  "systemctl daemon-reload && systemctl enable nexus-agent && systemctl restart nexus-agent",
+		Stop:    "systemctl stop nexus-agent",
+		Disable: "systemctl disable nexus-agent",
+		Reload:  "systemctl daemon-reload",
+		Status:  "systemctl is-active --quiet nexus-agent",
+	},
+	"openrc": {
+		Name:    "openrc",
+		Path:    "/etc/init.d/nexus-agent",
+		Mode:    0755,
+		Paths:   []string{"/etc/init.d/nexus-agent"},
+		Render:  renderOpenRC,
+		Enable:  "rc-update add nexus-agent default && rc-service nexus-agent restart",
+		Stop:    "rc-service nexus-agent stop",
+		Disable: "rc-update del nexus-agent default",
+		Status:  "rc-service nexus-agent status",
+	},
+	"sysvinit": {
+		Name:   "sysvinit",
+		Path:   "/etc/init.d/nexus-agent",
+		Mode:   0755,
+		Paths:  []string{"/etc/init.d/nexus-agent"},
+		Render: renderSysvinit,
+		Enable: "if command -v update-rc.d >/dev/null 2>&1; then update-rc.d nexus-agent defaults; " +
+			"elif command -v chkconfig >/dev/null 2>&1; then chkconfig --add nexus-agent; fi; " +
+			"/etc/init.d/nexus-agent restart",
+		Stop: "/etc/init.d/nexus-agent stop",
+		Disable: "if command -v update-rc.d >/dev/null 2>&1; then update-rc.d -f nexus-agent remove; " +
+			"elif command -v chkconfig >/dev/null 2>&1; then chkconfig --del nexus-agent; fi",
+		Status: "/etc/init.d/nexus-agent status",
+	},
+	"runit": {
+		Name:   "runit",
+		Path:   "/etc/sv/nexus-agent/run",
+		Mode:   0755,
+		Paths:  append([]string{"/etc/sv/nexus-agent"}, runitLinks()...),
+		Render: renderRunit,
+		Enable: "for d in " + strings.Join(runitServiceDirs, " ") + "; do " +
+			`if [ -d "$d" ]; then ln -sfn /etc/sv/nexus-agent "$d/nexus-agent"; break; fi; done`,
+		Stop:    "sv down nexus-agent",
+		Disable: "rm -f " + strings.Join(runitLinks(), " "),
+		Status:  "sv status nexus-agent | grep -q '^run:'",
+	},
+}
+
+// DetectInit returns the init system from the output of DetectInitScript
+func DetectInit(output string) (InitSystem, error) {
+	name := strings.TrimSpace(output)
+	system, ok := InitSystems[name]
+	if !ok {
+		return InitSystem{}, fmt.Errorf("unsupported init system %q", name)
+	}
+	return system, nil
+}
+
+// AgentServicePaths returns the paths of the agent service of all init
+// systems, used to clean up if there is no backup
+func AgentServicePaths() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, name := range []string{"systemd", "openrc", "sysvinit", "runit"} {
+		for _, path := range InitSystems[name].Paths {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	return paths
+}
+
+func runitLinks() []string {
+	links := make([]string, 0, len(runitServiceDirs))
+	for _, dir := range runitServiceDirs {
+		links = append(links, dir+"/nexus-agent")
+	}
+	return links
+}
+
+func renderSystemd(agent, server string) string {
+	return fmt.Sprintf(`[Unit]
+Description=Nexus Agent
+After=network.target
+
+[Service]
+Type=simple
+User=root
+Group=root
+ExecStart=%s -server %s
+Restart=always
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, agent, server)
+}
+
+func renderOpenRC(agent, server string) string {
+	return fmt.Sprintf(`#!/sbin/openrc-run
+
+name="nexus-agent"
+description="Nexus Agent"
+command=%s
+command_args=%s
+output_log="/var/log/nexus-agent.log"
+error_log="/var/log/nexus-agent.log"
+supervisor=supervise-daemon
+respawn_delay=5
+
+depend() {
+	need net
+}
+`, Quote(agent), Quote("-server "+server))
+}
+
+func renderSysvinit(agent, server string) string {
+	return fmt.Sprintf(`#!/bin/sh
+### BEGIN INIT INFO
+# Provides:          nexus-agent
+# Required-Start:    $network $remote_fs
+# Required-Stop:     $network $remote_fs
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: Nexus Agent
+### END INIT INFO
+
+DAEMON=%s
+SERVER=%s
+PIDFILE=/var/run/nexus-agent.pid
+LOG=/var/log/nexus-agent.log
+
+running() {
+	[ -f "$PIDFILE" ] && kill -0 "$(cat "$PIDFILE")" 2>/dev/null
+}
+
+case "$1" in
+start)
+	running && exit 0
+	nohup "$DAEMON" -server "$SERVER" >>"$LOG" 2>&1 &
+	echo $! >"$PIDFILE"
+	;;
+stop)
+	running && kill "$(cat "$PIDFILE")"
+	rm -f "$PIDFILE"
+	;;
+restart)
+	"$0" stop
+	sleep 1
+	"$0" start
+	;;
+status)
+	if running; then
+		echo "nexus-agent is running"
+	else
+		echo "nexus-agent is stopped"
+		exit 3
+	fi
+	;;
+*)
+	echo "Usage: $0 {start|stop|restart|status}"
+	exit 2
+	;;
+esac
+`, Quote(agent), Quote(server))
+}
+
+func renderRunit(agent, server string) string {
+	return fmt.Sprintf(`#!/bin/sh
+exec 2>&1
+exec %s -server %s
+`, Quote(agent), Quote(server))
+}
@@ -0,0 +1,78 @@
+package host
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{name: "Systemd", output: "systemd\n", want: "systemd"},
+		{name: "OpenRC", output: "openrc\n", want: "openrc"},
+		{name: "Sysvinit", output: "sysvinit", want: "sysvinit"},
+		{name: "Runit", output: " runit \n", want: "runit"},
+		{name: "Unknown", output: "unknown\n", wantErr: true},
+		{name: "Empty", output: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := DetectInit(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectInit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Name != tt.want {
+				t.Errorf("DetectInit() = %q, want %q", got.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestInitSystemsRender(t *testing.T) {
+	for name, system := range InitSystems {
+		name, system := name, system
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			got := system.Render("/usr/local/bin/nexus-agent", "nexus.example.com")
+			if !strings.Contains(got, "/usr/local/bin/nexus-agent") ||
+				!strings.Contains(got, "nexus.example.com") {
+				t.Errorf("Render() misses agent or server:\n%s", got)
+			}
+			if !strings.HasPrefix(system.Path, "/etc/") {
+				t.Errorf("Path = %q, want a path below /etc", system.Path)
+			}
+			for _, command := range []string{system.Enable, system.Stop, system.Disable, system.Status} {
+				if command == "" {
+					t.Errorf("%s is missing a service command", name)
+				}
+			}
+		})
+	}
+}
+
+func TestAgentServicePaths(t *testing.T) {
+	t.Parallel()
+	paths := AgentServicePaths()
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if seen[path] {
+			t.Errorf("AgentServicePaths() has %q twice", path)
+		}
+		seen[path] = true
+	}
+	for _, want := range []string{
+		"/etc/systemd/system/nexus-agent.service",
+		"/etc/init.d/nexus-agent",
+		"/etc/sv/nexus-agent",
+	} {
+		if !seen[want] {
+			t.Errorf("AgentServicePaths() misses %q", want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package host
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Oldest OpenSSH versions with AuthorizedPrincipalsFile for certificates and
+// with Include in sshd_config
+var (
+	MinCertificateVersion = [2]int{5, 6}
+	MinIncludeVersion     = [2]int{8, 2}
+)
+
+var openSSHVersion = regexp.MustCompile(`OpenSSH_(\d+)\.(\d+)`)
+
+// ParseOpenSSHVersion returns the major and minor version from the output of
+// `ssh -V` or the banner of sshd
+func ParseOpenSSHVersion(output string) ([2]int, error) {
+	match := openSSHVersion.FindStringSubmatch(output)
+	if match == nil {
+		return [2]int{}, fmt.Errorf("not an OpenSSH version: %q", output)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return [2]int{major, minor}, nil
+}
+
+// VersionAtLeast compares two major and minor versions
+func VersionAtLeast(version, min [2]int) bool {
+	if version[0] != min[0] {
+		return version[0] > min[0]
+	}
+	return version[1] >= min[1]
+}
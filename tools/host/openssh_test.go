@@ -0,0 +1,65 @@
+package host
+
+import "testing"
+
+func TestParseOpenSSHVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    [2]int
+		wantErr bool
+	}{
+		{
+			name:   "Ubuntu",
+			output: "OpenSSH_8.9p1 Ubuntu-3ubuntu0.10, OpenSSL 3.0.2 15 Mar 2022\n",
+			want:   [2]int{8, 9},
+		},
+		{
+			name:   "Banner",
+			output: "SSH-2.0-OpenSSH_7.4",
+			want:   [2]int{7, 4},
+		},
+		{
+			name:   "Double digit minor",
+			output: "OpenSSH_9.10p1, LibreSSL 4.0.0",
+			want:   [2]int{9, 10},
+		},
+		{
+			name:    "Dropbear",
+			output:  "Dropbear v2022.83",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseOpenSSHVersion(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseOpenSSHVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseOpenSSHVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	tests := []struct {
+		version [2]int
+		min     [2]int
+		want    bool
+	}{
+		{version: [2]int{8, 2}, min: MinIncludeVersion, want: true},
+		{version: [2]int{8, 1}, min: MinIncludeVersion, want: false},
+		{version: [2]int{9, 0}, min: MinIncludeVersion, want: true},
+		{version: [2]int{7, 9}, min: MinIncludeVersion, want: false},
+		{version: [2]int{5, 6}, min: MinCertificateVersion, want: true},
+	}
+	for _, tt := range tests {
+		if got := VersionAtLeast(tt.version, tt.min); got != tt.want {
+			t.Errorf("VersionAtLeast(%v, %v) = %v, want %v", tt.version, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package host
+
+import "io/fs"
+
+func fileOwner(fs.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,74 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ValidPrincipal checks if a principal fits on a single line of an
+// AuthorizedPrincipalsFile
+func ValidPrincipal(principal string) bool {
+	return principal != "" && !strings.ContainsAny(principal, " \t\r\n\x00#")
+}
+
+// UpdatePrincipals writes one principals file per linux user to dir and
+// removes the files of users which no longer exist
+func UpdatePrincipals(fsys FS, backup *Backup, dir string, principals map[string][]string) error {
+	if err := backup.Snapshot(dir); err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range principals {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range names {
+		if !ValidUsername(name) {
+			errs = append(errs, fmt.Errorf("invalid username: %q", name))
+			continue
+		}
+		var lines []string
+		for _, principal := range principals[name] {
+			if !ValidPrincipal(principal) {
+				errs = append(errs, fmt.Errorf("invalid principal for %s: %q", name, principal))
+				continue
+			}
+			lines = append(lines, principal+"\n")
+		}
+
+		path := filepath.Join(dir, name)
+		if err := backup.Snapshot(path); err != nil {
+			return err
+		}
+		if err := fsys.WriteFile(path, []byte(strings.Join(lines, "")), 0644); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for _, entry := range entries {
+		if _, ok := principals[entry.Name()]; ok {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if err := backup.Snapshot(path); err != nil {
+			return err
+		}
+		if err := fsys.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,50 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdatePrincipals(t *testing.T) {
+	root := t.TempDir()
+	backup := &Backup{FS: Local{}, Dir: filepath.Join(root, "backup")}
+	dir := filepath.Join(root, "principals")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "old"), []byte("x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := UpdatePrincipals(Local{}, backup, dir, map[string][]string{
+		"root":    {"root", "alice"},
+		"deploy":  {"bob", "evil\nroot"},
+		"../etc":  {"mallory"},
+		"web-app": nil,
+	})
+	if err == nil {
+		t.Error("UpdatePrincipals() accepted invalid names")
+	}
+
+	tests := map[string]string{
+		"root":    "root\nalice\n",
+		"deploy":  "bob\n",
+		"web-app": "",
+	}
+	for name, want := range tests {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("principals of %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("principals of %s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old")); !os.IsNotExist(err) {
+		t.Error("UpdatePrincipals() kept the principals of a removed user")
+	}
+	if _, err := os.Stat(filepath.Join(root, "etc")); !os.IsNotExist(err) {
+		t.Error("UpdatePrincipals() wrote outside of the principals directory")
+	}
+}
@@ -0,0 +1,108 @@
+package host
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log files of sshd if the journal isn't available
+var AuthLogPaths = []string{"/var/log/auth.log", "/var/log/secure", "/var/log/messages"}
+
+var (
+	loginRegex = regexp.MustCompile(
+		`^(Accepted|Failed) (\S+) for (?:invalid user )?(\S+) from (\S+) port (\d+)(?: ssh2)?(?:: (.*))?$`,
+	)
+	certRegex = regexp.MustCompile(
+		`^(\S+)-CERT (\S+) ID (.*) \(serial (\d+)\) CA (\S+) (\S+)`,
+	)
+	keyRegex    = regexp.MustCompile(`^(\S+) (SHA256:\S+|MD5:\S+)`)
+	syslogRegex = regexp.MustCompile(`^(\S+(?: +\S+ +\S+)?) \S+ (?:sshd|sshd-session)\[\d+\]: (.*)$`)
+)
+
+// LoginEvent is a single accepted or failed login parsed from the sshd logs
+type LoginEvent struct {
+	Time        time.Time `json:"time"`
+	Accepted    bool      `json:"accepted"`
+	Method      string    `json:"method"`
+	User        string    `json:"user"`
+	Address     string    `json:"address"`
+	Port        int       `json:"port"`
+	KeyType     string    `json:"key_type,omitempty"`
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	KeyID       string    `json:"key_id,omitempty"`
+	Serial      uint64    `json:"serial,omitempty"`
+	CA          string    `json:"ca,omitempty"`
+}
+
+// Certificate reports if the login used a certificate
+func (e *LoginEvent) Certificate() bool {
+	return e.KeyID != ""
+}
+
+// ParseLogin parses the message of a sshd log line, other messages are ignored
+func ParseLogin(message string, at time.Time) (*LoginEvent, bool) {
+	match := loginRegex.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return nil, false
+	}
+
+	port, _ := strconv.Atoi(match[5])
+	event := &LoginEvent{
+		Time:     at,
+		Accepted: match[1] == "Accepted",
+		Method:   match[2],
+		User:     match[3],
+		Address:  match[4],
+		Port:     port,
+	}
+
+	details := match[6]
+	if cert := certRegex.FindStringSubmatch(details); cert != nil {
+		event.KeyType = cert[1] + "-CERT"
+		event.Fingerprint = cert[2]
+		event.KeyID = strings.Trim(cert[3], `"`)
+		event.Serial, _ = strconv.ParseUint(cert[4], 10, 64)
+		event.CA = cert[6]
+	} else if key := keyRegex.FindStringSubmatch(details); key != nil {
+		event.KeyType = key[1]
+		event.Fingerprint = key[2]
+	}
+	return event, true
+}
+
+// ParseJournal parses a line of `journalctl -o json`
+func ParseJournal(line []byte) (*LoginEvent, bool) {
+	var entry struct {
+		Message   string `json:"MESSAGE"`
+		Timestamp string `json:"__REALTIME_TIMESTAMP"`
+	}
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return nil, false
+	}
+
+	at := time.Now().UTC()
+	if usec, err := strconv.ParseInt(entry.Timestamp, 10, 64); err == nil {
+		at = time.UnixMicro(usec).UTC()
+	}
+	return ParseLogin(entry.Message, at)
+}
+
+// ParseSyslog parses a line of a syslog file like /var/log/auth.log, the
+// current time is used if the timestamp has no year or can't be parsed
+func ParseSyslog(line string, now time.Time) (*LoginEvent, bool) {
+	match := syslogRegex.FindStringSubmatch(line)
+	if match == nil {
+		return nil, false
+	}
+
+	at := now.UTC()
+	if t, err := time.Parse(time.RFC3339Nano, match[1]); err == nil {
+		at = t.UTC()
+	} else if t, err := time.ParseInLocation(time.Stamp, match[1], time.Local); err == nil {
+		at = t.AddDate(now.Year(), 0, 0).UTC()
+	}
+	return ParseLogin(match[2], at)
+}
@@ -0,0 +1,134 @@
+package host
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLogin(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		message string
+		want    *LoginEvent
+		wantOk  bool
+	}{
+		{
+			name:    "Accepted certificate",
+			message: "Accepted publickey for deploy from 10.0.0.5 port 51234 ssh2: ED25519-CERT SHA256:abc ID 1234-abcd@ssh-nexus (serial 1714564800) CA ED25519 SHA256:xyz",
+			want: &LoginEvent{
+				Time:        at,
+				Accepted:    true,
+				Method:      "publickey",
+				User:        "deploy",
+				Address:     "10.0.0.5",
+				Port:        51234,
+				KeyType:     "ED25519-CERT",
+				Fingerprint: "SHA256:abc",
+				KeyID:       "1234-abcd@ssh-nexus",
+				Serial:      1714564800,
+				CA:          "SHA256:xyz",
+			},
+			wantOk: true,
+		},
+		{
+			name:    "Accepted plain key",
+			message: "Accepted publickey for root from 2001:db8::1 port 22 ssh2: RSA SHA256:def",
+			want: &LoginEvent{
+				Time:        at,
+				Accepted:    true,
+				Method:      "publickey",
+				User:        "root",
+				Address:     "2001:db8::1",
+				Port:        22,
+				KeyType:     "RSA",
+				Fingerprint: "SHA256:def",
+			},
+			wantOk: true,
+		},
+		{
+			name:    "Failed invalid user",
+			message: "Failed publickey for invalid user admin from 192.0.2.1 port 4000 ssh2: ED25519 SHA256:ghi",
+			want: &LoginEvent{
+				Time:        at,
+				Method:      "publickey",
+				User:        "admin",
+				Address:     "192.0.2.1",
+				Port:        4000,
+				KeyType:     "ED25519",
+				Fingerprint: "SHA256:ghi",
+			},
+			wantOk: true,
+		},
+		{
+			name:    "Other message",
+			message: "Connection closed by 10.0.0.5 port 51234 [preauth]",
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParseLogin(tt.message, at)
+			if ok != tt.wantOk {
+				t.Fatalf("ParseLogin() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if !ok {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("ParseLogin() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseJournal(t *testing.T) {
+	line := `{"MESSAGE":"Accepted publickey for root from 10.0.0.5 port 22 ssh2: ED25519 SHA256:abc","__REALTIME_TIMESTAMP":"1714564800000000"}`
+	got, ok := ParseJournal([]byte(line))
+	if !ok {
+		t.Fatal("ParseJournal() ok = false")
+	}
+	if !got.Time.Equal(time.Unix(1714564800, 0)) || got.User != "root" {
+		t.Errorf("ParseJournal() = %+v", got)
+	}
+}
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2024, 5, 1, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		line string
+		want time.Time
+	}{
+		{
+			name: "ISO timestamp",
+			line: "2024-05-01T12:00:00.000000+00:00 web sshd[42]: Accepted publickey for root from 10.0.0.5 port 22 ssh2: ED25519 SHA256:abc",
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "Traditional timestamp",
+			line: "May  1 12:00:00 web sshd[42]: Accepted publickey for root from 10.0.0.5 port 22 ssh2: ED25519 SHA256:abc",
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local),
+		},
+		{
+			name: "Session process",
+			line: "2024-05-01T12:00:00Z web sshd-session[42]: Accepted publickey for root from 10.0.0.5 port 22 ssh2: ED25519 SHA256:abc",
+			want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := ParseSyslog(tt.line, now)
+			if !ok {
+				t.Fatal("ParseSyslog() ok = false")
+			}
+			if !got.Time.Equal(tt.want) {
+				t.Errorf("ParseSyslog() time = %v, want %v", got.Time, tt.want)
+			}
+		})
+	}
+}
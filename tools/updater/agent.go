@@ -0,0 +1,246 @@
+package updater
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+)
+
+// Name of the checksum file of a release
+const checksumAsset = "checksums.txt"
+
+// agentReleaseTTL is how long a looked up release is used for agent
+// installs, installing on many machines doesn't run into the rate limit
+// of the releases API
+const agentReleaseTTL = 10 * time.Minute
+
+// agentReleases caches the latest release and its checksums
+var agentReleases = &releaseCache{}
+
+type releaseCache struct {
+	mu      sync.Mutex
+	release *release
+	err     error
+	fetched time.Time
+	// Checksums of the release with the tag
+	sumsTag string
+	sums    map[string]string
+}
+
+// latest returns the latest release, failed lookups are cached as well
+func (c *releaseCache) latest() (*release, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fetched.IsZero() || time.Since(c.fetched) > agentReleaseTTL {
+		c.release, c.err = fetchLatestRelease()
+		c.fetched = time.Now()
+	}
+	return c.release, c.err
+}
+
+// checksums returns the checksums of a release
+func (c *releaseCache) checksums(r *release) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sumsTag == r.Tag {
+		return c.sums, nil
+	}
+	asset := r.findAsset(checksumAsset)
+	if asset == nil {
+		return nil, fmt.Errorf("release %s has no %s", r.Tag, checksumAsset)
+	}
+	sums, err := fetchChecksums(asset.DownloadURL)
+	if err != nil {
+		return nil, err
+	}
+	c.sumsTag, c.sums = r.Tag, sums
+	return sums, nil
+}
+
+// Platform is the os and architecture of a machine in GOOS/GOARCH terms
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+func (p Platform) String() string {
+	return p.OS + "/" + p.Arch
+}
+
+// ParseUname parses the output of `uname -sm`
+func ParseUname(output string) (Platform, error) {
+	fields := strings.Fields(output)
+	if len(fields) != 2 {
+		return Platform{}, fmt.Errorf("unexpected uname output: %q", strings.TrimSpace(output))
+	}
+
+	p := Platform{OS: strings.ToLower(fields[0])}
+	switch fields[1] {
+	case "x86_64", "amd64":
+		p.Arch = "amd64"
+	case "aarch64", "arm64", "armv8l":
+		p.Arch = "arm64"
+	case "armv7l", "armv7":
+		p.Arch = "armv7"
+	case "i386", "i486", "i586", "i686":
+		p.Arch = "386"
+	default:
+		p.Arch = strings.ToLower(fields[1])
+	}
+	return p, nil
+}
+
+// assetName returns the name of the release binary for a platform
+func assetName(name string, p Platform) string {
+	return name + "_" + p.OS + "_" + p.Arch
+}
+
+// AgentBinary returns the path of the latest agent for a platform. Agents are
+// cached per platform and verified against the checksums of the release,
+// which is looked up again after agentReleaseTTL.
+func AgentBinary(p Platform) (string, error) {
+	name := assetName("nexus-agent", p)
+	dir := filepath.Join(data.AgentCacheDir, name)
+	path := filepath.Join(dir, "nexus-agent")
+	versionPath := filepath.Join(dir, "version")
+
+	latest, err := agentReleases.latest()
+	if err != nil {
+		// Offline servers keep installing the agent they have
+		if _, statErr := os.Stat(path); statErr == nil {
+			slog.Warn("Failed to check for a newer agent, using cached agent", "err", err)
+			return path, nil
+		}
+		return "", err
+	}
+
+	if version, err := os.ReadFile(versionPath); err == nil &&
+		strings.TrimSpace(string(version)) == latest.Tag {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	asset := latest.findAsset(name)
+	if asset == nil {
+		return "", fmt.Errorf("unsupported platform %s: release %s has no agent for it", p, latest.Tag)
+	}
+	sums, err := agentReleases.checksums(latest)
+	if err != nil {
+		return "", err
+	}
+	sum, ok := sums[name]
+	if !ok {
+		return "", fmt.Errorf("no checksum for %s in release %s", name, latest.Tag)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	slog.Info("Downloading...", "release", latest.Tag, "binary", name)
+	if err := downloadVerified(asset.DownloadURL, path, sum); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	if err := os.WriteFile(versionPath, []byte(latest.Tag+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (r *release) findAsset(name string) *releaseAsset {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset
+		}
+	}
+	return nil
+}
+
+// fetchChecksums downloads a sha256sum style file and maps names to sums
+func fetchChecksums(url string) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	res, err := get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return parseChecksums(res.Body)
+}
+
+func parseChecksums(r io.Reader) (map[string]string, error) {
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// downloadVerified downloads a file next to dest and only moves it in place
+// if the sha256 sum matches
+func downloadVerified(url, dest, sum string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	res, err := get(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), res.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		return fmt.Errorf("checksum mismatch: expected %s, got %s", sum, got)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("(%d) failed to download %s", res.StatusCode, url)
+	}
+	return res, nil
+}
@@ -0,0 +1,104 @@
+package updater
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/MizuchiLabs/ssh-nexus/tools/data"
+)
+
+func TestParseUname(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Platform
+		wantErr bool
+	}{
+		{name: "Linux amd64", output: "Linux x86_64\n", want: Platform{"linux", "amd64"}},
+		{name: "Raspberry Pi", output: "Linux aarch64", want: Platform{"linux", "arm64"}},
+		{name: "Armv7", output: "Linux armv7l", want: Platform{"linux", "armv7"}},
+		{name: "FreeBSD", output: "FreeBSD amd64", want: Platform{"freebsd", "amd64"}},
+		{name: "Garbage", output: "sh: uname: not found", wantErr: true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ParseUname(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUname() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseUname() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgentBinary(t *testing.T) {
+	agent := []byte("arm64 agent")
+	hash := sha256.Sum256(agent)
+	checksums := fmt.Sprintf("%s  nexus-agent_linux_arm64\n", hex.EncodeToString(hash[:]))
+
+	var lookups atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/MizuchiLabs/ssh-nexus/releases/latest":
+			lookups.Add(1)
+			_ = json.NewEncoder(w).Encode(release{Tag: "v1.2.3", Assets: []*releaseAsset{
+				{Name: "nexus-agent_linux_arm64", DownloadURL: server.URL + "/agent"},
+				{Name: "nexus-agent_linux_amd64", DownloadURL: server.URL + "/corrupt"},
+				{Name: checksumAsset, DownloadURL: server.URL + "/checksums"},
+			}})
+		case "/agent":
+			_, _ = w.Write(agent)
+		case "/corrupt":
+			_, _ = w.Write([]byte("tampered"))
+		case "/checksums":
+			lookups.Add(1)
+			_, _ = w.Write([]byte(checksums + "0000  nexus-agent_linux_amd64\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("PB_REPO_URL", server.URL)
+	cacheDir := data.AgentCacheDir
+	data.AgentCacheDir = t.TempDir()
+	defer func() { data.AgentCacheDir = cacheDir }()
+	releases := agentReleases
+	agentReleases = &releaseCache{}
+	defer func() { agentReleases = releases }()
+
+	path, err := AgentBinary(Platform{OS: "linux", Arch: "arm64"})
+	if err != nil {
+		t.Fatalf("AgentBinary() error = %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(agent) {
+		t.Errorf("AgentBinary() content = %q, want %q", got, agent)
+	}
+
+	if _, err := AgentBinary(Platform{OS: "linux", Arch: "amd64"}); err == nil {
+		t.Error("AgentBinary() accepted a binary with a wrong checksum")
+	}
+	if _, err := AgentBinary(Platform{OS: "linux", Arch: "riscv64"}); err == nil {
+		t.Error("AgentBinary() accepted an unsupported platform")
+	}
+	// The release and its checksums are looked up once for all platforms
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("AgentBinary() made %d release and checksum requests, want 2", n)
+	}
+}
@@ -2,23 +2,19 @@
 package updater
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/MizuchiLabs/ssh-nexus/tools/data"
 	"github.com/caarlos0/env/v11"
 )
 
@@ -96,57 +92,6 @@ func UpdateSelf(version string, update bool) {
 	slog.Info("Update success!")
 }
 
-// CheckAgent checks if the agent is up to date and downloaded already
-func CheckAgent() error {
-	_, err := os.Stat(data.AgentDownloadPath)
-	if errors.Is(err, os.ErrNotExist) {
-		if err = downloadAgent(); err != nil {
-			return err
-		}
-	}
-
-	cmd := exec.Command(data.AgentDownloadPath, "-version")
-
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	if err = cmd.Run(); err != nil {
-		return err
-	}
-
-	latest, err := fetchLatestRelease()
-	if err != nil {
-		return err
-	}
-	version := strings.TrimSpace(out.String())
-	if compareVersions(
-		strings.TrimPrefix(version, "v"),
-		strings.TrimPrefix(latest.Tag, "v"),
-	) == 1 {
-		if err := downloadAgent(); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-func downloadAgent() error {
-	latest, err := fetchLatestRelease()
-	if err != nil {
-		return err
-	}
-	asset := latest.findBinary("nexus-agent")
-	if asset == nil {
-		return fmt.Errorf("agent not found")
-	}
-	slog.Info("Downloading...", "release", latest.Tag, "binary", asset.Name)
-	if err := downloadFile(asset.DownloadURL, data.AgentDownloadPath); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 func getRepository() (*repository, error) {
 	config := repository{}
 	if err := env.Parse(&config); err != nil {
@@ -236,41 +181,11 @@ func downloadFile(url string, dest string) error {
 }
 
 func (r *release) findBinary(name string) *releaseAsset {
-	var assetName string
-
-	switch runtime.GOOS {
-	case "linux":
-		switch runtime.GOARCH {
-		case "amd64":
-			assetName = name + "_linux_amd64"
-		case "arm64":
-			assetName = name + "_linux_arm64"
-		case "arm":
-			assetName = name + "_linux_armv7"
-		}
-	case "darwin":
-		switch runtime.GOARCH {
-		case "amd64":
-			assetName = name + "_darwin_amd64"
-		case "arm64":
-			assetName = name + "_darwin_arm64"
-		}
-	case "windows":
-		switch runtime.GOARCH {
-		case "amd64":
-			assetName = name + "_windows_amd64"
-		case "arm64":
-			assetName = name + "_windows_arm64"
-		}
+	arch := runtime.GOARCH
+	if arch == "arm" {
+		arch = "armv7"
 	}
-
-	for _, asset := range r.Assets {
-		if assetName == asset.Name {
-			return asset
-		}
-	}
-
-	return nil
+	return r.findAsset(assetName(name, Platform{OS: runtime.GOOS, Arch: arch}))
 }
 
 func compareVersions(a, b string) int {
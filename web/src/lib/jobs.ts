@@ -0,0 +1,29 @@
+import { pb } from "$lib/client";
+import { toast } from "svelte-sonner";
+
+const finished = ["succeeded", "failed", "canceled"];
+
+// Start a sync job and report its outcome once it finished
+export const runJob = async (path: string, label: string) => {
+  try {
+    const res = await pb.send(path, { method: "POST" });
+    toast.info(`${label} started`);
+
+    const unsubscribe = await pb
+      .collection("jobs")
+      .subscribe(res.job, (e) => {
+        const job = e.record;
+        if (!finished.includes(job.status)) return;
+        unsubscribe();
+        if (job.status === "succeeded") {
+          toast.success(`${label} finished (${job.done}/${job.total})`);
+        } else if (job.status === "failed") {
+          toast.error(`${label} failed: ${job.error}`);
+        } else {
+          toast.warning(`${label} canceled`);
+        }
+      });
+  } catch (error: any) {
+    toast.error(error.data?.message || "Something went wrong.");
+  }
+};